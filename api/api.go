@@ -0,0 +1,344 @@
+// Package api is the JSON schema of /api/v2. Its types are kept apart from the
+// db structs so storage can change without changing responses: fields are
+// snake_case, times are RFC 3339 in UTC, and optional values are omitted or
+// null rather than encoded as sql.Null.
+package api
+
+import (
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/feedgen"
+	"gitfeed/github"
+	"gitfeed/trending"
+	"net/http"
+	"time"
+)
+
+// Post is a stored Bluesky post that links to a repository. TimeUs is when
+// Jetstream saw it, and is what listings page by.
+type Post struct {
+	URI           string    `json:"uri"`
+	Did           string    `json:"did"`
+	Rkey          string    `json:"rkey"`
+	Cid           string    `json:"cid"`
+	Permalink     string    `json:"permalink"`
+	Text          string    `json:"text"`
+	CreatedAt     time.Time `json:"created_at"`
+	TimeUs        int64     `json:"time_us"`
+	Langs         []string  `json:"langs"`
+	LangsDetected bool      `json:"langs_detected"`
+	Link          Link      `json:"link"`
+	// Repo is GitHub's metadata for the linked repository, when requested
+	// and GitHub answered in time.
+	Repo  *github.Repo `json:"repo,omitempty"`
+	Reply *Reply       `json:"reply,omitempty"`
+}
+
+// Link is the link a post was matched on. Forge, owner and name are set when
+// it points at a repository.
+type Link struct {
+	URL   string `json:"url"`
+	Forge string `json:"forge,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Reply is the thread a post replies in.
+type Reply struct {
+	Parent PostRef `json:"parent"`
+	Root   PostRef `json:"root"`
+}
+
+// PostRef points at another post, with the post itself when it's stored.
+type PostRef struct {
+	URI       string `json:"uri"`
+	Cid       string `json:"cid"`
+	Permalink string `json:"permalink,omitempty"`
+	Post      *Post  `json:"post,omitempty"`
+}
+
+type Posts struct {
+	Posts []Post `json:"posts"`
+	// Cursor fetches the next page, and is left out on the last one.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type Timestamp struct {
+	TimeUs int64 `json:"time_us"`
+}
+
+// Repository is a repository linked from stored posts. Mentions and Authors
+// count every stored post. Metadata is set once it has been fetched from
+// GitHub.
+type Repository struct {
+	Forge     string              `json:"forge"`
+	Owner     string              `json:"owner"`
+	Name      string              `json:"name"`
+	URL       string              `json:"url"`
+	Mentions  int64               `json:"mentions"`
+	Authors   int64               `json:"authors"`
+	FirstSeen time.Time           `json:"first_seen"`
+	LastSeen  time.Time           `json:"last_seen"`
+	Metadata  *RepositoryMetadata `json:"metadata,omitempty"`
+}
+
+type RepositoryMetadata struct {
+	Description string    `json:"description"`
+	Stars       int64     `json:"stars"`
+	Forks       int64     `json:"forks"`
+	Language    string    `json:"language"`
+	Topics      []string  `json:"topics"`
+	License     string    `json:"license"`
+	Archived    bool      `json:"archived"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+type Repositories struct {
+	Repositories []Repository `json:"repositories"`
+}
+
+type RepositoryDetail struct {
+	Repository Repository      `json:"repository"`
+	Mentions   []MentionBucket `json:"mentions"`
+	Sharers    []Sharer        `json:"sharers"`
+	Posts      []Post          `json:"posts"`
+	// Cursor fetches the next page of posts, and is left out on the last one.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type Sharer struct {
+	Did         string    `json:"did"`
+	Posts       int64     `json:"posts"`
+	FirstShared time.Time `json:"first_shared"`
+}
+
+type Owner struct {
+	Forge        string    `json:"forge"`
+	Owner        string    `json:"owner"`
+	Repositories int64     `json:"repositories"`
+	Mentions     int64     `json:"mentions"`
+	Sharers      int64     `json:"sharers"`
+	Stars        int64     `json:"stars"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+type OwnerDetail struct {
+	Owner        Owner           `json:"owner"`
+	Repositories []Repository    `json:"repositories"`
+	Mentions     []MentionBucket `json:"mentions"`
+}
+
+type MentionBucket struct {
+	Start    time.Time `json:"start"`
+	Mentions int64     `json:"mentions"`
+}
+
+// HistoryBucket is a day of mentions with that day's star and fork counts,
+// which are null on days without a snapshot.
+type HistoryBucket struct {
+	Start    time.Time `json:"start"`
+	Mentions int64     `json:"mentions"`
+	Stars    *int64    `json:"stars"`
+	Forks    *int64    `json:"forks"`
+}
+
+type History struct {
+	Repository string          `json:"repository"`
+	Since      time.Time       `json:"since"`
+	Until      time.Time       `json:"until"`
+	Buckets    []HistoryBucket `json:"buckets"`
+}
+
+// ActivityBucket counts matched posts and their authors, and splits the posts
+// by language and forge.
+type ActivityBucket struct {
+	Start   time.Time        `json:"start"`
+	Posts   int64            `json:"posts"`
+	Authors int64            `json:"authors"`
+	Langs   map[string]int64 `json:"langs"`
+	Forges  map[string]int64 `json:"forges"`
+}
+
+// Timeseries has Buckets for every matched post, or Mentions when it's for
+// one repository.
+type Timeseries struct {
+	Granularity string           `json:"granularity"`
+	Since       time.Time        `json:"since"`
+	Until       time.Time        `json:"until"`
+	Repository  string           `json:"repository,omitempty"`
+	Buckets     []ActivityBucket `json:"buckets,omitempty"`
+	Mentions    []MentionBucket  `json:"mentions,omitempty"`
+}
+
+type TrendingRepository struct {
+	Forge      string    `json:"forge"`
+	Owner      string    `json:"owner"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Score      float64   `json:"score"`
+	Mentions   int       `json:"mentions"`
+	Authors    int       `json:"authors"`
+	Engagement int64     `json:"engagement"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+type Trending struct {
+	Window       string               `json:"window"`
+	Repositories []TrendingRepository `json:"repositories"`
+}
+
+// Problem is an RFC 7807 error, served as application/problem+json.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// NewProblem describes a failure by its status alone, so Type is
+// about:blank and Title the status text.
+func NewProblem(status int, detail, instance string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+	}
+}
+
+// Time converts a time_us into a UTC time.
+func Time(us int64) time.Time {
+	return time.UnixMicro(us).UTC()
+}
+
+func Permalink(did, rkey string) string {
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", did, rkey)
+}
+
+func NewPost(p db.DBPost) Post {
+	post := Post{
+		URI:           feedgen.PostURI(p),
+		Did:           p.Did,
+		Rkey:          p.Rkey,
+		Cid:           p.Cid,
+		Permalink:     Permalink(p.Did, p.Rkey),
+		Text:          p.Text,
+		CreatedAt:     p.CreatedAt.UTC(),
+		TimeUs:        p.TimeUs,
+		Langs:         list(p.Languages),
+		LangsDetected: p.LanguagesDetected,
+		Link:          Link{URL: p.URI},
+	}
+	if repo, ok := db.ParseRepositoryURL(p.URI); ok {
+		post.Link.Forge, post.Link.Owner, post.Link.Name = repo.Forge, repo.Owner, repo.Name
+	}
+	if p.ParentURI != "" {
+		post.Reply = &Reply{
+			Parent: PostRef{URI: p.ParentURI, Cid: p.ParentCid},
+			Root:   PostRef{URI: p.RootURI, Cid: p.RootCid},
+		}
+	}
+	return post
+}
+
+func NewRepository(m db.RepositoryMetadata) Repository {
+	r := Repository{
+		Forge:     m.Forge,
+		Owner:     m.Owner,
+		Name:      m.Name,
+		URL:       m.URL(),
+		Mentions:  m.MentionCount,
+		Authors:   m.DistinctAuthors,
+		FirstSeen: Time(m.FirstSeen),
+		LastSeen:  Time(m.LastSeen),
+	}
+	if m.Status == http.StatusOK {
+		r.Metadata = &RepositoryMetadata{
+			Description: m.Description,
+			Stars:       m.Stars,
+			Forks:       m.Forks,
+			Language:    m.Language,
+			Topics:      list(m.Topics),
+			License:     m.License,
+			Archived:    m.Archived,
+			FetchedAt:   Time(m.FetchedAt),
+		}
+	}
+	return r
+}
+
+func NewRepositories(ms []db.RepositoryMetadata) []Repository {
+	return convert(ms, NewRepository)
+}
+
+func NewSharers(ss []db.Sharer) []Sharer {
+	return convert(ss, func(s db.Sharer) Sharer {
+		return Sharer{Did: s.Did, Posts: s.Posts, FirstShared: Time(s.FirstShared)}
+	})
+}
+
+func NewOwner(o db.Owner) Owner {
+	return Owner{
+		Forge:        o.Forge,
+		Owner:        o.Owner,
+		Repositories: o.Repositories,
+		Mentions:     o.Mentions,
+		Sharers:      o.Sharers,
+		Stars:        o.Stars,
+		FirstSeen:    Time(o.FirstSeen),
+		LastSeen:     Time(o.LastSeen),
+	}
+}
+
+func NewMentionBuckets(bs []db.RepositoryBucket) []MentionBucket {
+	return convert(bs, func(b db.RepositoryBucket) MentionBucket {
+		return MentionBucket{Start: Time(b.Start), Mentions: b.Mentions}
+	})
+}
+
+func NewHistoryBuckets(bs []db.HistoryBucket) []HistoryBucket {
+	return convert(bs, func(b db.HistoryBucket) HistoryBucket {
+		return HistoryBucket{Start: Time(b.Start), Mentions: b.Mentions, Stars: b.Stars, Forks: b.Forks}
+	})
+}
+
+func NewActivityBuckets(bs []db.Bucket) []ActivityBucket {
+	return convert(bs, func(b db.Bucket) ActivityBucket {
+		return ActivityBucket{Start: Time(b.Start), Posts: b.Posts, Authors: b.Authors, Langs: b.Langs, Forges: b.Forges}
+	})
+}
+
+func NewTrendingRepositories(rs []trending.Repository) []TrendingRepository {
+	return convert(rs, func(r trending.Repository) TrendingRepository {
+		return TrendingRepository{
+			Forge:      r.Forge,
+			Owner:      r.Owner,
+			Name:       r.Name,
+			URL:        r.URL,
+			Score:      r.Score,
+			Mentions:   r.Mentions,
+			Authors:    r.Authors,
+			Engagement: r.Engagement,
+			LastSeen:   Time(r.LastSeen),
+		}
+	})
+}
+
+// convert maps a list, encoding an empty one as [] rather than null.
+func convert[From, To any](from []From, f func(From) To) []To {
+	to := make([]To, len(from))
+	for i, v := range from {
+		to[i] = f(v)
+	}
+	return to
+}
+
+func list(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,290 @@
+// Package backfill loads archived events into the database through the same
+// matching live ingest uses, so a fresh deployment doesn't start empty.
+package backfill
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/jetstream"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	// Jetstream is one Jetstream event per line, as ingest reads them.
+	Jetstream Format = "jetstream"
+	// Posts is a JSON document shaped like handlers.PostRequest.
+	Posts Format = "posts"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Jetstream, Posts:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown import format %q, want jetstream or posts", s)
+}
+
+// DetectFormat guesses the format from a file name: .json files hold a posts
+// document and anything else is read as Jetstream lines.
+func DetectFormat(path string) Format {
+	name := strings.TrimSuffix(strings.TrimSuffix(path, ".gz"), ".zst")
+	if strings.HasSuffix(name, ".json") {
+		return Posts
+	}
+	return Jetstream
+}
+
+type Stats struct {
+	Inserted int64 `json:"inserted"`
+	// Skipped counts records that don't match, aren't posts, or are already stored.
+	Skipped int64 `json:"skipped"`
+	Failed  int64 `json:"failed"`
+	Deleted int64 `json:"deleted"`
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("inserted %d, skipped %d, failed %d, deleted %d", s.Inserted, s.Skipped, s.Failed, s.Deleted)
+}
+
+// Checkpoint records how many records of a source have been committed, so an
+// interrupted import can pick up after the last batch.
+type Checkpoint struct {
+	Source    string    `json:"source"`
+	Records   int64     `json:"records"`
+	Done      bool      `json:"done"`
+	Stats     Stats     `json:"stats"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadCheckpoint reads a checkpoint, returning an empty one if there is none.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("error parsing checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// Save writes the checkpoint atomically, so a crash leaves the old one intact.
+func (cp Checkpoint) Save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+const DefaultBatchSize = 1000
+
+type Importer struct {
+	Repo db.ImportRepo
+	// BatchSize is how many records are committed per transaction.
+	BatchSize int
+	// Save is called with the checkpoint after every committed batch.
+	Save func(Checkpoint) error
+}
+
+// Import reads records from r, skipping the ones cp says are already
+// committed, and returns the final checkpoint.
+func (im *Importer) Import(r io.Reader, format Format, cp Checkpoint) (Checkpoint, error) {
+	if cp.Done {
+		return cp, nil
+	}
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var next func() (json.RawMessage, error)
+	switch format {
+	case Jetstream:
+		next = lineReader(r)
+	case Posts:
+		next = postsReader(r)
+	default:
+		return cp, fmt.Errorf("unknown import format %q", format)
+	}
+
+	for skipped := int64(0); skipped < cp.Records; skipped++ {
+		if _, err := next(); err != nil {
+			return cp, fmt.Errorf("source ends at record %d, before the checkpoint at %d: %w", skipped, cp.Records, err)
+		}
+	}
+
+	var batch []db.DBPost
+	// pending holds the counts for records read since the last commit.
+	var pending Stats
+	var read int64
+
+	flush := func() error {
+		if len(batch) > 0 {
+			inserted, err := im.Repo.ImportPosts(batch)
+			if err != nil {
+				return err
+			}
+			pending.Inserted += int64(inserted)
+			pending.Skipped += int64(len(batch) - inserted)
+			batch = batch[:0]
+		}
+		cp.Records += read
+		cp.Stats.Inserted += pending.Inserted
+		cp.Stats.Skipped += pending.Skipped
+		cp.Stats.Failed += pending.Failed
+		cp.Stats.Deleted += pending.Deleted
+		cp.UpdatedAt = time.Now().UTC()
+		read, pending = 0, Stats{}
+		if im.Save != nil {
+			return im.Save(cp)
+		}
+		return nil
+	}
+
+	for {
+		raw, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return cp, err
+		}
+		read++
+
+		var event db.ATPost
+		switch err := json.Unmarshal(raw, &event); {
+		case err != nil:
+			log.Printf("Skipping malformed record %d: %v", cp.Records+read, err)
+			pending.Failed++
+		case event.Commit.Collection == "app.bsky.feed.like" || event.Commit.Collection == "app.bsky.feed.repost":
+			pending.Skipped++
+		case event.Commit.Operation == "delete":
+			// Commit the records before the delete, so a post created and
+			// deleted inside the archive ends up deleted. The delete itself is
+			// checkpointed with the next batch; replaying it is harmless.
+			read--
+			if err := flush(); err != nil {
+				return cp, err
+			}
+			read++
+			if err := im.Repo.DeletePost(event.Did, event.Commit.Collection, event.Commit.Rkey); err != nil {
+				return cp, err
+			}
+			pending.Deleted++
+		default:
+			post := jetstream.ProcessPost(event)
+			switch {
+			case post.URI == "":
+				pending.Skipped++
+			case post.Did == "" || post.Rkey == "" || post.TimeUs == 0:
+				pending.Failed++
+			default:
+				batch = append(batch, post)
+			}
+		}
+
+		if read >= int64(batchSize) {
+			if err := flush(); err != nil {
+				return cp, err
+			}
+		}
+	}
+
+	cp.Done = true
+	if err := flush(); err != nil {
+		cp.Done = false
+		return cp, err
+	}
+	return cp, nil
+}
+
+// lineReader returns one Jetstream event per non-empty line. Lines aren't
+// validated here, so a malformed one still counts as a record.
+func lineReader(r io.Reader) func() (json.RawMessage, error) {
+	br := bufio.NewReader(r)
+	return func() (json.RawMessage, error) {
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) == 0 && err != nil {
+				return nil, err
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			return line, nil
+		}
+	}
+}
+
+// postsReader streams the elements of the "posts" array in a PostRequest
+// document without decoding the whole file.
+func postsReader(r io.Reader) func() (json.RawMessage, error) {
+	dec := json.NewDecoder(r)
+	started := false
+
+	start := func() error {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return fmt.Errorf("posts file must be a JSON object: %v", err)
+		}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("error reading posts file: %w", err)
+			}
+			if key == "posts" {
+				if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+					return fmt.Errorf("posts must be an array: %v", err)
+				}
+				return nil
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("error reading posts file: %w", err)
+			}
+		}
+		return fmt.Errorf("posts file has no posts array")
+	}
+
+	return func() (json.RawMessage, error) {
+		if !started {
+			if err := start(); err != nil {
+				return nil, err
+			}
+			started = true
+		}
+		if !dec.More() {
+			return nil, io.EOF
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("error reading posts file: %w", err)
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,140 @@
+package backfill
+
+import (
+	"errors"
+	"fmt"
+	"gitfeed/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeRepo struct {
+	posts map[string]db.DBPost
+	// failAfter makes ImportPosts fail once this many batches have succeeded.
+	failAfter int
+	batches   int
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{posts: make(map[string]db.DBPost), failAfter: -1}
+}
+
+func (f *fakeRepo) ImportPosts(posts []db.DBPost) (int, error) {
+	if f.batches == f.failAfter {
+		return 0, errors.New("disk full")
+	}
+	f.batches++
+	var inserted int
+	for _, p := range posts {
+		key := p.Did + "/" + p.Collection + "/" + p.Rkey
+		if _, ok := f.posts[key]; !ok {
+			f.posts[key] = p
+			inserted++
+		}
+	}
+	return inserted, nil
+}
+
+func (f *fakeRepo) DeletePost(did, collection, rkey string) error {
+	delete(f.posts, did+"/"+collection+"/"+rkey)
+	return nil
+}
+
+func event(did, rkey, op, collection, text string) string {
+	return fmt.Sprintf(`{"did": %q, "time_us": 1732104000000000, "kind": "commit", "commit": {"operation": %q, "collection": %q, "rkey": %q, "record": {"text": %q, "facets": [{"features": [{"$type": "app.bsky.richtext.facet#link", "uri": "https://github.com/owner/repo"}]}]}}}`,
+		did, op, collection, rkey, text)
+}
+
+const post = "app.bsky.feed.post"
+
+var archive = strings.Join([]string{
+	event("did:plc:a", "1", "create", post, "https://github.com/owner/repo"),
+	event("did:plc:b", "2", "create", post, "no link"),
+	`{"did": "did:plc:broken", "commit": `,
+	"",
+	event("did:plc:a", "1", "create", post, "https://github.com/owner/repo"),
+	event("did:plc:c", "3", "create", "app.bsky.feed.like", ""),
+	event("did:plc:d", "4", "create", post, "https://github.com/owner/repo"),
+	event("did:plc:d", "4", "delete", post, ""),
+	event("did:plc:e", "5", "create", post, "https://github.com/owner/repo"),
+	event("did:plc:e", "5", "delete", "app.bsky.feed.threadgate", ""),
+}, "\n")
+
+func quiet(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+}
+
+func TestImportJetstream(t *testing.T) {
+	quiet(t)
+	repo := newFakeRepo()
+	repo.posts["did:plc:e/app.bsky.feed.post/5"] = db.DBPost{Did: "did:plc:e", Collection: post, Rkey: "5", Text: "stored by ingest"}
+
+	im := &Importer{Repo: repo, BatchSize: 3}
+	cp, err := im.Import(strings.NewReader(archive), Jetstream, Checkpoint{})
+	require.NoError(t, err)
+
+	assert.True(t, cp.Done)
+	assert.EqualValues(t, 9, cp.Records)
+	assert.Equal(t, Stats{Inserted: 2, Skipped: 4, Failed: 1, Deleted: 2}, cp.Stats)
+	assert.Contains(t, repo.posts, "did:plc:a/app.bsky.feed.post/1")
+	assert.NotContains(t, repo.posts, "did:plc:d/app.bsky.feed.post/4", "deleted later in the archive")
+	assert.Equal(t, "stored by ingest", repo.posts["did:plc:e/app.bsky.feed.post/5"].Text, "deleting another record with its rkey leaves it")
+}
+
+func TestImportResumesFromCheckpoint(t *testing.T) {
+	quiet(t)
+	path := filepath.Join(t.TempDir(), "archive.checkpoint")
+	save := func(cp Checkpoint) error { return cp.Save(path) }
+
+	repo := newFakeRepo()
+	repo.failAfter = 1
+	im := &Importer{Repo: repo, BatchSize: 2, Save: save}
+	_, err := im.Import(strings.NewReader(archive), Jetstream, Checkpoint{})
+	require.Error(t, err)
+
+	cp, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.False(t, cp.Done)
+	assert.EqualValues(t, 2, cp.Records)
+
+	repo.failAfter = -1
+	cp, err = im.Import(strings.NewReader(archive), Jetstream, cp)
+	require.NoError(t, err)
+
+	uninterrupted, err := (&Importer{Repo: newFakeRepo(), BatchSize: 2}).Import(strings.NewReader(archive), Jetstream, Checkpoint{})
+	require.NoError(t, err)
+	assert.Equal(t, uninterrupted.Records, cp.Records)
+	assert.Equal(t, uninterrupted.Stats, cp.Stats)
+
+	saved, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.True(t, saved.Done)
+}
+
+func TestImportPostsFile(t *testing.T) {
+	quiet(t)
+	body := `{"note": "exported", "posts": [` +
+		event("did:plc:a", "1", "create", post, "https://github.com/owner/repo") + `,` +
+		event("did:plc:b", "2", "create", post, "nothing") + `]}`
+
+	repo := newFakeRepo()
+	cp, err := (&Importer{Repo: repo}).Import(strings.NewReader(body), Posts, Checkpoint{})
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Inserted: 1, Skipped: 1}, cp.Stats)
+
+	_, err = (&Importer{Repo: repo}).Import(strings.NewReader(`{"posts": {}}`), Posts, Checkpoint{})
+	assert.Error(t, err)
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, Posts, DetectFormat("dump.json"))
+	assert.Equal(t, Posts, DetectFormat("dump.json.gz"))
+	assert.Equal(t, Jetstream, DetectFormat("jetstream-2024-11-20.jsonl.zst"))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"flag"
+	"fmt"
+	"gitfeed/db"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupPrefix = "gitfeed-"
+
+func openExisting(path string) *db.Pool {
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalf("Database %s not found: %v", path, err)
+	}
+	pool, err := db.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	return pool
+}
+
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("db backup", flag.ExitOnError)
+	dbPath := fs.String("db", "gitfeed.db", "database to back up")
+	dir := fs.String("dir", "backups", "directory to write backups to")
+	compress := fs.Bool("gzip", false, "gzip the snapshot")
+	keep := fs.Int("keep", 0, "number of backups to keep in -dir, 0 keeps all")
+	fs.Parse(args)
+
+	pool := openExisting(*dbPath)
+	defer pool.Close()
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatalf("Failed to create backup directory: %v", err)
+	}
+
+	dest := filepath.Join(*dir, backupPrefix+time.Now().UTC().Format("20060102T150405Z")+".db")
+	snapshot := dest
+	if *compress {
+		snapshot = dest + ".tmp"
+	}
+	if err := db.Backup(pool.Writer, snapshot); err != nil {
+		log.Fatalf("Failed to back up: %v", err)
+	}
+
+	if *compress {
+		err := gzipFile(snapshot, dest+".gz")
+		os.Remove(snapshot)
+		if err != nil {
+			log.Fatalf("Failed to compress backup: %v", err)
+		}
+		dest += ".gz"
+	}
+	fmt.Println("Wrote backup:", dest)
+
+	if *keep > 0 {
+		if err := rotateBackups(*dir, *keep); err != nil {
+			log.Fatalf("Failed to rotate backups: %v", err)
+		}
+	}
+}
+
+func gzipFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// rotateBackups removes all but the newest keep backups. Backup names sort by
+// the UTC timestamp in them.
+func rotateBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, backupPrefix) && (strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db.gz")) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i])); err != nil {
+			return err
+		}
+		fmt.Println("Removed old backup:", backups[i])
+	}
+	return nil
+}
+
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("db restore", flag.ExitOnError)
+	dbPath := fs.String("db", "gitfeed.db", "database to replace")
+	from := fs.String("from", "", "backup to restore, optionally gzipped")
+	fs.Parse(args)
+
+	if *from == "" {
+		log.Fatalf("-from is required")
+	}
+	fmt.Println("Stop ingest and serve before restoring; they hold the database open.")
+
+	staged := *dbPath + ".restore"
+	if err := stageBackup(*from, staged); err != nil {
+		os.Remove(staged)
+		log.Fatalf("Failed to read backup: %v", err)
+	}
+
+	version, err := validateBackup(staged)
+	if err != nil {
+		os.Remove(staged)
+		log.Fatalf("Refusing to restore %s: %v", *from, err)
+	}
+
+	// Keep the database being replaced, along with its WAL, next to the restored one.
+	if _, err := os.Stat(*dbPath); err == nil {
+		previous := *dbPath + ".pre-restore-" + time.Now().UTC().Format("20060102T150405Z")
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(*dbPath+suffix, previous+suffix); err != nil && !os.IsNotExist(err) {
+				log.Fatalf("Failed to move aside %s: %v", *dbPath+suffix, err)
+			}
+		}
+		fmt.Println("Moved current database to:", previous)
+	}
+
+	if err := os.Rename(staged, *dbPath); err != nil {
+		log.Fatalf("Failed to restore: %v", err)
+	}
+	fmt.Printf("Restored %s from %s at schema version %d\n", *dbPath, *from, version)
+	if version < db.SchemaVersion() {
+		fmt.Printf("It will be migrated to version %d when ingest or serve next starts.\n", db.SchemaVersion())
+	}
+}
+
+func stageBackup(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if strings.HasSuffix(src, ".gz") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// validateBackup checks that a staged backup is an intact gitfeed database this
+// build knows how to migrate, and returns its schema version.
+func validateBackup(path string) (int, error) {
+	backup, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&immutable=1")
+	if err != nil {
+		return 0, err
+	}
+	defer backup.Close()
+
+	report, err := db.CheckIntegrity(backup)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case report.SchemaVersion == 0:
+		return 0, fmt.Errorf("not a gitfeed database")
+	case report.SchemaVersion > db.SchemaVersion():
+		return 0, fmt.Errorf("backup is at schema version %d but this build only knows up to %d",
+			report.SchemaVersion, db.SchemaVersion())
+	case len(report.Problems) > 0:
+		return 0, fmt.Errorf("backup failed its integrity check:\n%s", report)
+	}
+	return report.SchemaVersion, nil
+}
+
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("db check", flag.ExitOnError)
+	dbPath := fs.String("db", "gitfeed.db", "database to check")
+	fs.Parse(args)
+
+	pool := openExisting(*dbPath)
+	defer pool.Close()
+
+	report, err := db.CheckIntegrity(pool.Reader)
+	if err != nil {
+		log.Fatalf("Failed to check database: %v", err)
+	}
+	fmt.Print(report)
+	if !report.OK() {
+		pool.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/export"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "gitfeed.db", "database to export from")
+	datasetName := fs.String("dataset", "posts", "posts, links or repositories")
+	formatName := fs.String("format", "ndjson", "ndjson, csv or parquet")
+	sinceFlag := fs.String("since", "", "start of the range, RFC 3339 or YYYY-MM-DD (default: the retention window)")
+	untilFlag := fs.String("until", "", "end of the range, exclusive (default: now)")
+	out := fs.String("o", "", "file to write, - for stdout (default: a name built from the dataset and range)")
+	fs.Parse(args)
+
+	dataset, err := export.ParseDataset(*datasetName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	until := time.Now().UTC()
+	if *untilFlag != "" {
+		if until, err = export.ParseTime(*untilFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	since := until.Add(-db.Retention)
+	if *sinceFlag != "" {
+		if since, err = export.ParseTime(*sinceFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !since.Before(until) {
+		log.Fatal("-since must be before -until")
+	}
+
+	pool := openExisting(*dbPath)
+	defer pool.Close()
+	pr, err := db.NewPostRepository(pool)
+	if err != nil {
+		log.Fatalf("Failed to create post repository: %v", err)
+	}
+
+	path := *out
+	if path == "" {
+		path = export.Filename(dataset, format, since, until)
+	}
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", path, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	n, err := export.Export(bw, pr, dataset, format, since, until)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		log.Fatalf("Failed to export %s: %v", dataset, err)
+	}
+	if path != "-" {
+		fmt.Printf("Wrote %d %s rows to %s\n", n, dataset, path)
+	}
+}
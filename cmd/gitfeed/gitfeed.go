@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: gitfeed <command> [flags]
+
+commands:
+  db backup    write a consistent snapshot of the live database
+  db restore   replace the database with a validated backup
+  db check     run an integrity check and look for orphaned rows
+  export       write posts, links or repository aggregates for a time range
+  import       load Jetstream archives or posts files into the database
+
+Run a command with -h for its flags.
+`
+
+func main() {
+	var run func(args []string)
+	var args []string
+
+	switch {
+	case len(os.Args) >= 3 && os.Args[1] == "db":
+		switch os.Args[2] {
+		case "backup":
+			run = runBackup
+		case "restore":
+			run = runRestore
+		case "check":
+			run = runCheck
+		}
+		args = os.Args[3:]
+	case len(os.Args) >= 2 && os.Args[1] == "export":
+		run = runExport
+		args = os.Args[2:]
+	case len(os.Args) >= 2 && os.Args[1] == "import":
+		run = runImport
+		args = os.Args[2:]
+	}
+
+	if run == nil {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run(args)
+}
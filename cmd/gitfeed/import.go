@@ -0,0 +1,130 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"gitfeed/backfill"
+	"gitfeed/db"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "gitfeed.db", "database to import into")
+	formatName := fs.String("format", "", "jetstream or posts (default: .json files are posts, the rest jetstream)")
+	batch := fs.Int("batch", backfill.DefaultBatchSize, "records committed per transaction")
+	restart := fs.Bool("restart", false, "ignore existing checkpoints and start from the beginning")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gitfeed import [flags] FILE...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var format backfill.Format
+	if *formatName != "" {
+		var err error
+		if format, err = backfill.ParseFormat(*formatName); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	database, err := db.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database.Writer); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	pr, err := db.NewPostRepository(database)
+	if err != nil {
+		log.Fatalf("Failed to create post repository: %v", err)
+	}
+
+	var total backfill.Stats
+	for _, path := range fs.Args() {
+		f := format
+		if f == "" {
+			f = backfill.DetectFormat(path)
+		}
+		stats, err := importFile(pr, path, f, *batch, *restart)
+		total.Inserted += stats.Inserted
+		total.Skipped += stats.Skipped
+		total.Failed += stats.Failed
+		total.Deleted += stats.Deleted
+		if err != nil {
+			log.Fatalf("Failed to import %s: %v (rerun to resume from the last checkpoint)", path, err)
+		}
+		fmt.Printf("%s: %s\n", path, stats)
+	}
+	if fs.NArg() > 1 {
+		fmt.Printf("total: %s\n", total)
+	}
+}
+
+// importFile imports one source, keeping its checkpoint next to it.
+func importFile(pr *db.PostRepository, path string, format backfill.Format, batch int, restart bool) (backfill.Stats, error) {
+	checkpointPath := path + ".checkpoint"
+
+	cp := backfill.Checkpoint{Source: path}
+	if !restart {
+		var err error
+		if cp, err = backfill.LoadCheckpoint(checkpointPath); err != nil {
+			return cp.Stats, err
+		}
+		cp.Source = path
+		if cp.Done {
+			fmt.Printf("%s: already imported, pass -restart to import it again\n", path)
+			return cp.Stats, nil
+		}
+		if cp.Records > 0 {
+			fmt.Printf("%s: resuming after record %d\n", path, cp.Records)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return cp.Stats, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return cp.Stats, err
+		}
+		defer zr.Close()
+		r = zr
+	case strings.HasSuffix(path, ".zst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return cp.Stats, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	importer := &backfill.Importer{
+		Repo:      pr,
+		BatchSize: batch,
+		Save: func(cp backfill.Checkpoint) error {
+			log.Printf("%s: %d records, %s", path, cp.Records, cp.Stats)
+			return cp.Save(checkpointPath)
+		},
+	}
+	cp, err = importer.Import(r, format, cp)
+	return cp.Stats, err
+}
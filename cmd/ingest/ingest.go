@@ -2,18 +2,20 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"gitfeed/config"
 	"gitfeed/db"
-	"gitfeed/handlers"
+	"gitfeed/enrich"
+	"gitfeed/github"
+	"gitfeed/jetstream"
+	"gitfeed/trending"
 	"os"
 	"os/signal"
 	"sync"
 	"time"
 
 	"log"
-	"strings"
 
 	"github.com/gorilla/websocket"
 )
@@ -45,6 +47,9 @@ type WebSocketManager struct {
 	errorHandler   func(error)
 
 	postRepo *db.PostRepository
+	// tracked holds the time_us of recent matched posts keyed by did/rkey,
+	// so likes, reposts and replies to them can be counted as engagement.
+	tracked map[string]int64
 }
 
 func NewWebSocketManager(url string, postRepo *db.PostRepository) *WebSocketManager {
@@ -55,6 +60,7 @@ func NewWebSocketManager(url string, postRepo *db.PostRepository) *WebSocketMana
 		pingPeriod:     (pongWait * 9) / 10,
 		done:           make(chan struct{}),
 		postRepo:       postRepo,
+		tracked:        make(map[string]int64),
 		errorHandler:   func(err error) { log.Printf("Error: %v", err) },
 	}
 
@@ -83,50 +89,6 @@ func (w *WebSocketManager) Connect(ctx context.Context) {
 	}
 }
 
-// GitHub matches
-func FindMatches(text, pattern string) bool {
-
-	return strings.Contains(text, pattern)
-
-}
-
-func ProcessPost(post db.ATPost) db.DBPost {
-	dbpost := db.DBPost{}
-
-	if found := FindMatches(post.Commit.Record.Text, "github.com"); found {
-		log.Printf("Post: %v", post)
-
-		var langs sql.Null[string]
-		if len(post.Commit.Record.Langs) > 0 {
-			langs.Valid = true
-			langs.V = post.Commit.Record.Langs[0]
-		}
-
-		uri := handlers.ExtractUri(post)
-		if uri != "" && FindMatches(uri, "github.com") {
-			dbPost := db.DBPost{
-				Did:        post.Did,
-				TimeUs:     post.TimeUs,
-				Kind:       post.Kind,
-				Operation:  post.Commit.Operation,
-				Collection: post.Commit.Collection,
-				Rkey:       post.Commit.Rkey,
-				Cid:        post.Commit.Cid,
-				Type:       post.Commit.Record.Type,
-				CreatedAt:  post.Commit.Record.CreatedAt,
-				Langs:      langs,
-				Text:       post.Commit.Record.Text,
-				URI:        uri,
-			}
-			dbpost = dbPost
-
-		}
-
-	}
-
-	return dbpost
-}
-
 func (w *WebSocketManager) readPump(ctx context.Context) {
 
 	w.Connect(ctx)
@@ -146,19 +108,74 @@ func (w *WebSocketManager) readPump(ctx context.Context) {
 			if counter%100 == 0 {
 				log.Printf("Read %d posts\n", counter)
 			}
+			if counter%10000 == 0 {
+				w.pruneTracked()
+			}
+
+			switch post.Commit.Collection {
+			case "app.bsky.feed.like":
+				if post.Commit.Operation == "create" {
+					w.countEngagement(post.Commit.Record.Subject.URI, db.Like)
+				}
+				continue
+			case "app.bsky.feed.repost":
+				if post.Commit.Operation == "create" {
+					w.countEngagement(post.Commit.Record.Subject.URI, db.Repost)
+				}
+				continue
+			}
+
+			if post.Commit.Operation == "delete" {
+				if err := w.postRepo.DeletePost(post.Did, post.Commit.Collection, post.Commit.Rkey); err != nil {
+					w.errorHandler(fmt.Errorf("failed to delete post: %v", err))
+				}
+				delete(w.tracked, post.Did+"/"+post.Commit.Rkey)
+				continue
+			}
+			if post.Commit.Operation == "create" {
+				w.countEngagement(post.Commit.Record.Reply.Parent.URI, db.Reply)
+			}
 
 			// Process the post
-			dbPost := ProcessPost(post)
+			dbPost := jetstream.ProcessPost(post)
+			if dbPost.URI == "" {
+				continue
+			}
 
 			if err := w.postRepo.WritePost(dbPost); err != nil {
 				w.errorHandler(fmt.Errorf("failed to write post: %v", err))
 				continue
 			}
+			w.tracked[dbPost.Did+"/"+dbPost.Rkey] = dbPost.TimeUs
 			log.Printf("Wrote Post %v", dbPost.Did)
 		}
 	}
 }
 
+// countEngagement records a like, repost or reply if it points at a tracked post.
+// Unlikes and unreposts arrive without a subject, so engagement only grows.
+func (w *WebSocketManager) countEngagement(uri string, e db.Engagement) {
+	did, collection, rkey, ok := db.ParseATURI(uri)
+	if !ok || collection != "app.bsky.feed.post" {
+		return
+	}
+	if _, ok := w.tracked[did+"/"+rkey]; !ok {
+		return
+	}
+	if err := w.postRepo.AddEngagement(did, rkey, e); err != nil {
+		w.errorHandler(fmt.Errorf("failed to record engagement: %v", err))
+	}
+}
+
+func (w *WebSocketManager) pruneTracked() {
+	cutoff := time.Now().Add(-trending.MaxAge).UnixMicro()
+	for key, timeUs := range w.tracked {
+		if timeUs < cutoff {
+			delete(w.tracked, key)
+		}
+	}
+}
+
 func cleanUpDb(pr *db.PostRepository) {
 	for {
 		timer := time.After(2 * time.Hour)
@@ -178,46 +195,46 @@ func main() {
 
 	defer database.Close()
 
-	pr := db.NewPostRepository(database)
+	if err := db.Migrate(database.Writer); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	pr, err := db.NewPostRepository(database)
+	if err != nil {
+		log.Fatalf("Failed to create post repository: %v", err)
+	}
 
 	go cleanUpDb(pr)
 
-	postTableColumns := map[string]string{
-		"id":                "INTEGER PRIMARY KEY AUTOINCREMENT",
-		"did":               "TEXT NOT NULL",
-		"time_us":           "INTEGER NOT NULL",
-		"kind":              "TEXT NOT NULL",
-		"commit_rev":        "TEXT NOT NULL",
-		"commit_operation":  "TEXT NOT NULL",
-		"commit_collection": "TEXT NOT NULL",
-		"commit_rkey":       "TEXT NOT NULL",
-		"commit_cid":        "TEXT NOT NULL",
-		"record_type":       "TEXT NOT NULL",
-		"record_created_at": "DATETIME NOT NULL",
-		"record_langs":      "TEXT",
-		"record_text":       "TEXT",
-		"record_uri":        "TEXT",
-	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
-	// Create the table if it doesn't exist
-	err = pr.CreateTableIfNotExists("posts", postTableColumns)
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		log.Fatalf("Failed to load config: %v", err)
 	}
+	fmt.Println("Starting repository enrichment...")
+	worker := enrich.NewWorker(pr, github.NewClient(cfg.GitHubAPIURL, cfg.GitHubToken))
+	worker.Window = time.Duration(cfg.StarTrackingDays) * 24 * time.Hour
+	go worker.Run(ctx)
 
 	// start collection
 	fmt.Println("Starting feed...")
 
 	wsManager := NewWebSocketManager(
-		"wss://jetstream2.us-west.bsky.network/subscribe?wantedCollections=app.bsky.feed.post",
+		"wss://jetstream2.us-west.bsky.network/subscribe?wantedCollections=app.bsky.feed.post"+
+			"&wantedCollections=app.bsky.feed.like&wantedCollections=app.bsky.feed.repost",
 		pr,
 	)
 	wsManager.reconnectDelay = 5 * time.Second
 
-	log.Printf("connecting to %s\n", wsManager.url)
+	tracked, err := pr.GetPostKeys(time.Now().Add(-trending.MaxAge).UnixMicro())
+	if err != nil {
+		log.Fatalf("Failed to load recent posts: %v", err)
+	}
+	wsManager.tracked = tracked
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
+	log.Printf("connecting to %s\n", wsManager.url)
 
 	wsManager.readPump(ctx)
 }
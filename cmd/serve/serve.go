@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"gitfeed/config"
 	"gitfeed/db"
+	"gitfeed/feedgen"
+	"gitfeed/github"
 	"gitfeed/routes"
+	"gitfeed/stream"
+	"gitfeed/trending"
 	"log"
 	"net/http"
+	"time"
 
 	"gitfeed/handlers"
 )
 
+// maxChangeFeedBackoff caps the wait before restarting a failed change feed.
+const maxChangeFeedBackoff = time.Minute
+
 func main() {
 
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	fmt.Println("Starting DB...")
 
 	database, err := db.InitDB()
@@ -19,13 +34,79 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	if err := db.Migrate(database.Writer); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
 	// Start post service
 	fmt.Println("Connect to post service...")
-	pr := db.NewPostRepository(database)
+	pr, err := db.NewPostRepository(database)
+	if err != nil {
+		log.Fatalf("Failed to create post repository: %v", err)
+	}
+	githubCache := github.NewCache(github.NewClient(cfg.GitHubAPIURL, cfg.GitHubToken), pr, github.DefaultSize)
 	postService := &handlers.PostService{PostRepository: pr}
+	if cfg.GitHubConfigured() {
+		postService.GitHub = githubCache
+	}
+	trendingService := &handlers.TrendingService{Engine: trending.NewEngine(pr)}
+
+	hub, err := stream.NewHub(pr)
+	if err != nil {
+		log.Fatalf("Failed to create stream hub: %v", err)
+	}
+	streamService := &handlers.StreamService{Hub: hub, Repository: pr}
+
+	// Rescore trending and stream new posts as soon as ingest commits.
+	feed := db.NewChangeFeed(database)
+	go func() {
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := feed.Run(context.Background())
+			if time.Since(started) > maxChangeFeedBackoff {
+				backoff = time.Second
+			}
+			log.Printf("Change feed stopped, restarting in %s: %v", backoff, err)
+			time.Sleep(backoff)
+			backoff = min(2*backoff, maxChangeFeedBackoff)
+		}
+	}()
+	go func() {
+		err := feed.Follow(context.Background(), func(batch []db.Change) {
+			trendingService.Engine.Invalidate()
+			if err := hub.Publish(batch); err != nil {
+				log.Printf("Error publishing changes: %v", err)
+			}
+		})
+		if err != nil {
+			log.Fatalf("Failed to follow changes: %v", err)
+		}
+	}()
+
+	exportService := &handlers.ExportService{Repository: pr}
+	statsService := &handlers.StatsService{Repository: pr}
+	syndicationService := &handlers.SyndicationService{Repository: pr, Engine: trendingService.Engine}
+	githubService := &handlers.GitHubService{Cache: githubCache}
+	repositoryService := &handlers.RepositoryService{Repository: pr, Mentions: pr}
+
+	var feedService *handlers.FeedService
+	if cfg.FeedHostname != "" {
+		fmt.Println("Serving feed generator as", cfg.FeedHostname)
+		generator := feedgen.Default(cfg.FeedPublisherDID, pr, trendingService.Engine, cfg.FeedLangs)
+		generator.Seen = pr
+		feedService = &handlers.FeedService{
+			Generator: generator,
+			Hostname:  cfg.FeedHostname,
+			Verifier: &feedgen.Verifier{
+				Resolver:   feedgen.NewDirectoryResolver(),
+				ServiceDID: "did:web:" + cfg.FeedHostname,
+			},
+		}
+	}
 
 	// Create web routes
-	routes.CreateRoutes(postService)
+	routes.CreateRoutes(postService, trendingService, exportService, statsService, streamService, syndicationService, githubService, repositoryService, feedService)
 
 	log.Printf("Starting gitfeed server...")
 	log.Fatal(http.ListenAndServe(":80", nil))
@@ -0,0 +1,78 @@
+// Package config reads serve's settings from the environment, loading a .env
+// file from the working directory first when there is one.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gitfeed/langdetect"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// DefaultGitHubAPIURL is the public GitHub API, used unless GITHUB_API_URL is set.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+type Config struct {
+	// FeedHostname is the public hostname the feed generator is reached at,
+	// which also names its did:web. The feed generator is off without it.
+	FeedHostname string
+	// FeedPublisherDID is the account the feed records are published under.
+	FeedPublisherDID string
+	// FeedLangs lists the languages that get their own feed.
+	FeedLangs []string
+
+	// GitHubToken authenticates GitHub API calls, raising the rate limit from
+	// 60 to 5000 requests an hour. Lookups are anonymous without it.
+	GitHubToken string
+	// GitHubAPIURL is the GitHub API root, for GitHub Enterprise or a local stand-in.
+	GitHubAPIURL string
+	// StarTrackingDays is how many days after its last mention a repository
+	// keeps getting daily star and fork snapshots.
+	StarTrackingDays int
+}
+
+// GitHubConfigured reports whether GitHub was given a token or another API
+// root. Anonymous lookups are too few to hydrate pages of posts.
+func (c Config) GitHubConfigured() bool {
+	return c.GitHubToken != "" || c.GitHubAPIURL != DefaultGitHubAPIURL
+}
+
+// Load reads FEEDGEN_HOSTNAME, FEEDGEN_PUBLISHER_DID, FEEDGEN_LANGS,
+// GITHUB_TOKEN, GITHUB_API_URL and STAR_TRACKING_DAYS.
+// Variables already set win over the .env file.
+func Load() (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("error loading .env: %w", err)
+	}
+
+	c := Config{
+		FeedHostname:     os.Getenv("FEEDGEN_HOSTNAME"),
+		FeedPublisherDID: os.Getenv("FEEDGEN_PUBLISHER_DID"),
+		FeedLangs:        []string{"en"},
+		GitHubToken:      os.Getenv("GITHUB_TOKEN"),
+		GitHubAPIURL:     DefaultGitHubAPIURL,
+		StarTrackingDays: 30,
+	}
+	if url := os.Getenv("GITHUB_API_URL"); url != "" {
+		c.GitHubAPIURL = strings.TrimSuffix(url, "/")
+	}
+	if days := os.Getenv("STAR_TRACKING_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return Config{}, fmt.Errorf("STAR_TRACKING_DAYS must be a positive number of days, got %q", days)
+		}
+		c.StarTrackingDays = n
+	}
+	if langs, ok := os.LookupEnv("FEEDGEN_LANGS"); ok {
+		c.FeedLangs = langdetect.NormalizeAll(strings.Split(langs, ","))
+	}
+	if c.FeedHostname != "" && !strings.HasPrefix(c.FeedPublisherDID, "did:") {
+		return Config{}, fmt.Errorf("FEEDGEN_PUBLISHER_DID must be a DID when FEEDGEN_HOSTNAME is set, got %q", c.FeedPublisherDID)
+	}
+	return c, nil
+}
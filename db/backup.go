@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SchemaVersion is the schema version this build migrates databases to.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+func ReadSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Backup writes a consistent snapshot of the database to dest, which must not
+// exist yet. VACUUM INTO reads inside a single transaction, so ingest can keep
+// writing while the snapshot is taken.
+func Backup(db *sql.DB, dest string) error {
+	if _, err := db.Exec(`VACUUM INTO $1`, dest); err != nil {
+		return fmt.Errorf("error backing up to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// orphanChecks count derived rows whose source rows are gone. Each query must
+// return a single count.
+var orphanChecks = []struct {
+	name  string
+	query string
+}{
+	{"post_repositories without a post",
+		`SELECT COUNT(*) FROM post_repositories WHERE post_id NOT IN (SELECT id FROM posts)`},
+	{"post_repositories without a repository",
+		`SELECT COUNT(*) FROM post_repositories WHERE repository_id NOT IN (SELECT id FROM repositories)`},
+	{"post_engagement without a post",
+		`SELECT COUNT(*) FROM post_engagement WHERE post_id NOT IN (SELECT id FROM posts)`},
+	{"post_langs without a post",
+		`SELECT COUNT(*) FROM post_langs WHERE post_id NOT IN (SELECT id FROM posts)`},
+	{"rollup_repositories without a repository",
+		`SELECT COUNT(*) FROM rollup_repositories WHERE repository_id NOT IN (SELECT id FROM repositories)`},
+	{"repositories with stale mention counts",
+		`SELECT COUNT(*) FROM repositories r WHERE r.mention_count !=
+			(SELECT COUNT(*) FROM post_repositories pr WHERE pr.repository_id = r.id)`},
+}
+
+type IntegrityReport struct {
+	SchemaVersion int
+	// Problems holds every line PRAGMA integrity_check reported other than "ok".
+	Problems []string
+	Orphans  map[string]int64
+}
+
+func (r IntegrityReport) OK() bool {
+	if len(r.Problems) > 0 {
+		return false
+	}
+	for _, n := range r.Orphans {
+		if n > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r IntegrityReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "schema version: %d (this build: %d)\n", r.SchemaVersion, SchemaVersion())
+	if len(r.Problems) == 0 {
+		fmt.Fprintf(&b, "integrity check: ok\n")
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(&b, "integrity check: %s\n", p)
+	}
+	for _, c := range orphanChecks {
+		if n, ok := r.Orphans[c.name]; ok {
+			fmt.Fprintf(&b, "%s: %d\n", c.name, n)
+		}
+	}
+	return b.String()
+}
+
+// CheckIntegrity runs PRAGMA integrity_check and counts orphaned derived rows.
+// Orphan checks for tables a database hasn't been migrated to yet are skipped.
+func CheckIntegrity(db *sql.DB) (IntegrityReport, error) {
+	report := IntegrityReport{Orphans: make(map[string]int64)}
+
+	var err error
+	if report.SchemaVersion, err = ReadSchemaVersion(db); err != nil {
+		return report, err
+	}
+
+	rows, err := db.Query(`PRAGMA integrity_check;`)
+	if err != nil {
+		return report, fmt.Errorf("error running integrity check: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return report, fmt.Errorf("error reading integrity check: %w", err)
+		}
+		if line != "ok" {
+			report.Problems = append(report.Problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error reading integrity check: %w", err)
+	}
+
+	for _, c := range orphanChecks {
+		var n int64
+		if err := db.QueryRow(c.query).Scan(&n); err != nil {
+			if strings.Contains(err.Error(), "no such table") {
+				continue
+			}
+			return report, fmt.Errorf("error checking %s: %w", c.name, err)
+		}
+		report.Orphans[c.name] = n
+	}
+	return report, nil
+}
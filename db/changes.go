@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ChangeOp is what happened to the posts a Change describes.
+type ChangeOp string
+
+const (
+	// PostWritten is a new or edited post.
+	PostWritten ChangeOp = "write"
+	// PostDeleted is a post removed by its author.
+	PostDeleted ChangeOp = "delete"
+	// PostsPruned is retention removing every post older than TimeUs.
+	PostsPruned ChangeOp = "prune"
+)
+
+// Change is one committed write, numbered in commit order across every
+// process sharing the database.
+type Change struct {
+	Seq       int64    `json:"seq"`
+	Op        ChangeOp `json:"op"`
+	Did       string   `json:"did,omitempty"`
+	Rkey      string   `json:"rkey,omitempty"`
+	TimeUs    int64    `json:"time_us"`
+	ChangedAt int64    `json:"changed_at"`
+}
+
+// ChangeRetention is how long the change log is kept for subscribers catching up.
+const ChangeRetention = 24 * time.Hour
+
+func createChanges(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS changes (
+            seq INTEGER PRIMARY KEY AUTOINCREMENT,
+            op TEXT NOT NULL,
+            did TEXT NOT NULL DEFAULT '',
+            rkey TEXT NOT NULL DEFAULT '',
+            time_us INTEGER NOT NULL,
+            changed_at INTEGER NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS changes_changed_at ON changes(changed_at);`)
+	return err
+}
+
+// logChange appends a change to the log inside the transaction making it.
+func logChange(tx *sql.Tx, op ChangeOp, did, rkey string, timeUs int64) error {
+	_, err := tx.Exec(`INSERT INTO changes (op, did, rkey, time_us, changed_at) VALUES ($1, $2, $3, $4, $5)`,
+		op, did, rkey, timeUs, time.Now().UnixMicro())
+	if err != nil {
+		return fmt.Errorf("could not log change: %w", err)
+	}
+	return nil
+}
+
+// pruneChanges drops log entries older than ChangeRetention.
+func pruneChanges(tx *sql.Tx) error {
+	cutoff := time.Now().Add(-ChangeRetention).UnixMicro()
+	if _, err := tx.Exec(`DELETE FROM changes WHERE changed_at < $1`, cutoff); err != nil {
+		return fmt.Errorf("could not prune changes: %w", err)
+	}
+	return nil
+}
+
+// GetChanges returns up to limit changes after seq, oldest first.
+func (pr *PostRepository) GetChanges(after int64, limit int) ([]Change, error) {
+	return getChanges(context.Background(), pr.reader, after, limit)
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func getChanges(ctx context.Context, q querier, after int64, limit int) ([]Change, error) {
+	rows, err := q.QueryContext(ctx, `SELECT seq, op, did, rkey, time_us, changed_at
+	FROM changes WHERE seq > $1 ORDER BY seq LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []Change
+	for rows.Next() {
+		var c Change
+		if err := rows.Scan(&c.Seq, &c.Op, &c.Did, &c.Rkey, &c.TimeUs, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("error scanning change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating changes: %w", err)
+	}
+	return changes, nil
+}
+
+const (
+	changeBatch     = 1000
+	subscriberQueue = 16
+)
+
+// ChangeFeed delivers changes committed by any process, including ingest
+// running separately, to subscribers in this one. It polls PRAGMA
+// data_version, which only touches the WAL index, and reads the change log
+// only after another connection has committed.
+type ChangeFeed struct {
+	reader *sql.DB
+	// Interval is how often data_version is checked.
+	Interval time.Duration
+
+	mu   sync.Mutex
+	subs map[chan []Change]struct{}
+}
+
+func NewChangeFeed(pool *Pool) *ChangeFeed {
+	return &ChangeFeed{
+		reader:   pool.Reader,
+		Interval: 250 * time.Millisecond,
+		subs:     make(map[chan []Change]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving each batch of changes committed after
+// the call, and a function to unsubscribe. A subscriber that falls
+// subscriberQueue batches behind has its channel closed, and should
+// resubscribe and catch up with GetChanges, as Follow does.
+func (f *ChangeFeed) Subscribe() (<-chan []Change, func()) {
+	ch := make(chan []Change, subscriberQueue)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (f *ChangeFeed) publish(changes []Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- changes:
+		default:
+			log.Printf("Change subscriber fell behind, dropping it")
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Run polls for changes until ctx is done, then closes every subscription.
+func (f *ChangeFeed) Run(ctx context.Context) error {
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for ch := range f.subs {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}()
+
+	// data_version is per connection, so every check must use the same one.
+	conn, err := f.reader.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error reserving change feed connection: %w", err)
+	}
+	defer conn.Close()
+
+	var last int64
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM changes`).Scan(&last); err != nil {
+		return fmt.Errorf("error reading change log: %w", err)
+	}
+	var version int64
+	if err := conn.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&version); err != nil {
+		return fmt.Errorf("error reading data version: %w", err)
+	}
+
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		var current int64
+		if err := conn.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&current); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error reading data version: %w", err)
+		}
+		if current == version {
+			continue
+		}
+		version = current
+
+		for {
+			changes, err := getChanges(ctx, conn, last, changeBatch)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			if len(changes) == 0 {
+				break
+			}
+			last = changes[len(changes)-1].Seq
+			f.publish(changes)
+			if len(changes) < changeBatch {
+				break
+			}
+		}
+	}
+}
+
+// Follow calls handle with every change committed after the call, in order,
+// until ctx is done. When its subscription is dropped, or Run restarts, it
+// catches up from the change log after the last change it handled, so
+// nothing is skipped.
+func (f *ChangeFeed) Follow(ctx context.Context, handle func([]Change)) error {
+	var last int64
+	if err := f.reader.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM changes`).Scan(&last); err != nil {
+		return fmt.Errorf("error reading change log: %w", err)
+	}
+
+	deliver := func(changes []Change) {
+		// Catching up overlaps whatever the new subscription already holds.
+		for len(changes) > 0 && changes[0].Seq <= last {
+			changes = changes[1:]
+		}
+		if len(changes) > 0 {
+			last = changes[len(changes)-1].Seq
+			handle(changes)
+		}
+	}
+
+	for ctx.Err() == nil {
+		// Subscribing before catching up leaves no gap between the two.
+		changes, unsubscribe := f.Subscribe()
+		if err := f.catchUp(ctx, last, deliver); err != nil {
+			// Reading on would leave a gap, so start over once the log is readable.
+			if ctx.Err() == nil {
+				log.Printf("Error catching up on changes: %v", err)
+			}
+		} else {
+			func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case batch, ok := <-changes:
+						if !ok {
+							return
+						}
+						// A restarted Run publishes from the end of the log,
+						// skipping what was committed while it was down.
+						if len(batch) > 0 && batch[0].Seq > last+1 {
+							if err := f.catchUp(ctx, last, deliver); err != nil {
+								log.Printf("Error catching up on changes: %v", err)
+								return
+							}
+						}
+						deliver(batch)
+					}
+				}
+			}()
+		}
+		unsubscribe()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(f.Interval):
+		}
+	}
+	return nil
+}
+
+func (f *ChangeFeed) catchUp(ctx context.Context, after int64, deliver func([]Change)) error {
+	for {
+		missed, err := getChanges(ctx, f.reader, after, changeBatch)
+		if err != nil {
+			return err
+		}
+		deliver(missed)
+		if len(missed) < changeBatch {
+			return nil
+		}
+		after = missed[len(missed)-1].Seq
+	}
+}
@@ -0,0 +1,43 @@
+package db_test
+
+import (
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	_ db.PostRepo = (*db.PostRepository)(nil)
+	_ db.PostRepo = (*db.MemoryPostRepository)(nil)
+)
+
+func TestSQLitePostRepository(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	dbtest.Run(t, func(t *testing.T) db.PostRepo {
+		pool, err := db.Open(filepath.Join(t.TempDir(), "gitfeed.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pool.Close() })
+		if err := db.Migrate(pool.Writer); err != nil {
+			t.Fatal(err)
+		}
+		pr, err := db.NewPostRepository(pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pr
+	})
+}
+
+func TestMemoryPostRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) db.PostRepo {
+		return db.NewMemoryPostRepository()
+	})
+}
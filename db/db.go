@@ -5,52 +5,86 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"runtime"
 	"strings"
-	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+// ErrNotFound is returned, wrapped, by every PostRepo lookup that matches nothing.
+var ErrNotFound = errors.New("not found")
+
+// PostCollection is the collection Bluesky stores posts in.
+const PostCollection = "app.bsky.feed.post"
+
+// Retention is how long matched posts are kept before DeletePosts prunes them.
+const Retention = 30 * 24 * time.Hour
 
 type ATPost struct {
-	Did    string `json:"did"`
-	TimeUs int64  `json:"time_us"`
-	Type   string `json:"type"`
-	Kind   string `json:"kind"`
-	Commit struct {
-		Rev        string `json:"rev"`
-		Type       string `json:"type"`
-		Operation  string `json:"operation"`
-		Collection string `json:"collection"`
-		Rkey       string `json:"rkey"`
-		Record     struct {
-			Type      string    `json:"$type"`
-			CreatedAt time.Time `json:"createdAt"`
-			Embed     struct {
-				Type     string `json:"$type"`
-				External struct {
-					Description string `json:"description"`
-					Title       string `json:"title"`
-					URI         string `json:"uri"`
-				} `json:"external"`
-			} `json:"embed"`
-			Facets []struct {
-				Features []struct {
-					Type string `json:"$type", omitempty`
-					URI  string `json:"uri", omitempty`
-				} `json:"features"`
-				Index struct {
-					ByteEnd   int `json:"byteEnd"`
-					ByteStart int `json:"byteStart"`
-				} `json:"index"`
-			} `json:"facets"`
-			Langs []string `json:"langs", omitempty`
-			Text  string   `json:"text"`
-		} `json:"record"`
-		Cid string `json:"cid"`
-	} `json:"commit"`
+	Did    string   `json:"did"`
+	TimeUs int64    `json:"time_us"`
+	Type   string   `json:"type"`
+	Kind   string   `json:"kind"`
+	Commit ATCommit `json:"commit"`
+}
+
+type ATCommit struct {
+	Rev        string   `json:"rev"`
+	Type       string   `json:"type"`
+	Operation  string   `json:"operation"`
+	Collection string   `json:"collection"`
+	Rkey       string   `json:"rkey"`
+	Record     ATRecord `json:"record"`
+	Cid        string   `json:"cid"`
+}
+
+type ATRecord struct {
+	Type      string    `json:"$type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Embed     ATEmbed   `json:"embed"`
+	Facets    []ATFacet `json:"facets"`
+	Langs     []string  `json:"langs,omitempty"`
+	Text      string    `json:"text"`
+	// Subject is set on likes and reposts, Reply on posts that answer another post.
+	Subject ATStrongRef `json:"subject"`
+	Reply   ATReply     `json:"reply"`
+}
+
+type ATEmbed struct {
+	Type     string     `json:"$type"`
+	External ATExternal `json:"external"`
+}
+
+type ATExternal struct {
+	Description string `json:"description"`
+	Title       string `json:"title"`
+	URI         string `json:"uri"`
+}
+
+type ATFacet struct {
+	Features []ATFeature  `json:"features"`
+	Index    ATFacetIndex `json:"index"`
+}
+
+type ATFeature struct {
+	Type string `json:"$type,omitempty"`
+	URI  string `json:"uri,omitempty"`
+}
+
+type ATFacetIndex struct {
+	ByteEnd   int `json:"byteEnd"`
+	ByteStart int `json:"byteStart"`
+}
+
+type ATStrongRef struct {
+	Cid string `json:"cid"`
+	URI string `json:"uri"`
+}
+
+type ATReply struct {
+	Parent ATStrongRef `json:"parent"`
+	Root   ATStrongRef `json:"root"`
 }
 
 type DBPost struct {
@@ -70,122 +104,181 @@ type DBPost struct {
 	RootURI    string
 	Text       string
 	Cid        string
-	ID         string
-	URI        string
+	// ID is the post's row, which orders posts sharing a time_us.
+	ID  int64
+	URI string
+
+	// Languages holds every language the post declares, normalized to primary
+	// subtags, or the one detected from its text when it declares none.
+	Languages         []string
+	LanguagesDetected bool
 }
 
-func InitDB() (*sql.DB, error) {
+// Pool pairs a single writer connection with a pool of read-only connections.
+// WAL lets readers keep going while the writer commits, so API reads never
+// queue behind ingest writes.
+type Pool struct {
+	Writer *sql.DB
+	Reader *sql.DB
+}
 
-	var err error
+func InitDB() (*Pool, error) {
 	var gitfeed = "gitfeed.db"
 
-	DB, err := sql.Open("sqlite3", gitfeed)
+	pool, err := Open(gitfeed)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	_, err = DB.Exec(`PRAGMA journal_mode=WAL;`)
+	fmt.Println("Connected to database:", gitfeed)
+	return pool, nil
+}
+
+func Open(path string) (*Pool, error) {
+	// _txlock=immediate takes the write lock when a transaction begins, so a
+	// transaction never has to upgrade a read lock while the other process writes.
+	writer, err := sql.Open("sqlite3", fmt.Sprintf(
+		"file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate&_synchronous=NORMAL",
+		path, busyTimeout.Milliseconds()))
 	if err != nil {
-		fmt.Println("Error setting WAL mode:", err)
-		panic(err)
+		return nil, fmt.Errorf("error opening writer: %w", err)
 	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
 
-	_, err = DB.Exec(`PRAGMA busy_timeout = 5000;`)
-	if err != nil {
-		fmt.Println("Error setting WAL mode:", err)
-		panic(err)
+	if err = writer.Ping(); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("error pinging database: %v", err)
 	}
 
-	err = DB.Ping()
+	reader, err := sql.Open("sqlite3", fmt.Sprintf(
+		"file:%s?_journal_mode=WAL&_busy_timeout=%d&_query_only=true",
+		path, busyTimeout.Milliseconds()))
 	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("error opening reader: %w", err)
+	}
+	readers := max(4, runtime.NumCPU())
+	reader.SetMaxOpenConns(readers)
+	reader.SetMaxIdleConns(readers)
+
+	if err = reader.Ping(); err != nil {
+		writer.Close()
+		reader.Close()
 		return nil, fmt.Errorf("error pinging database: %v", err)
 	}
 
-	fmt.Println("Connected to database:", gitfeed)
-	return DB, nil
+	return &Pool{Writer: writer, Reader: reader}, nil
 }
 
-func (pr *PostRepository) CreateTableIfNotExists(tableName string, columns map[string]string) error {
+func (p *Pool) Close() error {
+	return errors.Join(p.Reader.Close(), p.Writer.Close())
+}
+
+const (
+	busyTimeout  = 5 * time.Second
+	busyAttempts = 5
+)
+
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
 
-	var columnDefs []string
-	for colName, colType := range columns {
-		columnDefs = append(columnDefs, fmt.Sprintf("%s %s", colName, colType))
+// withRetry reruns fn while SQLite reports the database busy. busy_timeout
+// absorbs most contention between ingest and serve, but a lock held past the
+// timeout (a long checkpoint, a backup) still surfaces as SQLITE_BUSY.
+func withRetry(fn func() error) error {
+	delay := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt == busyAttempts {
+			return err
+		}
+		log.Printf("Database busy, retrying in %s (attempt %d/%d)", delay, attempt, busyAttempts)
+		time.Sleep(delay)
+		delay *= 2
 	}
+}
 
-	fmt.Printf("Creating table %s", tableName)
+type PostRepository struct {
+	reader *sql.DB
+	writer *sql.DB
 
-	// Construct the CREATE TABLE query
-	query := fmt.Sprintf(`
-        CREATE TABLE IF NOT EXISTS %s (
-            %s
-        )`,
-		tableName,
-		strings.Join(columnDefs, ",\n"))
-	fmt.Println(query)
+	insertPost    *sql.Stmt
+	addEngagement map[Engagement]*sql.Stmt
+	latestPosts   *sql.Stmt
+	latestTime    *sql.Stmt
+}
 
-	// Create table
-	_, err := pr.db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("error creating table %s: %v", tableName, err)
+func NewPostRepository(pool *Pool) (*PostRepository, error) {
+	pr := &PostRepository{
+		reader:        pool.Reader,
+		writer:        pool.Writer,
+		addEngagement: make(map[Engagement]*sql.Stmt),
 	}
 
-	// Index table on timestamp
-	_, err = pr.db.Exec("CREATE INDEX IF NOT EXISTS time_us ON posts(time_us);")
-	if err != nil {
-		return fmt.Errorf("error creating index time_us: %v", err)
+	var err error
+	if pr.insertPost, err = pool.Writer.Prepare(insertPostStmt); err != nil {
+		return nil, fmt.Errorf("error preparing insert: %w", err)
 	}
-
-	fmt.Printf("Table '%s' created or already exists\n", tableName)
-	return nil
+	for _, e := range []Engagement{Like, Repost, Reply} {
+		if pr.addEngagement[e], err = pool.Writer.Prepare(addEngagementStmt(e)); err != nil {
+			return nil, fmt.Errorf("error preparing engagement: %w", err)
+		}
+	}
+	if pr.latestPosts, err = pool.Reader.Prepare(latestPostsStmt); err != nil {
+		return nil, fmt.Errorf("error preparing posts query: %w", err)
+	}
+	if pr.latestTime, err = pool.Reader.Prepare(latestTimeStmt); err != nil {
+		return nil, fmt.Errorf("error preparing timestamp query: %w", err)
+	}
+	return pr, nil
 }
 
-type PostRepository struct {
-	db   *sql.DB
-	lock *sync.Mutex
-}
+// write runs fn in a transaction on the writer connection, retrying the
+// whole transaction if the database stays busy.
+func (pr *PostRepository) write(fn func(tx *sql.Tx) error) error {
+	return withRetry(func() error {
+		tx, err := pr.writer.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
 
-func NewPostRepository(db *sql.DB) *PostRepository {
-	return &PostRepository{db: db, lock: &sync.Mutex{}}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
 }
 
 type PostRepo interface {
-	GetPost(uuid string) (*DBPost, error)
+	// GetPost returns the post stored as did's record rkey.
+	GetPost(did, rkey string) (*DBPost, error)
 	WritePost(p DBPost) error
-	DeletePost(uuid string) error
+	// DeletePost removes did's record rkey in collection, if it's stored.
+	DeletePost(did, collection, rkey string) error
 	DeletePosts() error
 	GetAllPosts() ([]DBPost, error)
+	GetPosts(filter PostFilter) ([]DBPost, error)
+	GetPostsAfter(after PostCursor, filter PostFilter, limit int) ([]DBPost, error)
+	GetPostsBefore(before PostCursor, filter PostFilter, limit int) ([]DBPost, error)
 	GetTimeStamp() (int64, error)
 }
 
-func (pr *PostRepository) GetPost(did string) (*DBPost, error) {
-	pr.lock.Lock()
-	defer pr.lock.Unlock()
-
-	sqlStmt := `SELECT *
-                FROM posts 
-                WHERE did = $1`
-
-	var post DBPost
-	err := pr.db.QueryRow(sqlStmt, did).Scan(
-		&post.Did,
-		&post.TimeUs,
-		&post.Kind,
-		&post.Rev,
-		&post.Operation,
-		&post.Collection,
-		&post.Rkey,
-		&post.Cid,
-		&post.Type,
-		&post.CreatedAt,
-		&post.Langs,
-		&post.Text,
-		&post.ID,
-		&post.URI,
-	)
+// GetPost returns the post stored as did's record rkey.
+func (pr *PostRepository) GetPost(did, rkey string) (*DBPost, error) {
+	sqlStmt := `SELECT ` + postColumns + `
+                FROM posts p
+                WHERE p.did = $1 AND p.commit_collection = $2 AND p.commit_rkey = $3`
 
+	post, err := scanPost(pr.reader.QueryRow(sqlStmt, did, PostCollection, rkey))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("no post found with DID: %s", did)
+			return nil, fmt.Errorf("no post found at %s/%s: %w", did, rkey, ErrNotFound)
 		}
 		return nil, fmt.Errorf("error querying post: %w", err)
 	}
@@ -193,10 +286,7 @@ func (pr *PostRepository) GetPost(did string) (*DBPost, error) {
 	return &post, nil
 }
 
-func (pr *PostRepository) WritePost(p DBPost) error {
-	pr.lock.Lock()
-	defer pr.lock.Unlock()
-	sqlStmt := `INSERT INTO posts (did, 
+const insertPostValues = `INSERT INTO posts (did, 
 	time_us, 
 	kind, 
 	commit_rev, 
@@ -208,23 +298,76 @@ func (pr *PostRepository) WritePost(p DBPost) error {
 	record_created_at, 
 	record_langs, 
 	record_text,
-	record_uri)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,$13)`
-
-	_, err := pr.db.Exec(sqlStmt,
-		p.Did,
-		p.TimeUs,
-		p.Kind,
-		p.Rev,
-		p.Operation,
-		p.Collection,
-		p.Rkey,
-		p.Cid,
-		p.Type,
-		p.CreatedAt,
-		p.Langs,
-		p.Text,
-		p.URI)
+	record_uri,
+	reply_parent_uri,
+	reply_parent_cid,
+	reply_root_uri,
+	reply_root_cid)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,$13, $14, $15, $16, $17)`
+
+// insertPostStmt is an upsert: replays of a record update it in place, and an
+// edit replaces its content while keeping its original position in the feed.
+const insertPostStmt = insertPostValues + `
+ON CONFLICT (did, commit_collection, commit_rkey) DO UPDATE SET
+	commit_rev = excluded.commit_rev,
+	commit_operation = excluded.commit_operation,
+	commit_cid = excluded.commit_cid,
+	record_langs = excluded.record_langs,
+	record_text = excluded.record_text,
+	record_uri = excluded.record_uri,
+	reply_parent_uri = excluded.reply_parent_uri,
+	reply_parent_cid = excluded.reply_parent_cid,
+	reply_root_uri = excluded.reply_root_uri,
+	reply_root_cid = excluded.reply_root_cid
+RETURNING id, time_us`
+
+func (pr *PostRepository) WritePost(p DBPost) error {
+	err := pr.write(func(tx *sql.Tx) error {
+		// Only the first copy of a record counts towards rollups.
+		var stored bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts
+			WHERE did = $1 AND commit_collection = $2 AND commit_rkey = $3)`,
+			p.Did, p.Collection, p.Rkey).Scan(&stored)
+		if err != nil {
+			return err
+		}
+
+		var postID, timeUs int64
+		err = tx.Stmt(pr.insertPost).QueryRow(
+			p.Did,
+			p.TimeUs,
+			p.Kind,
+			p.Rev,
+			p.Operation,
+			p.Collection,
+			p.Rkey,
+			p.Cid,
+			p.Type,
+			p.CreatedAt,
+			p.Langs,
+			p.Text,
+			p.URI,
+			p.ParentURI,
+			p.ParentCid,
+			p.RootURI,
+			p.RootCid).Scan(&postID, &timeUs)
+		if err != nil {
+			return err
+		}
+		if err := relinkRepository(tx, postID, timeUs, p.URI); err != nil {
+			return err
+		}
+		if err := setPostLangs(tx, postID, p.Languages, p.LanguagesDetected); err != nil {
+			return err
+		}
+		if err := logChange(tx, PostWritten, p.Did, p.Rkey, timeUs); err != nil {
+			return err
+		}
+		if stored {
+			return nil
+		}
+		return rollUpPost(tx, postID, p.Languages)
+	})
 	if err != nil {
 		log.Printf("%+v\n", p)
 		return fmt.Errorf("could not write to db: %w", err)
@@ -233,86 +376,83 @@ VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,$13)`
 	return nil
 }
 
-func (pr *PostRepository) DeletePost(uuid string) error {
-	pr.lock.Lock()
-	defer pr.lock.Unlock()
-	sqlStmt := `DELETE FROM posts WHERE postid = $1`
-
-	_, err := pr.db.Exec(sqlStmt, uuid)
+func (pr *PostRepository) DeletePost(did, collection, rkey string) error {
+	err := pr.write(func(tx *sql.Tx) error {
+		n, err := deletePostsWhere(tx, `did = $1 AND commit_collection = $2 AND commit_rkey = $3`, did, collection, rkey)
+		if err != nil || n == 0 {
+			return err
+		}
+		return logChange(tx, PostDeleted, did, rkey, 0)
+	})
 	if err != nil {
 		return fmt.Errorf("could not delete from db: %w", err)
 	}
-
 	return nil
 }
 
 func (pr *PostRepository) DeletePosts() error {
-	pr.lock.Lock()
-	defer pr.lock.Unlock()
-
 	log.Printf("Deleting old posts...")
-	sqlStmt := `DELETE FROM posts WHERE NOT EXISTS (
-    SELECT 1 FROM (
-        SELECT * FROM posts ORDER BY time_us DESC LIMIT 10
-    ) AS temp WHERE posts.did = temp.did AND posts.time_us = temp.time_us
-	);`
+	cutoff := time.Now().Add(-Retention).UnixMicro()
 
-	_, err := pr.db.Exec(sqlStmt)
+	var n int64
+	err := pr.write(func(tx *sql.Tx) (err error) {
+		n, err = deletePostsWhere(tx, `time_us < $1`, cutoff)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			if err := logChange(tx, PostsPruned, "", "", cutoff); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM feed_seen WHERE first_seen < $1`, cutoff); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM github_responses WHERE fetched_at < $1`, cutoff); err != nil {
+			return err
+		}
+		return pruneChanges(tx)
+	})
 	if err != nil {
 		return fmt.Errorf("could not delete from db: %w", err)
 	}
 
+	log.Printf("Deleted %d posts older than %s", n, Retention)
 	return nil
 }
 
+const latestPostsStmt = `SELECT ` + postColumns + `
+	FROM posts p
+	ORDER BY p.time_us DESC LIMIT 10;`
+
 func (pr *PostRepository) GetAllPosts() ([]DBPost, error) {
-	pr.lock.Lock()
-	defer pr.lock.Unlock()
+	return pr.GetPosts(PostFilter{})
+}
 
+// GetPosts returns the 10 latest posts matching filter.
+func (pr *PostRepository) GetPosts(filter PostFilter) ([]DBPost, error) {
 	log.Printf("Fetching top 10 posts desc from DB...")
-	sqlStmt := `SELECT  DISTINCT did, 
-	                             time_us, 
-								 kind, 
-								 commit_rev, 
-								 commit_operation, 
-								 commit_collection, 
-                                 commit_rkey, 
-								 record_type, 
-								 record_created_at, 
-								 record_langs, 
-								 commit_cid, 
-								 record_text, 
-								 record_uri  
-								 FROM posts
-				                 ORDER BY time_us desc LIMIT 10;`
-
-	rows, err := pr.db.Query(sqlStmt)
+	var rows *sql.Rows
+	var err error
+	if filter == (PostFilter{}) {
+		rows, err = pr.latestPosts.Query()
+	} else {
+		where, args := filter.where()
+		rows, err = pr.reader.Query(`SELECT `+postColumns+`
+		FROM posts p
+		WHERE `+where+`
+		ORDER BY p.time_us DESC LIMIT 10`, args...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error querying posts: %w", err)
 	}
+	defer rows.Close()
 
 	var posts []DBPost
 
 	log.Printf("Iterating on rows...")
 	for rows.Next() {
-		var p DBPost
-
-		err := rows.Scan(
-			&p.Did,
-			&p.TimeUs,
-			&p.Kind,
-			&p.Rev,
-			&p.Operation,
-			&p.Collection,
-			&p.Rkey,
-			&p.Type,
-			&p.CreatedAt,
-			&p.Langs,
-			&p.ParentCid,
-			&p.Text,
-			&p.URI,
-		)
-
+		p, err := scanPost(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning post: %w", err)
 		}
@@ -324,25 +464,128 @@ func (pr *PostRepository) GetAllPosts() ([]DBPost, error) {
 	}
 
 	if len(posts) == 0 {
-		return nil, fmt.Errorf("no posts found")
+		return nil, fmt.Errorf("no posts found: %w", ErrNotFound)
 	}
 
 	return posts, nil
 
 }
 
+// GetPostsAfter returns up to limit posts matching filter that come after the
+// cursor, oldest first, so a reader can page forward from the last post it saw.
+func (pr *PostRepository) GetPostsAfter(after PostCursor, filter PostFilter, limit int) ([]DBPost, error) {
+	where, args := filter.where()
+	args = append(args, after.TimeUs, after.ID, limit)
+	return pr.queryPosts(`SELECT `+postColumns+`
+	FROM posts p
+	WHERE `+where+fmt.Sprintf(` AND (p.time_us, p.id) > ($%d, $%d)
+	ORDER BY p.time_us, p.id LIMIT $%d`, len(args)-2, len(args)-1, len(args)), args...)
+}
+
+// GetPostsBefore returns up to limit posts matching filter that come before
+// the cursor, newest first. The zero cursor starts from the newest post.
+func (pr *PostRepository) GetPostsBefore(before PostCursor, filter PostFilter, limit int) ([]DBPost, error) {
+	where, args := filter.where()
+	if !before.IsZero() {
+		args = append(args, before.TimeUs, before.ID)
+		where += fmt.Sprintf(` AND (p.time_us, p.id) < ($%d, $%d)`, len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	return pr.queryPosts(`SELECT `+postColumns+`
+	FROM posts p
+	WHERE `+where+fmt.Sprintf(`
+	ORDER BY p.time_us DESC, p.id DESC LIMIT $%d`, len(args)), args...)
+}
+
+func (pr *PostRepository) queryPosts(sqlStmt string, args ...any) ([]DBPost, error) {
+	rows, err := pr.reader.Query(sqlStmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []DBPost
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning post: %w", err)
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating posts: %w", err)
+	}
+	return posts, nil
+}
+
+const latestTimeStmt = `SELECT time_us FROM posts ORDER BY time_us DESC LIMIT 1;`
+
 func (pr *PostRepository) GetTimeStamp() (int64, error) {
-	pr.lock.Lock()
-	defer pr.lock.Unlock()
-	sqlStmt := `SELECT time_us FROM posts ORDER BY time_us DESC LIMIT 1;`
 	var timeUs int64
-	if err := pr.db.QueryRow(sqlStmt).Scan(&timeUs); err != nil {
+	if err := pr.latestTime.QueryRow().Scan(&timeUs); err != nil {
 
 		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("no posts found")
+			return 0, fmt.Errorf("no posts found: %w", ErrNotFound)
 		}
 		return 0, err
 	}
 
 	return timeUs, nil
 }
+
+const postColumns = `p.id,
+	p.did,
+	p.time_us,
+	p.kind,
+	p.commit_rev,
+	p.commit_operation,
+	p.commit_collection,
+	p.commit_rkey,
+	p.commit_cid,
+	p.record_type,
+	p.record_created_at,
+	p.record_langs,
+	p.record_text,
+	p.record_uri,
+	p.reply_parent_uri,
+	p.reply_parent_cid,
+	p.reply_root_uri,
+	p.reply_root_cid,
+	(SELECT group_concat(lang, ',') FROM
+		(SELECT lang FROM post_langs WHERE post_id = p.id ORDER BY position)),
+	COALESCE((SELECT MAX(detected) FROM post_langs WHERE post_id = p.id), 0)`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row scanner) (DBPost, error) {
+	var p DBPost
+	var langs sql.NullString
+	err := row.Scan(
+		&p.ID,
+		&p.Did,
+		&p.TimeUs,
+		&p.Kind,
+		&p.Rev,
+		&p.Operation,
+		&p.Collection,
+		&p.Rkey,
+		&p.Cid,
+		&p.Type,
+		&p.CreatedAt,
+		&p.Langs,
+		&p.Text,
+		&p.URI,
+		&p.ParentURI,
+		&p.ParentCid,
+		&p.RootURI,
+		&p.RootCid,
+		&langs,
+		&p.LanguagesDetected,
+	)
+	if langs.Valid {
+		p.Languages = strings.Split(langs.String, ",")
+	}
+	return p, err
+}
@@ -0,0 +1,875 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPool(tb testing.TB) *Pool {
+	tb.Helper()
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(out) })
+
+	pool, err := Open(filepath.Join(tb.TempDir(), "gitfeed.db"))
+	if err != nil {
+		tb.Fatalf("open: %v", err)
+	}
+	tb.Cleanup(func() { pool.Close() })
+
+	if err := Migrate(pool.Writer); err != nil {
+		tb.Fatalf("migrate: %v", err)
+	}
+	return pool
+}
+
+func newTestRepository(tb testing.TB) *PostRepository {
+	tb.Helper()
+	pr, err := NewPostRepository(newTestPool(tb))
+	if err != nil {
+		tb.Fatalf("new repository: %v", err)
+	}
+	return pr
+}
+
+func testPost(i int) DBPost {
+	return DBPost{
+		Did:        fmt.Sprintf("did:plc:author%d", i%50),
+		TimeUs:     time.Now().UnixMicro() + int64(i),
+		Kind:       "commit",
+		Operation:  "create",
+		Collection: "app.bsky.feed.post",
+		Rkey:       fmt.Sprintf("rkey%d", i),
+		Cid:        fmt.Sprintf("cid%d", i),
+		Type:       "app.bsky.feed.post",
+		CreatedAt:  time.Now().UTC(),
+		Text:       "check out this repo",
+		URI:        fmt.Sprintf("https://github.com/owner%d/repo%d", i%20, i%7),
+	}
+}
+
+func TestReadsDoNotWaitForWriter(t *testing.T) {
+	pr := newTestRepository(t)
+	if err := pr.WritePost(testPost(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the write lock open, the way a long ingest transaction would.
+	tx, err := pr.writer.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM posts`); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		posts, err := pr.GetAllPosts()
+		if err == nil && len(posts) != 1 {
+			err = fmt.Errorf("got %d posts, want the 1 committed post", len(posts))
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read blocked behind an open write transaction")
+	}
+}
+
+func TestDedupeMigration(t *testing.T) {
+	pool := newTestPool(t)
+	pr, err := NewPostRepository(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Roll back to before the unique key and store the same record three times,
+	// the last time with edited content, as reconnect replays used to.
+	if _, err := pool.Writer.Exec(`DROP INDEX posts_did_collection_rkey; PRAGMA user_version = 3;`); err != nil {
+		t.Fatal(err)
+	}
+	original, replay, edited := testPost(1), testPost(1), testPost(1)
+	edited.Text = "edited"
+	edited.URI = "https://github.com/someone/else"
+	for _, p := range []DBPost{original, replay, edited, testPost(2)} {
+		_, err := pool.Writer.Exec(`INSERT INTO posts (did, time_us, kind, commit_rev, commit_operation,
+			commit_collection, commit_rkey, commit_cid, record_type, record_created_at, record_text, record_uri)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			p.Did, p.TimeUs, p.Kind, p.Rev, p.Operation, p.Collection, p.Rkey, p.Cid, p.Type, p.CreatedAt, p.Text, p.URI)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pr.AddEngagement(original.Did, original.Rkey, Like); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(pool.Writer); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := pr.GetAllPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts, want 2", len(posts))
+	}
+	for _, p := range posts {
+		if p.Did == original.Did && (p.Text != "edited" || p.URI != edited.URI) {
+			t.Errorf("kept post has %q %q, want the edited content", p.Text, p.URI)
+		}
+	}
+
+	mentions, err := pr.GetMentions(0, PostFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mentions {
+		if m.Did == original.Did && (m.Owner != "someone" || m.Likes != 1) {
+			t.Errorf("kept post mentions %s/%s with %d likes, want someone/else with 1", m.Owner, m.Name, m.Likes)
+		}
+	}
+
+	if err := pr.WritePost(replay); err != nil {
+		t.Fatal(err)
+	}
+	if posts, _ := pr.GetAllPosts(); len(posts) != 2 {
+		t.Errorf("replay after migration stored a duplicate")
+	}
+}
+
+func TestBackupAndIntegrityCheck(t *testing.T) {
+	pr := newTestRepository(t)
+	for i := 0; i < 5; i++ {
+		if err := pr.WritePost(testPost(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	if err := Backup(pr.writer, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := Open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	report, err := CheckIntegrity(backup.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SchemaVersion != SchemaVersion() || !report.OK() {
+		t.Fatalf("backup report:\n%s", report)
+	}
+	var n int
+	if err := backup.Reader.QueryRow(`SELECT COUNT(*) FROM posts`).Scan(&n); err != nil || n != 5 {
+		t.Fatalf("backup has %d posts (%v), want 5", n, err)
+	}
+
+	if _, err := backup.Writer.Exec(`DELETE FROM posts WHERE commit_rkey = 'rkey1'`); err != nil {
+		t.Fatal(err)
+	}
+	report, err = CheckIntegrity(backup.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || report.Orphans["post_repositories without a post"] != 1 {
+		t.Errorf("deleting a post behind the repository's back wasn't reported:\n%s", report)
+	}
+}
+
+func TestExportRange(t *testing.T) {
+	pr := newTestRepository(t)
+	var posts []DBPost
+	for i := 0; i < 4; i++ {
+		p := testPost(i)
+		p.URI = "https://github.com/owner/repo"
+		posts = append(posts, p)
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since, until := posts[1].TimeUs, posts[3].TimeUs
+
+	var rkeys []string
+	if err := pr.ExportPosts(since, until, func(p DBPost) error {
+		rkeys = append(rkeys, p.Rkey)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(rkeys) != "[rkey1 rkey2]" {
+		t.Errorf("exported posts %v, want [rkey1 rkey2]", rkeys)
+	}
+
+	var links int
+	if err := pr.ExportLinks(since, until, func(l Link) error {
+		links++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if links != 2 {
+		t.Errorf("exported %d links, want 2", links)
+	}
+
+	var repos []RepositoryMentions
+	if err := pr.ExportRepositories(since, until, func(r RepositoryMentions) error {
+		repos = append(repos, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Mentions != 2 || repos[0].MentionCount != 4 {
+		t.Errorf("exported repositories %+v, want one with 2 mentions in range and 4 overall", repos)
+	}
+}
+
+func TestImportPostsKeepsStoredRecords(t *testing.T) {
+	pr := newTestRepository(t)
+	live := testPost(1)
+	live.Text = "edited live"
+	if err := pr.WritePost(live); err != nil {
+		t.Fatal(err)
+	}
+
+	inserted, err := pr.ImportPosts([]DBPost{testPost(1), testPost(2), testPost(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 1 {
+		t.Errorf("inserted %d posts, want 1", inserted)
+	}
+
+	post, err := pr.GetPost(live.Did, live.Rkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Text != live.Text {
+		t.Errorf("import overwrote the stored post with %q", post.Text)
+	}
+	repos, err := pr.GetTopRepositories(0, time.Now().Add(time.Hour).UnixMicro(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 {
+		t.Errorf("imported posts linked %d repositories, want 2", len(repos))
+	}
+}
+
+func TestRollupsSurviveRetention(t *testing.T) {
+	pr := newTestRepository(t)
+	day := Day.Truncate(time.Now().Add(-60 * 24 * time.Hour).UnixMicro())
+
+	var posts []DBPost
+	for i := 0; i < 3; i++ {
+		p := testPost(i)
+		p.Did = "did:plc:same"
+		p.TimeUs = day + int64(i)*time.Hour.Microseconds()
+		p.URI = "https://github.com/owner/repo"
+		posts = append(posts, p)
+	}
+	posts[0].Languages = []string{"de"}
+	posts[2].URI = "https://codeberg.org/owner/other"
+	edited := posts[0]
+	edited.Text = "edited"
+	for _, p := range append(posts, edited) {
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pr.ImportPosts(posts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pr.DeletePosts(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pr.GetAllPosts(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("retention kept posts: %v", err)
+	}
+
+	until := day + 2*Day.Duration().Microseconds()
+	buckets, err := pr.GetTimeseries(Day, day, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+	got := buckets[0]
+	if got.Posts != 3 || got.Authors != 1 || got.Langs["de"] != 1 || got.Langs["und"] != 2 ||
+		got.Forges["github"] != 2 || got.Forges["codeberg"] != 1 {
+		t.Errorf("day bucket %+v, want 3 posts by 1 author", got)
+	}
+	if buckets[1].Posts != 0 {
+		t.Errorf("empty day has %d posts", buckets[1].Posts)
+	}
+
+	hours, err := pr.GetRepositoryTimeseries(Hour, "github", "Owner", "repo", day, day+3*Hour.Duration().Microseconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mentions []int64
+	for _, h := range hours {
+		mentions = append(mentions, h.Mentions)
+	}
+	if fmt.Sprint(mentions) != "[1 1 0]" {
+		t.Errorf("hourly mentions %v, want [1 1 0]", mentions)
+	}
+
+	_, err = pr.GetRepositoryTimeseries(Day, "github", "nobody", "nothing", day, until)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown repository: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	pool := newTestPool(t)
+	pr, err := NewPostRepository(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pr.WritePost(testPost(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := NewChangeFeed(pool)
+	feed.Interval = 10 * time.Millisecond
+	changes, unsubscribe := feed.Subscribe()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- feed.Run(ctx) }()
+	// Let Run note where the log ends before writing.
+	time.Sleep(50 * time.Millisecond)
+
+	expired := testPost(2)
+	expired.TimeUs = time.Now().Add(-Retention - time.Hour).UnixMicro()
+	for _, p := range []DBPost{testPost(1), expired} {
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pr.DeletePost(testPost(1).Did, testPost(1).Collection, testPost(1).Rkey); err != nil {
+		t.Fatal(err)
+	}
+	if err := pr.DeletePosts(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []ChangeOp
+	timeout := time.After(5 * time.Second)
+	for len(got) < 4 {
+		select {
+		case batch := <-changes:
+			for _, c := range batch {
+				got = append(got, c.Op)
+			}
+		case <-timeout:
+			t.Fatalf("got changes %v before timing out", got)
+		}
+	}
+	want := []ChangeOp{PostWritten, PostWritten, PostDeleted, PostsPruned}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got changes %v, want %v", got, want)
+	}
+
+	logged, err := pr.GetChanges(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 5 || logged[0].Did != testPost(0).Did {
+		t.Errorf("change log %+v, want the first write and the 4 published changes", logged)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-changes; ok {
+		t.Error("subscription still open after the feed stopped")
+	}
+}
+
+func TestChangeFeedFollowCatchesUp(t *testing.T) {
+	pool := newTestPool(t)
+	pr, err := NewPostRepository(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed := NewChangeFeed(pool)
+	feed.Interval = 10 * time.Millisecond
+	run := func() (context.CancelFunc, chan error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- feed.Run(ctx) }()
+		// Let Run note where the log ends before writing.
+		time.Sleep(50 * time.Millisecond)
+		return cancel, done
+	}
+	write := func(i int) {
+		if err := pr.WritePost(testPost(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	seqs := make(chan int64, 10)
+	go feed.Follow(ctx, func(batch []Change) {
+		for _, c := range batch {
+			seqs <- c.Seq
+		}
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	stop, done := run()
+	write(1)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// Nothing publishes these; Follow has to find them in the log.
+	write(2)
+	write(3)
+	stop, _ = run()
+	defer stop()
+	write(4)
+
+	var got []int64
+	timeout := time.After(5 * time.Second)
+	for len(got) < 4 {
+		select {
+		case seq := <-seqs:
+			got = append(got, seq)
+		case <-timeout:
+			t.Fatalf("got changes %v before timing out", got)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]int64{1, 2, 3, 4}) {
+		t.Errorf("got changes %v, want each write once in order", got)
+	}
+}
+
+func TestFeedSeen(t *testing.T) {
+	pr := newTestRepository(t)
+	repo := Repository{Forge: "github", Owner: "owner", Name: "repo"}
+	if err := pr.MarkSeen("did:plc:viewer", "latest", []Repository{repo, repo}); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute).UnixMicro()
+	// Marking again keeps the time it was first seen.
+	if err := pr.MarkSeen("did:plc:viewer", "latest", []Repository{repo}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err := pr.GetSeen("did:plc:viewer", "latest", later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || seen[0] != repo {
+		t.Errorf("got seen %v, want %v", seen, repo)
+	}
+	for _, tc := range []struct{ viewer, feed string }{
+		{"did:plc:viewer", "trending"},
+		{"did:plc:other", "latest"},
+	} {
+		if seen, err := pr.GetSeen(tc.viewer, tc.feed, later); err != nil || len(seen) != 0 {
+			t.Errorf("%s in %s: got seen %v, %v", tc.viewer, tc.feed, seen, err)
+		}
+	}
+	if seen, err := pr.GetSeen("did:plc:viewer", "latest", 0); err != nil || len(seen) != 0 {
+		t.Errorf("got seen %v, %v before anything was marked", seen, err)
+	}
+}
+
+func TestGitHubCache(t *testing.T) {
+	pr := newTestRepository(t)
+	if _, err := pr.GetCachedResponse("/repos/owner/repo"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	want := CachedResponse{Path: "/repos/owner/repo", Status: 200, ETag: `"v1"`, Body: []byte(`{}`), FetchedAt: 1}
+	for _, etag := range []string{`"v0"`, `"v1"`} {
+		c := want
+		c.ETag = etag
+		if err := pr.PutCachedResponse(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := pr.GetCachedResponse("/repos/owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Entries older than the retention window are pruned with posts.
+	if err := pr.DeletePosts(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pr.GetCachedResponse("/repos/owner/repo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after pruning, want ErrNotFound", err)
+	}
+}
+
+func TestRepositoryMetadata(t *testing.T) {
+	pr := newTestRepository(t)
+	for i := 0; i < 3; i++ {
+		p := testPost(i)
+		p.URI = fmt.Sprintf("https://github.com/owner/repo%d", i)
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extra := testPost(3)
+	extra.URI = "https://github.com/owner/repo1"
+	codeberg := testPost(4)
+	codeberg.URI = "https://codeberg.org/owner/repo"
+	for _, p := range []DBPost{extra, codeberg} {
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UnixMicro()
+	pending, err := pr.GetRepositoriesToEnrich(0, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 || pending[0].Name != "repo1" {
+		t.Fatalf("got %+v, want the 3 GitHub repositories, most mentioned first", pending)
+	}
+
+	for i, m := range pending {
+		m.Stars, m.Status, m.FetchedAt = int64(10*i), 200, now
+		m.Language = []string{"Go", "Rust", "Go"}[i]
+		if i == 1 {
+			m.Topics = []string{"CLI", "terminal"}
+		}
+		if err := pr.PutRepositoryMetadata(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending, err := pr.GetRepositoriesToEnrich(0, now, 10); err != nil || len(pending) != 0 {
+		t.Errorf("got %v, %v, want nothing left to enrich", pending, err)
+	}
+	if stale, err := pr.GetRepositoriesToEnrich(0, now+1, 10); err != nil || len(stale) != 3 || stale[0].Stars != 0 || stale[0].Name != "repo1" {
+		t.Errorf("got %+v, %v, want every repository stale, keeping its metadata", stale, err)
+	}
+
+	for _, tc := range []struct {
+		q    RepositoryQuery
+		want []string
+	}{
+		{RepositoryQuery{Sort: "stars", Limit: 10}, []string{pending[2].Name, pending[1].Name, pending[0].Name}},
+		{RepositoryQuery{Sort: "mentions", Limit: 1}, []string{"repo1"}},
+		{RepositoryQuery{Sort: "stars", Language: "go", Limit: 10}, []string{pending[2].Name, pending[0].Name}},
+		{RepositoryQuery{Sort: "stars", Topic: "cli", Limit: 10}, []string{pending[1].Name}},
+	} {
+		repos, err := pr.GetRepositories(tc.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range repos {
+			names = append(names, r.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tc.want) {
+			t.Errorf("%+v: got %v, want %v", tc.q, names, tc.want)
+		}
+	}
+	if _, err := pr.GetRepositories(RepositoryQuery{Sort: "name", Limit: 10}); !errors.Is(err, ErrBadSort) {
+		t.Errorf("got %v, want ErrBadSort", err)
+	}
+}
+
+func TestRepositoryHistory(t *testing.T) {
+	pr := newTestRepository(t)
+	day := Day.Truncate(time.Now().UnixMicro())
+	dayUs := Day.Duration().Microseconds()
+	for i := 0; i < 3; i++ {
+		p := testPost(i)
+		p.URI = "https://github.com/Owner/repo"
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending, err := pr.GetRepositoriesToEnrich(0, day, 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("got %+v, %v, want the one repository", pending, err)
+	}
+
+	// Two days ago, then twice today: the later fetch replaces today's snapshot.
+	m := pending[0]
+	for _, snap := range []struct{ at, stars int64 }{{day - 2*dayUs, 3}, {day + 1, 5}, {day + 2, 8}} {
+		m.Stars, m.Forks, m.Status, m.FetchedAt = snap.stars, 1, 200, snap.at
+		if err := pr.PutRepositoryMetadata(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Status, m.FetchedAt = 404, day+3
+	if err := pr.PutRepositoryMetadata(m); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := pr.GetRepositoryHistory("owner", "Repo", day-2*dayUs, day+dayUs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("got %d buckets, want 3", len(history))
+	}
+	if h := history[0]; h.Stars == nil || *h.Stars != 3 || h.Mentions != 0 {
+		t.Errorf("got %+v, want 3 stars two days ago", h)
+	}
+	if h := history[1]; h.Stars != nil {
+		t.Errorf("got %+v, want no snapshot yesterday", h)
+	}
+	if h := history[2]; h.Stars == nil || *h.Stars != 8 || *h.Forks != 1 || h.Mentions != 3 {
+		t.Errorf("got %+v, want today's 3 mentions and latest 8 stars", h)
+	}
+
+	if _, err := pr.GetRepositoryHistory("nobody", "nothing", day, day+dayUs); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRepositoryDetail(t *testing.T) {
+	pr := newTestRepository(t)
+	// Every post shares a time_us, so pages must break ties by row.
+	timeUs := time.Now().UnixMicro()
+	for i, uri := range []string{
+		"https://github.com/owner/repo", "https://github.com/owner/repo", "https://github.com/Owner/repo",
+		"https://github.com/owner/other", "https://github.com/someone/else",
+	} {
+		p := testPost(i)
+		p.Did = fmt.Sprintf("did:plc:author%d", i%2)
+		p.URI = uri
+		p.TimeUs = timeUs
+		if err := pr.WritePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo, err := pr.GetRepository("github", "Owner", "Repo")
+	if err != nil || repo.MentionCount != 3 || repo.DistinctAuthors != 2 {
+		t.Fatalf("got %+v, %v, want 3 mentions from 2 authors", repo, err)
+	}
+	if _, err := pr.GetRepository("github", "owner", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+
+	sharers, err := pr.GetRepositorySharers("github", "owner", "repo", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sharers) != 2 || sharers[0].Did != "did:plc:author0" || sharers[0].Posts != 2 {
+		t.Errorf("got %+v, want author0 with 2 posts first", sharers)
+	}
+
+	var pages [][]string
+	var before PostCursor
+	for {
+		posts, err := pr.GetRepositoryPosts("github", "owner", "repo", before, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rkeys []string
+		for _, p := range posts {
+			rkeys = append(rkeys, p.Rkey)
+			before = p.Cursor()
+		}
+		pages = append(pages, rkeys)
+		if len(posts) < 2 {
+			break
+		}
+	}
+	if fmt.Sprint(pages) != "[[rkey2 rkey1] [rkey0]]" {
+		t.Errorf("got pages %v, want newest first", pages)
+	}
+
+	m := repo
+	m.Stars, m.Status, m.FetchedAt = 10, 200, time.Now().UnixMicro()
+	if err := pr.PutRepositoryMetadata(m); err != nil {
+		t.Fatal(err)
+	}
+	owner, err := pr.GetOwner("github", "OWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Repositories != 2 || owner.Mentions != 4 || owner.Sharers != 2 || owner.Stars != 10 {
+		t.Errorf("got %+v, want 2 repositories, 4 mentions, 2 sharers and 10 stars", owner)
+	}
+	if _, err := pr.GetOwner("github", "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	repos, err := pr.GetOwnerRepositories("github", "owner", 10)
+	if err != nil || len(repos) != 2 || repos[0].Name != "repo" || repos[0].Stars != 10 {
+		t.Errorf("got %+v, %v, want repo then other", repos, err)
+	}
+
+	until := time.Now().Add(time.Hour).UnixMicro()
+	days, err := pr.GetOwnerTimeseries(Day, "github", "owner", until-Day.Duration().Microseconds(), until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, d := range days {
+		total += d.Mentions
+	}
+	if total != 4 {
+		t.Errorf("got %d mentions in %+v, want 4", total, days)
+	}
+}
+
+func seed(b *testing.B, pr *PostRepository) {
+	for i := 0; i < 200; i++ {
+		if err := pr.WritePost(testPost(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// writeContinuously writes and deletes posts until stop is closed, taking lock
+// around each call when one is given. Deleting keeps the table the same size so
+// read cost doesn't drift with how many writes got through. It returns a
+// function that stops the writer and reports its throughput.
+func writeContinuously(b *testing.B, pr *PostRepository, lock sync.Locker) func() {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var writes int
+	start := time.Now()
+
+	locked := func(fn func() error) error {
+		if lock != nil {
+			lock.Lock()
+			defer lock.Unlock()
+		}
+		return fn()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1000; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			p := testPost(i)
+			if err := locked(func() error { return pr.WritePost(p) }); err != nil {
+				b.Error(err)
+				return
+			}
+			if err := locked(func() error { return pr.DeletePost(p.Did, p.Collection, p.Rkey) }); err != nil {
+				b.Error(err)
+				return
+			}
+			writes += 2
+		}
+	}()
+
+	return func() {
+		close(stop)
+		wg.Wait()
+		b.ReportMetric(float64(writes)/time.Since(start).Seconds(), "writes/s")
+	}
+}
+
+func BenchmarkGetAllPosts(b *testing.B) {
+	pr := newTestRepository(b)
+	seed(b, pr)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := pr.GetAllPosts(); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// Reads against the read pool while ingest writes as fast as it can.
+func BenchmarkGetAllPostsDuringWrites(b *testing.B) {
+	pr := newTestRepository(b)
+	seed(b, pr)
+
+	stopWriter := writeContinuously(b, pr, nil)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := pr.GetAllPosts(); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+	b.StopTimer()
+	stopWriter()
+}
+
+// The previous design: one mutex around every repository call, reads included.
+func BenchmarkGetAllPostsDuringWritesSerialized(b *testing.B) {
+	pr := newTestRepository(b)
+	seed(b, pr)
+
+	var lock sync.Mutex
+	stopWriter := writeContinuously(b, pr, &lock)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lock.Lock()
+			_, err := pr.GetAllPosts()
+			lock.Unlock()
+			if err != nil {
+				b.Error(err)
+			}
+		}
+	})
+	b.StopTimer()
+	stopWriter()
+}
+
+func TestParseRepositoryURL(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want Repository
+		ok   bool
+	}{
+		{"https://github.com/Owner/Repo.git", Repository{Forge: "github", Owner: "owner", Name: "repo"}, true},
+		{"https://github.com/topics/go", Repository{}, false},
+		{"https://github.com/settings/profile", Repository{}, false},
+		// The reserved paths are GitHub's; other forges may have owners by those names.
+		{"https://codeberg.org/topics/repo", Repository{Forge: "codeberg", Owner: "topics", Name: "repo"}, true},
+		{"https://example.com/owner/repo", Repository{}, false},
+	} {
+		got, ok := ParseRepositoryURL(tc.raw)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("ParseRepositoryURL(%q) = %v, %v, want %v, %v", tc.raw, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package dbtest holds the conformance suite every db.PostRepo implementation
+// must pass, so handlers can rely on the same behaviour from any backend.
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"gitfeed/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var base = time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+
+// Post returns a complete, matchable post whose time_us is i seconds after a
+// fixed base time in the last hour.
+func Post(i int) db.DBPost {
+	created := base.Add(time.Duration(i) * time.Second)
+	return db.DBPost{
+		Did:        fmt.Sprintf("did:plc:author%d", i),
+		TimeUs:     created.UnixMicro(),
+		Kind:       "commit",
+		Rev:        fmt.Sprintf("rev%d", i),
+		Operation:  "create",
+		Collection: "app.bsky.feed.post",
+		Rkey:       fmt.Sprintf("rkey%d", i),
+		Cid:        fmt.Sprintf("cid%d", i),
+		Type:       "app.bsky.feed.post",
+		CreatedAt:  created,
+		Langs:      sql.Null[string]{V: "en", Valid: true},
+		Text:       fmt.Sprintf("post %d https://github.com/owner/repo%d", i, i),
+		URI:        fmt.Sprintf("https://github.com/owner/repo%d", i),
+		Languages:  []string{"en"},
+	}
+}
+
+func write(t *testing.T, repo db.PostRepo, posts ...db.DBPost) {
+	t.Helper()
+	for _, p := range posts {
+		require.NoError(t, repo.WritePost(p))
+	}
+}
+
+// stored checks the repository assigned p an ID and clears it, so p compares
+// equal to the post that was written.
+func stored(t *testing.T, p db.DBPost) db.DBPost {
+	t.Helper()
+	assert.NotZero(t, p.ID, "stored posts have an ID")
+	p.ID = 0
+	return p
+}
+
+func storedPosts(t *testing.T, posts []db.DBPost) []db.DBPost {
+	t.Helper()
+	cleared := make([]db.DBPost, len(posts))
+	for i, p := range posts {
+		cleared[i] = stored(t, p)
+	}
+	return cleared
+}
+
+var cases = []struct {
+	name string
+	run  func(t *testing.T, repo db.PostRepo)
+}{
+	{
+		name: "empty repository reports not found",
+		run: func(t *testing.T, repo db.PostRepo) {
+			_, err := repo.GetAllPosts()
+			assert.ErrorIs(t, err, db.ErrNotFound)
+			_, err = repo.GetTimeStamp()
+			assert.ErrorIs(t, err, db.ErrNotFound)
+			_, err = repo.GetPost("did:plc:nobody", "rkey1")
+			assert.ErrorIs(t, err, db.ErrNotFound)
+		},
+	},
+	{
+		name: "written posts round trip",
+		run: func(t *testing.T, repo db.PostRepo) {
+			want := Post(1)
+			want.Langs = sql.Null[string]{}
+			write(t, repo, want)
+
+			posts, err := repo.GetAllPosts()
+			require.NoError(t, err)
+			require.Len(t, posts, 1)
+			assert.Equal(t, want, stored(t, posts[0]))
+		},
+	},
+	{
+		name: "latest ten posts newest first",
+		run: func(t *testing.T, repo db.PostRepo) {
+			for _, i := range []int{5, 11, 0, 3, 8, 1, 10, 6, 2, 9, 4, 7} {
+				write(t, repo, Post(i))
+			}
+
+			posts, err := repo.GetAllPosts()
+			require.NoError(t, err)
+			var got []string
+			for _, p := range posts {
+				got = append(got, p.Rkey)
+			}
+			assert.Equal(t, []string{"rkey11", "rkey10", "rkey9", "rkey8", "rkey7", "rkey6", "rkey5", "rkey4", "rkey3", "rkey2"}, got)
+		},
+	},
+	{
+		name: "identical posts are listed once",
+		run: func(t *testing.T, repo db.PostRepo) {
+			write(t, repo, Post(1), Post(1), Post(2))
+
+			posts, err := repo.GetAllPosts()
+			require.NoError(t, err)
+			assert.Len(t, posts, 2)
+		},
+	},
+	{
+		name: "rewriting a record updates it in place",
+		run: func(t *testing.T, repo db.PostRepo) {
+			edited := Post(1)
+			edited.TimeUs = Post(5).TimeUs
+			edited.Operation = "update"
+			edited.Rev = "rev-edited"
+			edited.Cid = "cid-edited"
+			edited.Text = "edited https://github.com/owner/other"
+			edited.URI = "https://github.com/owner/other"
+			write(t, repo, Post(1), Post(2), edited)
+
+			posts, err := repo.GetAllPosts()
+			require.NoError(t, err)
+			require.Len(t, posts, 2)
+
+			want := Post(1)
+			want.Operation, want.Rev, want.Cid = edited.Operation, edited.Rev, edited.Cid
+			want.Text, want.URI = edited.Text, edited.URI
+			assert.Equal(t, want, stored(t, posts[1]), "edits keep the original time_us")
+		},
+	},
+	{
+		name: "rewriting a record updates its reply references",
+		run: func(t *testing.T, repo db.PostRepo) {
+			reply := Post(3)
+			reply.ParentURI, reply.ParentCid = "at://did:plc:author1/app.bsky.feed.post/rkey1", "cid1"
+			reply.RootURI, reply.RootCid = reply.ParentURI, reply.ParentCid
+			edited := reply
+			edited.ParentURI, edited.ParentCid = "at://did:plc:author2/app.bsky.feed.post/rkey2", "cid2"
+			edited.RootURI, edited.RootCid = "at://did:plc:author1/app.bsky.feed.post/rkey1", "cid1"
+			write(t, repo, reply, edited)
+
+			post, err := repo.GetPost(reply.Did, reply.Rkey)
+			require.NoError(t, err)
+			assert.Equal(t, edited, stored(t, *post))
+		},
+	},
+	{
+		name: "posts keep every language and filter by any of them",
+		run: func(t *testing.T, repo db.PostRepo) {
+			multi, detected := Post(1), Post(2)
+			multi.Languages = []string{"pt", "en"}
+			detected.Languages, detected.LanguagesDetected = []string{"de"}, true
+			detected.Langs = sql.Null[string]{}
+			write(t, repo, multi, detected, Post(3))
+
+			posts, err := repo.GetPosts(db.PostFilter{Lang: "en"})
+			require.NoError(t, err)
+			require.Len(t, posts, 2)
+			assert.Equal(t, Post(3), stored(t, posts[0]))
+			assert.Equal(t, multi, stored(t, posts[1]))
+
+			posts, err = repo.GetPosts(db.PostFilter{Lang: "de"})
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{detected}, storedPosts(t, posts))
+
+			_, err = repo.GetPosts(db.PostFilter{Lang: "fr"})
+			assert.ErrorIs(t, err, db.ErrNotFound)
+		},
+	},
+	{
+		name: "posts filter by linked repository",
+		run: func(t *testing.T, repo db.PostRepo) {
+			codeberg := Post(3)
+			codeberg.URI = "https://codeberg.org/Owner/repo1"
+			write(t, repo, Post(1), Post(2), codeberg)
+
+			posts, err := repo.GetPosts(db.PostFilter{Owner: "owner", Name: "repo1"})
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{codeberg, Post(1)}, storedPosts(t, posts))
+
+			posts, err = repo.GetPosts(db.PostFilter{Forge: "github", Name: "repo1"})
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{Post(1)}, storedPosts(t, posts))
+
+			_, err = repo.GetPosts(db.PostFilter{Forge: "gitlab"})
+			assert.ErrorIs(t, err, db.ErrNotFound)
+		},
+	},
+	{
+		name: "posts after a cursor page forward oldest first",
+		run: func(t *testing.T, repo db.PostRepo) {
+			german := Post(4)
+			german.Languages = []string{"de"}
+			write(t, repo, Post(3), german, Post(1), Post(2), Post(5))
+
+			posts, err := repo.GetPostsAfter(db.PostCursor{}, db.PostFilter{}, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{Post(1), Post(2)}, storedPosts(t, posts))
+
+			posts, err = repo.GetPostsAfter(posts[1].Cursor(), db.PostFilter{Lang: "en"}, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{Post(3), Post(5)}, storedPosts(t, posts))
+
+			posts, err = repo.GetPostsAfter(posts[1].Cursor(), db.PostFilter{}, 10)
+			require.NoError(t, err)
+			assert.Empty(t, posts)
+		},
+	},
+	{
+		name: "posts before a time page back newest first",
+		run: func(t *testing.T, repo db.PostRepo) {
+			german := Post(2)
+			german.Languages = []string{"de"}
+			write(t, repo, Post(3), german, Post(1), Post(4), Post(5))
+
+			posts, err := repo.GetPostsBefore(db.PostCursor{}, db.PostFilter{}, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{Post(5), Post(4)}, storedPosts(t, posts))
+
+			posts, err = repo.GetPostsBefore(db.PostCursor{TimeUs: Post(4).TimeUs}, db.PostFilter{Lang: "en"}, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []db.DBPost{Post(3), Post(1)}, storedPosts(t, posts))
+
+			posts, err = repo.GetPostsBefore(db.PostCursor{TimeUs: Post(1).TimeUs}, db.PostFilter{}, 10)
+			require.NoError(t, err)
+			assert.Empty(t, posts)
+		},
+	},
+	{
+		name: "paging forward does not skip posts sharing a time",
+		run: func(t *testing.T, repo db.PostRepo) {
+			for i := 1; i <= 5; i++ {
+				p := Post(i)
+				p.TimeUs = Post(0).TimeUs
+				write(t, repo, p)
+			}
+
+			var got []string
+			var after db.PostCursor
+			for page := 0; page < 5; page++ {
+				posts, err := repo.GetPostsAfter(after, db.PostFilter{}, 2)
+				require.NoError(t, err)
+				if len(posts) == 0 {
+					break
+				}
+				for _, p := range posts {
+					got = append(got, p.Rkey)
+				}
+				after = posts[len(posts)-1].Cursor()
+			}
+			assert.Equal(t, []string{"rkey1", "rkey2", "rkey3", "rkey4", "rkey5"}, got)
+		},
+	},
+	{
+		name: "paging back does not skip posts sharing a time",
+		run: func(t *testing.T, repo db.PostRepo) {
+			for i := 1; i <= 5; i++ {
+				p := Post(i)
+				p.TimeUs = Post(0).TimeUs
+				write(t, repo, p)
+			}
+
+			var got []string
+			var before db.PostCursor
+			for page := 0; page < 5; page++ {
+				posts, err := repo.GetPostsBefore(before, db.PostFilter{}, 2)
+				require.NoError(t, err)
+				if len(posts) == 0 {
+					break
+				}
+				for _, p := range posts {
+					got = append(got, p.Rkey)
+				}
+				before = posts[len(posts)-1].Cursor()
+			}
+			assert.Equal(t, []string{"rkey5", "rkey4", "rkey3", "rkey2", "rkey1"}, got)
+		},
+	},
+	{
+		name: "timestamp is the newest post",
+		run: func(t *testing.T, repo db.PostRepo) {
+			write(t, repo, Post(3), Post(7), Post(5))
+
+			ts, err := repo.GetTimeStamp()
+			require.NoError(t, err)
+			assert.Equal(t, Post(7).TimeUs, ts)
+		},
+	},
+	{
+		name: "get post finds the record by author and rkey",
+		run: func(t *testing.T, repo db.PostRepo) {
+			older, newer := Post(1), Post(2)
+			newer.Did = older.Did
+			reply := Post(3)
+			reply.ParentURI, reply.ParentCid = "at://did:plc:author1/app.bsky.feed.post/rkey1", "cid1"
+			reply.RootURI, reply.RootCid = reply.ParentURI, reply.ParentCid
+			// Records in other collections can share a post's rkey.
+			repost := Post(4)
+			repost.Did, repost.Rkey = older.Did, older.Rkey
+			repost.Collection, repost.Type = "app.bsky.feed.repost", "app.bsky.feed.repost"
+			write(t, repo, newer, older, reply, repost)
+
+			post, err := repo.GetPost(older.Did, older.Rkey)
+			require.NoError(t, err)
+			assert.Equal(t, older, stored(t, *post))
+			post, err = repo.GetPost(reply.Did, reply.Rkey)
+			require.NoError(t, err)
+			assert.Equal(t, reply, stored(t, *post), "reply references round trip")
+
+			_, err = repo.GetPost(older.Did, Post(3).Rkey)
+			assert.ErrorIs(t, err, db.ErrNotFound)
+			_, err = repo.GetPost("did:plc:nobody", older.Rkey)
+			assert.ErrorIs(t, err, db.ErrNotFound)
+		},
+	},
+	{
+		name: "delete post removes only that record",
+		run: func(t *testing.T, repo db.PostRepo) {
+			sibling := Post(2)
+			sibling.Did = Post(1).Did
+			write(t, repo, Post(1), sibling)
+
+			// Records in other collections can reuse a post's rkey.
+			require.NoError(t, repo.DeletePost(sibling.Did, "app.bsky.feed.threadgate", sibling.Rkey))
+			require.NoError(t, repo.DeletePost(Post(1).Did, Post(1).Collection, Post(1).Rkey))
+			require.NoError(t, repo.DeletePost("did:plc:nobody", db.PostCollection, "missing"))
+
+			posts, err := repo.GetAllPosts()
+			require.NoError(t, err)
+			require.Len(t, posts, 1)
+			assert.Equal(t, sibling.Rkey, posts[0].Rkey)
+		},
+	},
+	{
+		name: "retention drops only expired posts",
+		run: func(t *testing.T, repo db.PostRepo) {
+			expired := Post(1)
+			expired.TimeUs = time.Now().Add(-db.Retention - time.Hour).UnixMicro()
+			write(t, repo, expired, Post(2))
+
+			require.NoError(t, repo.DeletePosts())
+
+			posts, err := repo.GetAllPosts()
+			require.NoError(t, err)
+			require.Len(t, posts, 1)
+			assert.Equal(t, Post(2).Rkey, posts[0].Rkey)
+		},
+	},
+}
+
+// Run checks that repositories returned by newRepo behave like a PostRepo.
+// newRepo is called once per case and must return an empty repository.
+func Run(t *testing.T, newRepo func(t *testing.T) db.PostRepo) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newRepo(t))
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Link is one repository a post mentions.
+type Link struct {
+	Did    string
+	Rkey   string
+	TimeUs int64
+	URL    string
+	Forge  string
+	Owner  string
+	Name   string
+}
+
+// ExportRepo streams stored rows for posts created in [since, until), calling
+// fn once per row. Rows are never collected in memory; an error from fn stops
+// the export and is returned as is.
+type ExportRepo interface {
+	ExportPosts(since, until int64, fn func(DBPost) error) error
+	ExportLinks(since, until int64, fn func(Link) error) error
+	ExportRepositories(since, until int64, fn func(RepositoryMentions) error) error
+}
+
+func (pr *PostRepository) ExportPosts(since, until int64, fn func(DBPost) error) error {
+	sqlStmt := `SELECT ` + postColumns + `
+	FROM posts p
+	WHERE p.time_us >= $1 AND p.time_us < $2
+	ORDER BY p.time_us`
+
+	return pr.export(sqlStmt, since, until, func(rows *sql.Rows) error {
+		p, err := scanPost(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning post: %w", err)
+		}
+		return fn(p)
+	})
+}
+
+func (pr *PostRepository) ExportLinks(since, until int64, fn func(Link) error) error {
+	sqlStmt := `SELECT p.did, p.commit_rkey, p.time_us, pr.url, r.forge, r.owner, r.name
+	FROM post_repositories pr
+	JOIN posts p ON p.id = pr.post_id
+	JOIN repositories r ON r.id = pr.repository_id
+	WHERE p.time_us >= $1 AND p.time_us < $2
+	ORDER BY p.time_us`
+
+	return pr.export(sqlStmt, since, until, func(rows *sql.Rows) error {
+		var l Link
+		if err := rows.Scan(&l.Did, &l.Rkey, &l.TimeUs, &l.URL, &l.Forge, &l.Owner, &l.Name); err != nil {
+			return fmt.Errorf("error scanning link: %w", err)
+		}
+		return fn(l)
+	})
+}
+
+func (pr *PostRepository) ExportRepositories(since, until int64, fn func(RepositoryMentions) error) error {
+	sqlStmt := `SELECT r.id, r.forge, r.owner, r.name, r.first_seen, r.last_seen,
+		r.mention_count, r.distinct_authors,
+		COUNT(*) AS mentions, COUNT(DISTINCT p.did) AS authors
+	FROM repositories r
+	JOIN post_repositories pr ON pr.repository_id = r.id
+	JOIN posts p ON p.id = pr.post_id
+	WHERE p.time_us >= $1 AND p.time_us < $2
+	GROUP BY r.id
+	ORDER BY mentions DESC, r.id`
+
+	return pr.export(sqlStmt, since, until, func(rows *sql.Rows) error {
+		var r RepositoryMentions
+		err := rows.Scan(
+			&r.ID,
+			&r.Forge,
+			&r.Owner,
+			&r.Name,
+			&r.FirstSeen,
+			&r.LastSeen,
+			&r.MentionCount,
+			&r.DistinctAuthors,
+			&r.Mentions,
+			&r.Authors,
+		)
+		if err != nil {
+			return fmt.Errorf("error scanning repository: %w", err)
+		}
+		return fn(r)
+	})
+}
+
+func (pr *PostRepository) export(sqlStmt string, since, until int64, each func(*sql.Rows) error) error {
+	rows, err := pr.reader.Query(sqlStmt, since, until)
+	if err != nil {
+		return fmt.Errorf("error querying export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := each(rows); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating export: %w", err)
+	}
+	return nil
+}
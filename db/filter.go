@@ -0,0 +1,126 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PostFilter narrows listings to matching posts. The zero value matches every post.
+type PostFilter struct {
+	// Lang is a normalized primary language subtag such as "en".
+	Lang string
+	// Forge, Owner and Name match the repository a post links to. Owner and
+	// Name are lowercase, like stored repositories.
+	Forge string
+	Owner string
+	Name  string
+}
+
+// where returns SQL conditions on posts aliased as p, numbering its
+// parameters from $1.
+func (f PostFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.Lang != "" {
+		args = append(args, f.Lang)
+		conds = append(conds, fmt.Sprintf(
+			`EXISTS (SELECT 1 FROM post_langs l WHERE l.post_id = p.id AND l.lang = $%d)`, len(args)))
+	}
+
+	var repoConds []string
+	for _, c := range []struct{ column, value string }{
+		{"r.forge", f.Forge}, {"r.owner", f.Owner}, {"r.name", f.Name},
+	} {
+		if c.value != "" {
+			args = append(args, c.value)
+			repoConds = append(repoConds, fmt.Sprintf(`%s = $%d`, c.column, len(args)))
+		}
+	}
+	if len(repoConds) > 0 {
+		conds = append(conds, `EXISTS (SELECT 1 FROM post_repositories pr
+			JOIN repositories r ON r.id = pr.repository_id
+			WHERE pr.post_id = p.id AND `+strings.Join(repoConds, " AND ")+`)`)
+	}
+
+	if len(conds) == 0 {
+		return "true", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// Match reports whether a post passes the filter, for repositories that
+// filter in memory.
+func (f PostFilter) Match(p DBPost) bool {
+	if f.Lang != "" {
+		found := false
+		for _, lang := range p.Languages {
+			found = found || lang == f.Lang
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Forge != "" || f.Owner != "" || f.Name != "" {
+		repo, ok := ParseRepositoryURL(p.URI)
+		if !ok || (f.Forge != "" && repo.Forge != f.Forge) ||
+			(f.Owner != "" && repo.Owner != f.Owner) || (f.Name != "" && repo.Name != f.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// PostCursor is where a newest-first page of posts ended. Posts sharing a
+// time_us are told apart by ID, so paging never skips any of them.
+type PostCursor struct {
+	TimeUs int64
+	ID     int64
+}
+
+// Cursor is the cursor continuing after p.
+func (p DBPost) Cursor() PostCursor {
+	return PostCursor{TimeUs: p.TimeUs, ID: p.ID}
+}
+
+// IsZero reports whether c starts from the newest post.
+func (c PostCursor) IsZero() bool {
+	return c == PostCursor{}
+}
+
+// Before reports whether p comes after the cursor in newest-first order.
+func (c PostCursor) Before(p DBPost) bool {
+	return c.IsZero() || p.Cursor().Less(c)
+}
+
+// After reports whether p comes after the cursor in oldest-first order. The
+// zero cursor is before every post.
+func (c PostCursor) After(p DBPost) bool {
+	return c.Less(p.Cursor())
+}
+
+// Less reports whether c comes before o in oldest-first order.
+func (c PostCursor) Less(o PostCursor) bool {
+	return c.TimeUs < o.TimeUs || (c.TimeUs == o.TimeUs && c.ID < o.ID)
+}
+
+func (c PostCursor) String() string {
+	return fmt.Sprintf("%d_%d", c.TimeUs, c.ID)
+}
+
+// ParsePostCursor reads a cursor from String. A bare time_us, the older form,
+// continues before every post at that time.
+func ParsePostCursor(s string) (PostCursor, error) {
+	timeUs, id, found := strings.Cut(s, "_")
+	var c PostCursor
+	var err error
+	if c.TimeUs, err = strconv.ParseInt(timeUs, 10, 64); err != nil || c.TimeUs <= 0 {
+		return PostCursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	if found {
+		if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil || c.ID <= 0 {
+			return PostCursor{}, fmt.Errorf("invalid cursor %q", s)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CachedResponse is a GitHub API response, kept so cards don't call GitHub on
+// every render. Path is the API path it answers, e.g. /repos/owner/name.
+// Status is 404 for things that don't exist.
+type CachedResponse struct {
+	Path      string
+	Status    int
+	ETag      string
+	Body      []byte
+	FetchedAt int64
+}
+
+type GitHubCacheRepo interface {
+	GetCachedResponse(path string) (CachedResponse, error)
+	PutCachedResponse(c CachedResponse) error
+}
+
+// createGitHubCache keys the cache by API path so it can hold issues,
+// releases, commits and gists as well as repositories.
+func createGitHubCache(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS github_responses (
+            path TEXT PRIMARY KEY,
+            status INTEGER NOT NULL,
+            etag TEXT NOT NULL DEFAULT '',
+            body BLOB,
+            fetched_at INTEGER NOT NULL
+        ) WITHOUT ROWID;
+        CREATE INDEX IF NOT EXISTS github_responses_fetched_at ON github_responses(fetched_at);`)
+	return err
+}
+
+func (pr *PostRepository) GetCachedResponse(path string) (CachedResponse, error) {
+	c := CachedResponse{Path: path}
+	err := pr.reader.QueryRow(`SELECT status, etag, body, fetched_at FROM github_responses
+	WHERE path = $1`, path).Scan(&c.Status, &c.ETag, &c.Body, &c.FetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, fmt.Errorf("no cached response for %s: %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return c, fmt.Errorf("error querying cached response: %w", err)
+	}
+	return c, nil
+}
+
+func (pr *PostRepository) PutCachedResponse(c CachedResponse) error {
+	err := pr.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO github_responses (path, status, etag, body, fetched_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (path) DO UPDATE SET
+			status = excluded.status, etag = excluded.etag, body = excluded.body, fetched_at = excluded.fetched_at`,
+			c.Path, c.Status, c.ETag, c.Body, c.FetchedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not cache %s: %w", c.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ImportRepo stores historical posts without disturbing the ones ingest has
+// already written.
+type ImportRepo interface {
+	ImportPosts(posts []DBPost) (int, error)
+	DeletePost(did, collection, rkey string) error
+}
+
+// importPostStmt inserts a post only if the record isn't stored yet; the row
+// already there is at least as recent as anything in an archive.
+const importPostStmt = insertPostValues + `
+ON CONFLICT (did, commit_collection, commit_rkey) DO NOTHING
+RETURNING id, time_us`
+
+// ImportPosts writes posts in a single transaction and returns how many were
+// new. Records that are already stored are left alone.
+func (pr *PostRepository) ImportPosts(posts []DBPost) (int, error) {
+	var inserted int
+	err := pr.write(func(tx *sql.Tx) error {
+		inserted = 0
+		stmt, err := tx.Prepare(importPostStmt)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, p := range posts {
+			var postID, timeUs int64
+			err := stmt.QueryRow(
+				p.Did,
+				p.TimeUs,
+				p.Kind,
+				p.Rev,
+				p.Operation,
+				p.Collection,
+				p.Rkey,
+				p.Cid,
+				p.Type,
+				p.CreatedAt,
+				p.Langs,
+				p.Text,
+				p.URI,
+				p.ParentURI,
+				p.ParentCid,
+				p.RootURI,
+				p.RootCid).Scan(&postID, &timeUs)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := linkRepository(tx, postID, timeUs, p.URI); err != nil {
+				return err
+			}
+			if err := setPostLangs(tx, postID, p.Languages, p.LanguagesDetected); err != nil {
+				return err
+			}
+			if err := rollUpPost(tx, postID, p.Languages); err != nil {
+				return err
+			}
+			if err := logChange(tx, PostWritten, p.Did, p.Rkey, timeUs); err != nil {
+				return err
+			}
+			inserted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not import posts: %w", err)
+	}
+	return inserted, nil
+}
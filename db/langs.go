@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql"
+	"gitfeed/langdetect"
+	"log"
+)
+
+func createPostLangs(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS post_langs (
+            post_id INTEGER NOT NULL,
+            position INTEGER NOT NULL,
+            lang TEXT NOT NULL,
+            detected INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (post_id, lang)
+        ) WITHOUT ROWID;
+        CREATE INDEX IF NOT EXISTS post_langs_lang ON post_langs(lang, post_id);`)
+	if err != nil {
+		return err
+	}
+
+	// Only the first declared language was kept before this table existed.
+	rows, err := tx.Query(`SELECT id, record_langs FROM posts WHERE record_langs IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	langs := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var lang string
+		if err := rows.Scan(&id, &lang); err != nil {
+			rows.Close()
+			return err
+		}
+		if lang = langdetect.Normalize(lang); lang != "" {
+			langs[id] = lang
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, lang := range langs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO post_langs (post_id, position, lang) VALUES ($1, 0, $2)`,
+			id, lang); err != nil {
+			return err
+		}
+	}
+	log.Printf("Stored languages for %d existing posts", len(langs))
+	return nil
+}
+
+// setPostLangs replaces a post's languages, keeping their order.
+func setPostLangs(tx *sql.Tx, postID int64, langs []string, detected bool) error {
+	if _, err := tx.Exec(`DELETE FROM post_langs WHERE post_id = $1`, postID); err != nil {
+		return err
+	}
+	for i, lang := range langs {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO post_langs (post_id, position, lang, detected) VALUES ($1, $2, $3, $4)`,
+			postID, i, lang, detected)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryPostRepository is a PostRepo held in memory. It behaves like the SQLite
+// repository, so handlers can be tested without a database file.
+type MemoryPostRepository struct {
+	mu     sync.RWMutex
+	posts  []DBPost
+	nextID int64
+}
+
+func NewMemoryPostRepository() *MemoryPostRepository {
+	return &MemoryPostRepository{}
+}
+
+func (mr *MemoryPostRepository) GetPost(did, rkey string) (*DBPost, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	for _, p := range mr.posts {
+		if p.Did == did && p.Collection == PostCollection && p.Rkey == rkey {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("no post found at %s/%s: %w", did, rkey, ErrNotFound)
+}
+
+func (mr *MemoryPostRepository) WritePost(p DBPost) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for i, existing := range mr.posts {
+		if existing.Did == p.Did && existing.Collection == p.Collection && existing.Rkey == p.Rkey {
+			existing.Rev = p.Rev
+			existing.Operation = p.Operation
+			existing.Cid = p.Cid
+			existing.Langs = p.Langs
+			existing.Languages = p.Languages
+			existing.LanguagesDetected = p.LanguagesDetected
+			existing.Text = p.Text
+			existing.URI = p.URI
+			existing.ParentURI, existing.ParentCid = p.ParentURI, p.ParentCid
+			existing.RootURI, existing.RootCid = p.RootURI, p.RootCid
+			mr.posts[i] = existing
+			return nil
+		}
+	}
+
+	// Drop the monotonic clock reading, which doesn't survive a database round trip.
+	p.CreatedAt = p.CreatedAt.Round(0)
+	mr.nextID++
+	p.ID = mr.nextID
+	mr.posts = append(mr.posts, p)
+	return nil
+}
+
+func (mr *MemoryPostRepository) DeletePost(did, collection, rkey string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.deleteWhere(func(p DBPost) bool { return p.Did == did && p.Collection == collection && p.Rkey == rkey })
+	return nil
+}
+
+func (mr *MemoryPostRepository) DeletePosts() error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	cutoff := time.Now().Add(-Retention).UnixMicro()
+	mr.deleteWhere(func(p DBPost) bool { return p.TimeUs < cutoff })
+	return nil
+}
+
+func (mr *MemoryPostRepository) deleteWhere(match func(DBPost) bool) {
+	kept := mr.posts[:0]
+	for _, p := range mr.posts {
+		if !match(p) {
+			kept = append(kept, p)
+		}
+	}
+	mr.posts = kept
+}
+
+func (mr *MemoryPostRepository) GetAllPosts() ([]DBPost, error) {
+	return mr.GetPosts(PostFilter{})
+}
+
+func (mr *MemoryPostRepository) GetPosts(filter PostFilter) ([]DBPost, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var posts []DBPost
+	for _, p := range mr.posts {
+		if filter.Match(p) {
+			posts = append(posts, p)
+		}
+	}
+	if len(posts) == 0 {
+		return nil, fmt.Errorf("no posts found: %w", ErrNotFound)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].TimeUs > posts[j].TimeUs })
+	if len(posts) > 10 {
+		posts = posts[:10]
+	}
+	return posts, nil
+}
+
+func (mr *MemoryPostRepository) GetPostsAfter(after PostCursor, filter PostFilter, limit int) ([]DBPost, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var posts []DBPost
+	for _, p := range mr.posts {
+		if after.After(p) && filter.Match(p) {
+			posts = append(posts, p)
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool { return posts[i].Cursor().Less(posts[j].Cursor()) })
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+func (mr *MemoryPostRepository) GetPostsBefore(before PostCursor, filter PostFilter, limit int) ([]DBPost, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var posts []DBPost
+	for _, p := range mr.posts {
+		if before.Before(p) && filter.Match(p) {
+			posts = append(posts, p)
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool { return posts[i].Cursor().Before(posts[j]) })
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+func (mr *MemoryPostRepository) GetTimeStamp() (int64, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	if len(mr.posts) == 0 {
+		return 0, fmt.Errorf("no posts found: %w", ErrNotFound)
+	}
+	var timeUs int64
+	for _, p := range mr.posts {
+		timeUs = max(timeUs, p.TimeUs)
+	}
+	return timeUs, nil
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RepositoryMetadata is what GitHub reported about a repository when it was
+// last fetched. Status is the response status: 200, or 404 for repositories
+// GitHub doesn't have.
+type RepositoryMetadata struct {
+	Repository
+	Description string   `json:"description"`
+	Stars       int64    `json:"stars"`
+	Forks       int64    `json:"forks"`
+	Language    string   `json:"language"`
+	Topics      []string `json:"topics"`
+	License     string   `json:"license"`
+	Archived    bool     `json:"archived"`
+	Status      int      `json:"-"`
+	ETag        string   `json:"-"`
+	FetchedAt   int64    `json:"fetched_at"`
+}
+
+// RepositoryQuery filters and orders enriched repositories.
+type RepositoryQuery struct {
+	Language string
+	Topic    string
+	// Sort is one of stars, forks, mentions or last_seen, all descending.
+	Sort  string
+	Limit int
+}
+
+var repositorySorts = map[string]string{
+	"stars":     "m.stars",
+	"forks":     "m.forks",
+	"mentions":  "r.mention_count",
+	"last_seen": "r.last_seen",
+}
+
+var ErrBadSort = errors.New("sort must be stars, forks, mentions or last_seen")
+
+type MetadataRepo interface {
+	// GetRepositoriesToEnrich returns GitHub repositories seen since seenSince
+	// that have no metadata, then those fetched before fetchedBefore, most
+	// mentioned first.
+	GetRepositoriesToEnrich(seenSince, fetchedBefore int64, limit int) ([]RepositoryMetadata, error)
+	PutRepositoryMetadata(m RepositoryMetadata) error
+	GetRepositories(q RepositoryQuery) ([]RepositoryMetadata, error)
+	GetRepositoryHistory(owner, name string, since, until int64) ([]HistoryBucket, error)
+}
+
+func createRepositoryMetadata(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS repository_metadata (
+            repository_id INTEGER PRIMARY KEY,
+            description TEXT NOT NULL DEFAULT '',
+            stars INTEGER NOT NULL DEFAULT 0,
+            forks INTEGER NOT NULL DEFAULT 0,
+            language TEXT NOT NULL DEFAULT '',
+            topics TEXT NOT NULL DEFAULT '[]',
+            license TEXT NOT NULL DEFAULT '',
+            archived INTEGER NOT NULL DEFAULT 0,
+            status INTEGER NOT NULL,
+            etag TEXT NOT NULL DEFAULT '',
+            fetched_at INTEGER NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS repository_metadata_fetched_at ON repository_metadata(fetched_at);
+        CREATE INDEX IF NOT EXISTS repository_metadata_language ON repository_metadata(language);
+        CREATE TABLE IF NOT EXISTS repository_topics (
+            repository_id INTEGER NOT NULL,
+            topic TEXT NOT NULL,
+            PRIMARY KEY (topic, repository_id)
+        ) WITHOUT ROWID;`)
+	return err
+}
+
+const metadataColumns = `r.id, r.forge, r.owner, r.name, r.first_seen, r.last_seen, r.mention_count, r.distinct_authors,
+	COALESCE(m.description, ''), COALESCE(m.stars, 0), COALESCE(m.forks, 0), COALESCE(m.language, ''),
+	COALESCE(m.topics, '[]'), COALESCE(m.license, ''), COALESCE(m.archived, 0), COALESCE(m.status, 0),
+	COALESCE(m.etag, ''), COALESCE(m.fetched_at, 0)`
+
+func scanMetadata(row scanner) (RepositoryMetadata, error) {
+	var m RepositoryMetadata
+	var topics string
+	err := row.Scan(&m.ID, &m.Forge, &m.Owner, &m.Name, &m.FirstSeen, &m.LastSeen, &m.MentionCount, &m.DistinctAuthors,
+		&m.Description, &m.Stars, &m.Forks, &m.Language, &topics, &m.License, &m.Archived, &m.Status, &m.ETag, &m.FetchedAt)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal([]byte(topics), &m.Topics); err != nil {
+		return m, fmt.Errorf("error decoding topics: %w", err)
+	}
+	return m, nil
+}
+
+func (pr *PostRepository) queryMetadata(query string, args ...any) ([]RepositoryMetadata, error) {
+	rows, err := pr.reader.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying repository metadata: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []RepositoryMetadata
+	for rows.Next() {
+		m, err := scanMetadata(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning repository metadata: %w", err)
+		}
+		repos = append(repos, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating repository metadata: %w", err)
+	}
+	return repos, nil
+}
+
+func (pr *PostRepository) GetRepositoriesToEnrich(seenSince, fetchedBefore int64, limit int) ([]RepositoryMetadata, error) {
+	return pr.queryMetadata(`SELECT `+metadataColumns+`
+	FROM repositories r
+	LEFT JOIN repository_metadata m ON m.repository_id = r.id
+	WHERE r.forge = 'github' AND r.last_seen >= $1 AND (m.fetched_at IS NULL OR m.fetched_at < $2)
+	ORDER BY m.fetched_at IS NULL DESC, r.mention_count DESC, r.last_seen DESC
+	LIMIT $3`, seenSince, fetchedBefore, limit)
+}
+
+func (pr *PostRepository) PutRepositoryMetadata(m RepositoryMetadata) error {
+	topics, err := json.Marshal(m.Topics)
+	if err != nil {
+		return err
+	}
+	if m.Topics == nil {
+		topics = []byte("[]")
+	}
+	err = pr.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO repository_metadata
+			(repository_id, description, stars, forks, language, topics, license, archived, status, etag, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (repository_id) DO UPDATE SET
+			description = excluded.description, stars = excluded.stars, forks = excluded.forks,
+			language = excluded.language, topics = excluded.topics, license = excluded.license,
+			archived = excluded.archived, status = excluded.status, etag = excluded.etag,
+			fetched_at = excluded.fetched_at`,
+			m.ID, m.Description, m.Stars, m.Forks, m.Language, string(topics), m.License, m.Archived,
+			m.Status, m.ETag, m.FetchedAt)
+		if err != nil {
+			return err
+		}
+		if m.Status == 200 {
+			if err := snapshotStars(tx, m); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM repository_topics WHERE repository_id = $1`, m.ID); err != nil {
+			return err
+		}
+		for _, topic := range m.Topics {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO repository_topics (repository_id, topic) VALUES ($1, $2)`,
+				m.ID, strings.ToLower(topic)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not store metadata for %s/%s: %w", m.Owner, m.Name, err)
+	}
+	return nil
+}
+
+// GetRepositories lists repositories GitHub has metadata for.
+func (pr *PostRepository) GetRepositories(q RepositoryQuery) ([]RepositoryMetadata, error) {
+	order, ok := repositorySorts[q.Sort]
+	if !ok {
+		return nil, ErrBadSort
+	}
+	where := `m.status = 200`
+	var args []any
+	if q.Language != "" {
+		args = append(args, q.Language)
+		where += fmt.Sprintf(` AND m.language = $%d COLLATE NOCASE`, len(args))
+	}
+	if q.Topic != "" {
+		args = append(args, strings.ToLower(q.Topic))
+		where += fmt.Sprintf(` AND EXISTS (
+			SELECT 1 FROM repository_topics t WHERE t.repository_id = r.id AND t.topic = $%d)`, len(args))
+	}
+	args = append(args, q.Limit)
+	return pr.queryMetadata(`SELECT `+metadataColumns+`
+	FROM repositories r
+	JOIN repository_metadata m ON m.repository_id = r.id
+	WHERE `+where+`
+	ORDER BY `+order+` DESC, r.id DESC
+	LIMIT $`+fmt.Sprint(len(args)), args...)
+}
@@ -0,0 +1,400 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type Repository struct {
+	ID              int64  `json:"id"`
+	Forge           string `json:"forge"`
+	Owner           string `json:"owner"`
+	Name            string `json:"name"`
+	FirstSeen       int64  `json:"first_seen"`
+	LastSeen        int64  `json:"last_seen"`
+	MentionCount    int64  `json:"mention_count"`
+	DistinctAuthors int64  `json:"distinct_authors"`
+}
+
+// RepositoryMentions is a repository with the mentions and authors counted
+// inside a time window rather than over every stored post.
+type RepositoryMentions struct {
+	Repository
+	Mentions int64 `json:"mentions"`
+	Authors  int64 `json:"authors"`
+}
+
+// Sharer is an account that posted a repository link.
+type Sharer struct {
+	Did         string `json:"did"`
+	Posts       int64  `json:"posts"`
+	FirstShared int64  `json:"first_shared"`
+}
+
+// Owner totals every stored repository under one account or organization.
+// Mentions and Sharers count stored posts, like MentionCount and
+// DistinctAuthors do for a single repository.
+type Owner struct {
+	Forge        string `json:"forge"`
+	Owner        string `json:"owner"`
+	Repositories int64  `json:"repositories"`
+	Mentions     int64  `json:"mentions"`
+	Sharers      int64  `json:"sharers"`
+	Stars        int64  `json:"stars"`
+	FirstSeen    int64  `json:"first_seen"`
+	LastSeen     int64  `json:"last_seen"`
+}
+
+type RepositoryRepo interface {
+	// GetRepositoryPosts pages through a repository's posts newest first,
+	// starting before the cursor, or from the newest when it's zero.
+	GetRepositoryPosts(forge, owner, name string, before PostCursor, limit int) ([]DBPost, error)
+	GetTopRepositories(since, until int64, limit int) ([]RepositoryMentions, error)
+	GetRepository(forge, owner, name string) (RepositoryMetadata, error)
+	GetRepositorySharers(forge, owner, name string, limit int) ([]Sharer, error)
+	GetRepositoryTimeseries(g Granularity, forge, owner, name string, since, until int64) ([]RepositoryBucket, error)
+	GetOwner(forge, owner string) (Owner, error)
+	GetOwnerRepositories(forge, owner string, limit int) ([]RepositoryMetadata, error)
+	GetOwnerTimeseries(g Granularity, forge, owner string, since, until int64) ([]RepositoryBucket, error)
+}
+
+var forgeHosts = map[string]string{
+	"github.com":    "github",
+	"gitlab.com":    "gitlab",
+	"codeberg.org":  "codeberg",
+	"bitbucket.org": "bitbucket",
+}
+
+// Top-level paths, by forge, that look like owners but never hold
+// repositories.
+var reservedOwners = map[string]map[string]bool{
+	"github": {
+		"about": true, "apps": true, "collections": true, "enterprise": true,
+		"events": true, "explore": true, "features": true, "login": true,
+		"marketplace": true, "notifications": true, "orgs": true, "pricing": true,
+		"search": true, "settings": true, "sponsors": true, "topics": true,
+		"trending": true, "users": true,
+	},
+}
+
+var repoPathSegment = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+// ParseRepositoryURL normalizes a forge link into its forge, owner and name.
+// Owner and name are lowercased since forges treat them case-insensitively.
+func ParseRepositoryURL(raw string) (Repository, bool) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Repository{}, false
+	}
+
+	forge, ok := forgeHosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")]
+	if !ok {
+		return Repository{}, false
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return Repository{}, false
+	}
+	owner := strings.ToLower(segments[0])
+	name := strings.TrimSuffix(strings.ToLower(segments[1]), ".git")
+	if owner == "" || name == "" || reservedOwners[forge][owner] {
+		return Repository{}, false
+	}
+	if !repoPathSegment.MatchString(owner) || !repoPathSegment.MatchString(name) {
+		return Repository{}, false
+	}
+
+	return Repository{Forge: forge, Owner: owner, Name: name}, true
+}
+
+func (r Repository) URL() string {
+	for host, forge := range forgeHosts {
+		if forge == r.Forge {
+			return fmt.Sprintf("https://%s/%s/%s", host, r.Owner, r.Name)
+		}
+	}
+	return ""
+}
+
+// linkRepository records that a post mentions the repository behind uri and
+// refreshes that repository's aggregates. Links that aren't repositories are ignored.
+func linkRepository(tx *sql.Tx, postID int64, timeUs int64, uri string) error {
+	repo, ok := ParseRepositoryURL(uri)
+	if !ok {
+		return nil
+	}
+
+	var repoID int64
+	err := tx.QueryRow(`INSERT INTO repositories (forge, owner, name, first_seen, last_seen)
+	VALUES ($1, $2, $3, $4, $4)
+	ON CONFLICT (forge, owner, name) DO UPDATE SET
+		first_seen = MIN(first_seen, excluded.first_seen),
+		last_seen = MAX(last_seen, excluded.last_seen)
+	RETURNING id`,
+		repo.Forge, repo.Owner, repo.Name, timeUs).Scan(&repoID)
+	if err != nil {
+		return fmt.Errorf("could not upsert repository %s/%s: %w", repo.Owner, repo.Name, err)
+	}
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO post_repositories (post_id, repository_id, url) VALUES ($1, $2, $3)`,
+		postID, repoID, uri)
+	if err != nil {
+		return fmt.Errorf("could not link post to repository: %w", err)
+	}
+
+	return refreshRepositoryCounts(tx, repoID)
+}
+
+// relinkRepository replaces whatever repository a post linked to before with
+// the one behind uri, keeping both repositories' counts correct.
+func relinkRepository(tx *sql.Tx, postID int64, timeUs int64, uri string) error {
+	previous, err := queryIDs(tx, `SELECT repository_id FROM post_repositories WHERE post_id = $1`, postID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM post_repositories WHERE post_id = $1`, postID); err != nil {
+		return fmt.Errorf("could not unlink post: %w", err)
+	}
+	if err := linkRepository(tx, postID, timeUs, uri); err != nil {
+		return err
+	}
+	for _, id := range previous {
+		if err := refreshRepositoryCounts(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func refreshRepositoryCounts(tx *sql.Tx, repoID int64) error {
+	_, err := tx.Exec(`UPDATE repositories SET
+		mention_count = (SELECT COUNT(*) FROM post_repositories WHERE repository_id = $1),
+		distinct_authors = (
+			SELECT COUNT(DISTINCT p.did)
+			FROM post_repositories pr JOIN posts p ON p.id = pr.post_id
+			WHERE pr.repository_id = $1)
+	WHERE id = $1`, repoID)
+	if err != nil {
+		return fmt.Errorf("could not refresh repository counts: %w", err)
+	}
+	return nil
+}
+
+// postTables hold rows keyed by post_id that go when their post does.
+var postTables = []string{"post_repositories", "post_engagement", "post_langs"}
+
+// deletePostsWhere removes the posts matching where along with their repository
+// links, engagement and languages, then refreshes the counts of every repository
+// they mentioned.
+func deletePostsWhere(tx *sql.Tx, where string, args ...any) (int64, error) {
+	return deletePostsFrom(tx, postTables, where, args...)
+}
+
+// deletePostsFrom is deletePostsWhere for a given set of post tables, so
+// migrations can run before later tables exist.
+func deletePostsFrom(tx *sql.Tx, tables []string, where string, args ...any) (int64, error) {
+	repoIDs, err := queryIDs(tx, `SELECT DISTINCT repository_id FROM post_repositories
+	WHERE post_id IN (SELECT id FROM posts WHERE `+where+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range tables {
+		if _, err := tx.Exec(`DELETE FROM `+table+`
+		WHERE post_id IN (SELECT id FROM posts WHERE `+where+`)`, args...); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM posts WHERE `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range repoIDs {
+		if err := refreshRepositoryCounts(tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return res.RowsAffected()
+}
+
+func queryIDs(tx *sql.Tx, query string, args ...any) ([]int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (pr *PostRepository) GetRepositoryPosts(forge, owner, name string, before PostCursor, limit int) ([]DBPost, error) {
+	if before.IsZero() {
+		before = PostCursor{TimeUs: math.MaxInt64, ID: math.MaxInt64}
+	}
+	sqlStmt := `SELECT ` + postColumns + `
+	FROM posts p
+	JOIN post_repositories pr ON pr.post_id = p.id
+	JOIN repositories r ON r.id = pr.repository_id
+	WHERE r.forge = $1 AND r.owner = $2 AND r.name = $3 AND (p.time_us, p.id) < ($4, $5)
+	ORDER BY p.time_us DESC, p.id DESC LIMIT $6`
+
+	rows, err := pr.reader.Query(sqlStmt, forge, strings.ToLower(owner), strings.ToLower(name), before.TimeUs, before.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying repository posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []DBPost
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning post: %w", err)
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating posts: %w", err)
+	}
+	return posts, nil
+}
+
+func (pr *PostRepository) GetTopRepositories(since, until int64, limit int) ([]RepositoryMentions, error) {
+	sqlStmt := `SELECT r.id, r.forge, r.owner, r.name, r.first_seen, r.last_seen,
+		r.mention_count, r.distinct_authors,
+		COUNT(*) AS mentions, COUNT(DISTINCT p.did) AS authors
+	FROM repositories r
+	JOIN post_repositories pr ON pr.repository_id = r.id
+	JOIN posts p ON p.id = pr.post_id
+	WHERE p.time_us >= $1 AND p.time_us < $2
+	GROUP BY r.id
+	ORDER BY mentions DESC, authors DESC, r.last_seen DESC
+	LIMIT $3`
+
+	rows, err := pr.reader.Query(sqlStmt, since, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying top repositories: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []RepositoryMentions
+	for rows.Next() {
+		var r RepositoryMentions
+		err := rows.Scan(
+			&r.ID,
+			&r.Forge,
+			&r.Owner,
+			&r.Name,
+			&r.FirstSeen,
+			&r.LastSeen,
+			&r.MentionCount,
+			&r.DistinctAuthors,
+			&r.Mentions,
+			&r.Authors,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning repository: %w", err)
+		}
+		repos = append(repos, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating repositories: %w", err)
+	}
+	return repos, nil
+}
+
+// GetRepository returns a stored repository with whatever metadata has been
+// fetched for it.
+func (pr *PostRepository) GetRepository(forge, owner, name string) (RepositoryMetadata, error) {
+	m, err := scanMetadata(pr.reader.QueryRow(`SELECT `+metadataColumns+`
+	FROM repositories r
+	LEFT JOIN repository_metadata m ON m.repository_id = r.id
+	WHERE r.forge = $1 AND r.owner = $2 AND r.name = $3`, forge, strings.ToLower(owner), strings.ToLower(name)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, fmt.Errorf("no repository %s/%s/%s: %w", forge, owner, name, ErrNotFound)
+	}
+	if err != nil {
+		return m, fmt.Errorf("error querying repository: %w", err)
+	}
+	return m, nil
+}
+
+// GetRepositorySharers lists who posted a repository, most posts first.
+func (pr *PostRepository) GetRepositorySharers(forge, owner, name string, limit int) ([]Sharer, error) {
+	rows, err := pr.reader.Query(`SELECT p.did, COUNT(*) AS posts, MIN(p.time_us)
+	FROM posts p
+	JOIN post_repositories pr ON pr.post_id = p.id
+	JOIN repositories r ON r.id = pr.repository_id
+	WHERE r.forge = $1 AND r.owner = $2 AND r.name = $3
+	GROUP BY p.did
+	ORDER BY posts DESC, MIN(p.time_us)
+	LIMIT $4`, forge, strings.ToLower(owner), strings.ToLower(name), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sharers: %w", err)
+	}
+	defer rows.Close()
+
+	var sharers []Sharer
+	for rows.Next() {
+		var s Sharer
+		if err := rows.Scan(&s.Did, &s.Posts, &s.FirstShared); err != nil {
+			return nil, fmt.Errorf("error scanning sharer: %w", err)
+		}
+		sharers = append(sharers, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sharers: %w", err)
+	}
+	return sharers, nil
+}
+
+func (pr *PostRepository) GetOwner(forge, owner string) (Owner, error) {
+	o := Owner{Forge: forge, Owner: strings.ToLower(owner)}
+	err := pr.reader.QueryRow(`SELECT COUNT(*), COALESCE(SUM(r.mention_count), 0), COALESCE(SUM(m.stars), 0),
+		COALESCE(MIN(r.first_seen), 0), COALESCE(MAX(r.last_seen), 0),
+		(SELECT COUNT(DISTINCT p.did)
+			FROM posts p
+			JOIN post_repositories pr ON pr.post_id = p.id
+			JOIN repositories r ON r.id = pr.repository_id
+			WHERE r.forge = $1 AND r.owner = $2)
+	FROM repositories r
+	LEFT JOIN repository_metadata m ON m.repository_id = r.id AND m.status = 200
+	WHERE r.forge = $1 AND r.owner = $2`, o.Forge, o.Owner).Scan(
+		&o.Repositories, &o.Mentions, &o.Stars, &o.FirstSeen, &o.LastSeen, &o.Sharers)
+	if err != nil {
+		return o, fmt.Errorf("error querying owner: %w", err)
+	}
+	if o.Repositories == 0 {
+		return o, fmt.Errorf("no owner %s/%s: %w", forge, owner, ErrNotFound)
+	}
+	return o, nil
+}
+
+// GetOwnerRepositories lists an owner's repositories, most mentioned first.
+func (pr *PostRepository) GetOwnerRepositories(forge, owner string, limit int) ([]RepositoryMetadata, error) {
+	return pr.queryMetadata(`SELECT `+metadataColumns+`
+	FROM repositories r
+	LEFT JOIN repository_metadata m ON m.repository_id = r.id
+	WHERE r.forge = $1 AND r.owner = $2
+	ORDER BY r.mention_count DESC, r.last_seen DESC
+	LIMIT $3`, forge, strings.ToLower(owner), limit)
+}
@@ -0,0 +1,346 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Granularity is the width of a rollup bucket. Buckets start on UTC hour and
+// day boundaries.
+type Granularity string
+
+const (
+	Hour Granularity = "hour"
+	Day  Granularity = "day"
+)
+
+var granularities = []Granularity{Hour, Day}
+
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case Hour, Day:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown granularity %q, want hour or day", s)
+}
+
+func (g Granularity) Duration() time.Duration {
+	if g == Day {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// Truncate returns the start of the bucket holding timeUs.
+func (g Granularity) Truncate(timeUs int64) int64 {
+	width := g.Duration().Microseconds()
+	return timeUs - timeUs%width
+}
+
+// Bucket holds the matched posts first stored in one hour or day. Rollups are
+// kept after retention deletes the posts, and aren't reduced when a post is
+// deleted or edited.
+type Bucket struct {
+	Start   int64            `json:"start"`
+	Posts   int64            `json:"posts"`
+	Authors int64            `json:"authors"`
+	Langs   map[string]int64 `json:"langs"`
+	Forges  map[string]int64 `json:"forges"`
+}
+
+type RepositoryBucket struct {
+	Start    int64 `json:"start"`
+	Mentions int64 `json:"mentions"`
+}
+
+// StatsRepo reads rollups as contiguous series over [since, until), with
+// empty buckets filled in as zeroes.
+type StatsRepo interface {
+	GetTimeseries(g Granularity, since, until int64) ([]Bucket, error)
+	GetRepositoryTimeseries(g Granularity, forge, owner, name string, since, until int64) ([]RepositoryBucket, error)
+}
+
+// undeterminedLang is the BCP 47 tag rollups use for posts without a language.
+const undeterminedLang = "und"
+
+func createRollups(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS rollups (
+            granularity TEXT NOT NULL,
+            bucket_start INTEGER NOT NULL,
+            posts INTEGER NOT NULL DEFAULT 0,
+            authors INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (granularity, bucket_start)
+        ) WITHOUT ROWID;
+        CREATE TABLE IF NOT EXISTS rollup_authors (
+            granularity TEXT NOT NULL,
+            bucket_start INTEGER NOT NULL,
+            did TEXT NOT NULL,
+            PRIMARY KEY (granularity, bucket_start, did)
+        ) WITHOUT ROWID;
+        CREATE TABLE IF NOT EXISTS rollup_langs (
+            granularity TEXT NOT NULL,
+            bucket_start INTEGER NOT NULL,
+            lang TEXT NOT NULL,
+            posts INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (granularity, bucket_start, lang)
+        ) WITHOUT ROWID;
+        CREATE TABLE IF NOT EXISTS rollup_repositories (
+            granularity TEXT NOT NULL,
+            bucket_start INTEGER NOT NULL,
+            repository_id INTEGER NOT NULL,
+            mentions INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (granularity, bucket_start, repository_id)
+        ) WITHOUT ROWID;
+        CREATE INDEX IF NOT EXISTS rollup_repositories_repository_id
+            ON rollup_repositories(repository_id, granularity, bucket_start);
+        CREATE TABLE IF NOT EXISTS rollup_forges (
+            granularity TEXT NOT NULL,
+            bucket_start INTEGER NOT NULL,
+            forge TEXT NOT NULL,
+            mentions INTEGER NOT NULL DEFAULT 0,
+            PRIMARY KEY (granularity, bucket_start, forge)
+        ) WITHOUT ROWID;`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, record_langs FROM posts ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type existing struct {
+		id   int64
+		lang sql.NullString
+	}
+	var posts []existing
+	for rows.Next() {
+		var p existing
+		if err := rows.Scan(&p.id, &p.lang); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		var langs []string
+		if p.lang.Valid && p.lang.String != "" {
+			langs = []string{p.lang.String}
+		}
+		if err := rollUpPost(tx, p.id, langs); err != nil {
+			return err
+		}
+	}
+	log.Printf("Rolled up %d existing posts", len(posts))
+	return nil
+}
+
+// rollUpPost adds a newly stored post, its languages and the repositories it
+// is linked to, to its hour and day buckets.
+func rollUpPost(tx *sql.Tx, postID int64, langs []string) error {
+	var did string
+	var timeUs int64
+	err := tx.QueryRow(`SELECT did, time_us FROM posts WHERE id = $1`, postID).Scan(&did, &timeUs)
+	if err != nil {
+		return fmt.Errorf("could not read post to roll up: %w", err)
+	}
+	if len(langs) == 0 {
+		langs = []string{undeterminedLang}
+	}
+
+	for _, g := range granularities {
+		start := g.Truncate(timeUs)
+
+		res, err := tx.Exec(`INSERT OR IGNORE INTO rollup_authors (granularity, bucket_start, did) VALUES ($1, $2, $3)`,
+			g, start, did)
+		if err != nil {
+			return fmt.Errorf("could not roll up author: %w", err)
+		}
+		newAuthors, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO rollups (granularity, bucket_start, posts, authors) VALUES ($1, $2, 1, $3)
+		ON CONFLICT (granularity, bucket_start) DO UPDATE SET
+			posts = posts + 1,
+			authors = authors + excluded.authors`, g, start, newAuthors)
+		if err != nil {
+			return fmt.Errorf("could not roll up post: %w", err)
+		}
+
+		for _, lang := range langs {
+			_, err = tx.Exec(`INSERT INTO rollup_langs (granularity, bucket_start, lang, posts) VALUES ($1, $2, $3, 1)
+			ON CONFLICT (granularity, bucket_start, lang) DO UPDATE SET posts = posts + 1`, g, start, lang)
+			if err != nil {
+				return fmt.Errorf("could not roll up language: %w", err)
+			}
+		}
+
+		_, err = tx.Exec(`INSERT INTO rollup_repositories (granularity, bucket_start, repository_id, mentions)
+		SELECT $1, $2, repository_id, 1 FROM post_repositories WHERE post_id = $3
+		ON CONFLICT (granularity, bucket_start, repository_id) DO UPDATE SET mentions = mentions + 1`, g, start, postID)
+		if err != nil {
+			return fmt.Errorf("could not roll up repositories: %w", err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO rollup_forges (granularity, bucket_start, forge, mentions)
+		SELECT $1, $2, r.forge, COUNT(*)
+		FROM post_repositories pr JOIN repositories r ON r.id = pr.repository_id
+		WHERE pr.post_id = $3
+		GROUP BY r.forge
+		ON CONFLICT (granularity, bucket_start, forge) DO UPDATE SET mentions = mentions + excluded.mentions`,
+			g, start, postID)
+		if err != nil {
+			return fmt.Errorf("could not roll up forges: %w", err)
+		}
+	}
+	return nil
+}
+
+// bucketStarts lists every bucket start from the one holding since up to until.
+func bucketStarts(g Granularity, since, until int64) []int64 {
+	var starts []int64
+	for start := g.Truncate(since); start < until; start += g.Duration().Microseconds() {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+func (pr *PostRepository) GetTimeseries(g Granularity, since, until int64) ([]Bucket, error) {
+	starts := bucketStarts(g, since, until)
+	buckets := make([]Bucket, len(starts))
+	index := make(map[int64]*Bucket, len(starts))
+	for i, start := range starts {
+		buckets[i] = Bucket{Start: start, Langs: map[string]int64{}, Forges: map[string]int64{}}
+		index[start] = &buckets[i]
+	}
+	if len(starts) == 0 {
+		return buckets, nil
+	}
+	from := starts[0]
+
+	err := pr.queryRollup(`SELECT bucket_start, posts, authors FROM rollups
+	WHERE granularity = $1 AND bucket_start >= $2 AND bucket_start < $3`,
+		func(rows *sql.Rows) error {
+			var start, posts, authors int64
+			if err := rows.Scan(&start, &posts, &authors); err != nil {
+				return err
+			}
+			if b, ok := index[start]; ok {
+				b.Posts, b.Authors = posts, authors
+			}
+			return nil
+		}, g, from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, breakdown := range []struct {
+		table, key, count string
+		into              func(*Bucket) map[string]int64
+	}{
+		{"rollup_langs", "lang", "posts", func(b *Bucket) map[string]int64 { return b.Langs }},
+		{"rollup_forges", "forge", "mentions", func(b *Bucket) map[string]int64 { return b.Forges }},
+	} {
+		err := pr.queryRollup(`SELECT bucket_start, `+breakdown.key+`, `+breakdown.count+` FROM `+breakdown.table+`
+		WHERE granularity = $1 AND bucket_start >= $2 AND bucket_start < $3`,
+			func(rows *sql.Rows) error {
+				var start, n int64
+				var key string
+				if err := rows.Scan(&start, &key, &n); err != nil {
+					return err
+				}
+				if b, ok := index[start]; ok {
+					breakdown.into(b)[key] = n
+				}
+				return nil
+			}, g, from, until)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buckets, nil
+}
+
+func (pr *PostRepository) GetRepositoryTimeseries(g Granularity, forge, owner, name string, since, until int64) ([]RepositoryBucket, error) {
+	var repoID int64
+	err := pr.reader.QueryRow(`SELECT id FROM repositories WHERE forge = $1 AND owner = $2 AND name = $3`,
+		forge, strings.ToLower(owner), strings.ToLower(name)).Scan(&repoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no repository %s/%s/%s: %w", forge, owner, name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying repository: %w", err)
+	}
+	return pr.repositoryBuckets(g, since, until, `SELECT bucket_start, mentions FROM rollup_repositories
+	WHERE repository_id = $1 AND granularity = $2 AND bucket_start >= $3 AND bucket_start < $4`,
+		repoID, g, g.Truncate(since), until)
+}
+
+// GetOwnerTimeseries sums the mentions of every repository under owner.
+func (pr *PostRepository) GetOwnerTimeseries(g Granularity, forge, owner string, since, until int64) ([]RepositoryBucket, error) {
+	return pr.repositoryBuckets(g, since, until, `SELECT rr.bucket_start, SUM(rr.mentions) FROM rollup_repositories rr
+	JOIN repositories r ON r.id = rr.repository_id
+	WHERE r.forge = $1 AND r.owner = $2 AND rr.granularity = $3 AND rr.bucket_start >= $4 AND rr.bucket_start < $5
+	GROUP BY rr.bucket_start`,
+		forge, strings.ToLower(owner), g, g.Truncate(since), until)
+}
+
+// repositoryBuckets fills a contiguous series over [since, until) from query,
+// which selects bucket starts and mentions.
+func (pr *PostRepository) repositoryBuckets(g Granularity, since, until int64, query string, args ...any) ([]RepositoryBucket, error) {
+	starts := bucketStarts(g, since, until)
+	buckets := make([]RepositoryBucket, len(starts))
+	index := make(map[int64]*RepositoryBucket, len(starts))
+	for i, start := range starts {
+		buckets[i] = RepositoryBucket{Start: start}
+		index[start] = &buckets[i]
+	}
+	if len(starts) == 0 {
+		return buckets, nil
+	}
+
+	err := pr.queryRollup(query,
+		func(rows *sql.Rows) error {
+			var start, mentions int64
+			if err := rows.Scan(&start, &mentions); err != nil {
+				return err
+			}
+			if b, ok := index[start]; ok {
+				b.Mentions = mentions
+			}
+			return nil
+		}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (pr *PostRepository) queryRollup(query string, each func(*sql.Rows) error, args ...any) error {
+	rows, err := pr.reader.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying rollups: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := each(rows); err != nil {
+			return fmt.Errorf("error scanning rollup: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rollups: %w", err)
+	}
+	return nil
+}
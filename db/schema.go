@@ -0,0 +1,240 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Migrations are applied in order and tracked with PRAGMA user_version,
+// so new entries must only ever be appended.
+var migrations = []struct {
+	name string
+	up   func(tx *sql.Tx) error
+}{
+	{"create posts", createPosts},
+	{"create repositories", createRepositories},
+	{"create post engagement", createPostEngagement},
+	{"dedupe posts", dedupePosts},
+	{"create rollups", createRollups},
+	{"create post langs", createPostLangs},
+	{"create changes", createChanges},
+	{"create feed seen", createFeedSeen},
+	{"create github cache", createGitHubCache},
+	{"create repository metadata", createRepositoryMetadata},
+	{"create repository stars", createRepositoryStars},
+	{"add post replies", addPostReplies},
+}
+
+func Migrate(db *sql.DB) error {
+	for i, m := range migrations {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting migration %d: %w", i+1, err)
+		}
+
+		var version int
+		if err := tx.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error reading schema version: %w", err)
+		}
+		if version > i {
+			tx.Rollback()
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", i+1, m.name)
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d (%s): %w", i+1, m.name, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error setting schema version: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func createPosts(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS posts (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            did TEXT NOT NULL,
+            time_us INTEGER NOT NULL,
+            kind TEXT NOT NULL,
+            commit_rev TEXT NOT NULL,
+            commit_operation TEXT NOT NULL,
+            commit_collection TEXT NOT NULL,
+            commit_rkey TEXT NOT NULL,
+            commit_cid TEXT NOT NULL,
+            record_type TEXT NOT NULL,
+            record_created_at DATETIME NOT NULL,
+            record_langs TEXT,
+            record_text TEXT,
+            record_uri TEXT
+        );
+        CREATE INDEX IF NOT EXISTS time_us ON posts(time_us);`)
+	return err
+}
+
+func createRepositories(tx *sql.Tx) error {
+	// Ingest used to store a blank row for every unmatched post on the stream.
+	if _, err := tx.Exec(`DELETE FROM posts WHERE record_uri IS NULL OR record_uri = '';`); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS repositories (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            forge TEXT NOT NULL,
+            owner TEXT NOT NULL,
+            name TEXT NOT NULL,
+            first_seen INTEGER NOT NULL,
+            last_seen INTEGER NOT NULL,
+            mention_count INTEGER NOT NULL DEFAULT 0,
+            distinct_authors INTEGER NOT NULL DEFAULT 0,
+            UNIQUE (forge, owner, name)
+        );
+        CREATE TABLE IF NOT EXISTS post_repositories (
+            post_id INTEGER NOT NULL,
+            repository_id INTEGER NOT NULL,
+            url TEXT NOT NULL,
+            PRIMARY KEY (post_id, repository_id)
+        );
+        CREATE INDEX IF NOT EXISTS post_repositories_repository_id ON post_repositories(repository_id);
+        CREATE INDEX IF NOT EXISTS posts_did_rkey ON posts(did, commit_rkey);`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, time_us, record_uri FROM posts`)
+	if err != nil {
+		return err
+	}
+	type existing struct {
+		id     int64
+		timeUs int64
+		uri    string
+	}
+	var posts []existing
+	for rows.Next() {
+		var p existing
+		if err := rows.Scan(&p.id, &p.timeUs, &p.uri); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		if err := linkRepository(tx, p.id, p.timeUs, p.uri); err != nil {
+			return err
+		}
+	}
+	log.Printf("Linked %d existing posts to repositories", len(posts))
+	return nil
+}
+
+func createPostEngagement(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS post_engagement (
+            post_id INTEGER PRIMARY KEY,
+            likes INTEGER NOT NULL DEFAULT 0,
+            reposts INTEGER NOT NULL DEFAULT 0,
+            replies INTEGER NOT NULL DEFAULT 0
+        );`)
+	return err
+}
+
+// dedupePosts collapses rows stored more than once for the same record, then
+// adds the unique key that makes WritePost an upsert.
+func dedupePosts(tx *sql.Tx) error {
+	// Keep the first copy, which likes, reposts and replies have been counted
+	// against, but give it the content of the newest copy.
+	rows, err := tx.Query(`
+        SELECT MIN(id), MAX(id) FROM posts
+        GROUP BY did, commit_collection, commit_rkey
+        HAVING COUNT(*) > 1`)
+	if err != nil {
+		return err
+	}
+	type group struct{ keep, latest int64 }
+	var groups []group
+	for rows.Next() {
+		var g group
+		if err := rows.Scan(&g.keep, &g.latest); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		_, err := tx.Exec(`
+            UPDATE posts SET
+                commit_rev = latest.commit_rev,
+                commit_operation = latest.commit_operation,
+                commit_cid = latest.commit_cid,
+                record_langs = latest.record_langs,
+                record_text = latest.record_text,
+                record_uri = latest.record_uri
+            FROM (SELECT * FROM posts WHERE id = $1) AS latest
+            WHERE posts.id = $2`, g.latest, g.keep)
+		if err != nil {
+			return err
+		}
+	}
+
+	removed, err := deletePostsFrom(tx, []string{"post_repositories", "post_engagement"}, `id NOT IN (
+        SELECT MIN(id) FROM posts GROUP BY did, commit_collection, commit_rkey)`)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		var timeUs int64
+		var uri string
+		if err := tx.QueryRow(`SELECT time_us, record_uri FROM posts WHERE id = $1`, g.keep).Scan(&timeUs, &uri); err != nil {
+			return err
+		}
+		if err := relinkRepository(tx, g.keep, timeUs, uri); err != nil {
+			return err
+		}
+	}
+	log.Printf("Removed %d duplicate posts", removed)
+
+	_, err = tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS posts_did_collection_rkey
+        ON posts(did, commit_collection, commit_rkey);`)
+	return err
+}
+
+// addPostReplies keeps the post a reply answers and the thread it's in. Posts
+// stored earlier have none recorded.
+func addPostReplies(tx *sql.Tx) error {
+	for _, column := range []string{"reply_parent_uri", "reply_parent_cid", "reply_root_uri", "reply_root_cid"} {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info('posts') WHERE name = $1)`, column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(`ALTER TABLE posts ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SeenRepo remembers which repositories each viewer has been shown in each
+// feed, so personalized feeds can move on to ones they haven't.
+type SeenRepo interface {
+	MarkSeen(viewer, feed string, repos []Repository) error
+	// GetSeen returns the repositories first shown to viewer in feed before the given time.
+	GetSeen(viewer, feed string, before int64) ([]Repository, error)
+}
+
+func createFeedSeen(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS feed_seen (
+            viewer TEXT NOT NULL,
+            feed TEXT NOT NULL,
+            forge TEXT NOT NULL,
+            owner TEXT NOT NULL,
+            name TEXT NOT NULL,
+            first_seen INTEGER NOT NULL,
+            PRIMARY KEY (viewer, feed, forge, owner, name)
+        ) WITHOUT ROWID;
+        CREATE INDEX IF NOT EXISTS feed_seen_first_seen ON feed_seen(first_seen);`)
+	return err
+}
+
+func (pr *PostRepository) MarkSeen(viewer, feed string, repos []Repository) error {
+	now := time.Now().UnixMicro()
+	err := pr.write(func(tx *sql.Tx) error {
+		for _, r := range repos {
+			_, err := tx.Exec(`INSERT OR IGNORE INTO feed_seen (viewer, feed, forge, owner, name, first_seen)
+			VALUES ($1, $2, $3, $4, $5, $6)`, viewer, feed, r.Forge, r.Owner, r.Name, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not mark repositories seen: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostRepository) GetSeen(viewer, feed string, before int64) ([]Repository, error) {
+	rows, err := pr.reader.Query(`SELECT forge, owner, name FROM feed_seen
+	WHERE viewer = $1 AND feed = $2 AND first_seen < $3`, viewer, feed, before)
+	if err != nil {
+		return nil, fmt.Errorf("error querying seen repositories: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []Repository
+	for rows.Next() {
+		var r Repository
+		if err := rows.Scan(&r.Forge, &r.Owner, &r.Name); err != nil {
+			return nil, fmt.Errorf("error scanning seen repository: %w", err)
+		}
+		repos = append(repos, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating seen repositories: %w", err)
+	}
+	return repos, nil
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// HistoryBucket is one day of a repository's history: the posts mentioning it
+// and its star and fork counts as last fetched that day. Stars and Forks are
+// nil for days it wasn't fetched.
+type HistoryBucket struct {
+	Start    int64  `json:"start"`
+	Mentions int64  `json:"mentions"`
+	Stars    *int64 `json:"stars"`
+	Forks    *int64 `json:"forks"`
+}
+
+// createRepositoryStars keeps a daily star and fork snapshot per repository.
+// Like rollups, snapshots are kept after retention prunes the posts.
+func createRepositoryStars(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS repository_stars (
+            repository_id INTEGER NOT NULL,
+            day INTEGER NOT NULL,
+            stars INTEGER NOT NULL,
+            forks INTEGER NOT NULL,
+            PRIMARY KEY (repository_id, day)
+        ) WITHOUT ROWID;`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR IGNORE INTO repository_stars (repository_id, day, stars, forks)
+	SELECT repository_id, fetched_at - fetched_at % $1, stars, forks FROM repository_metadata WHERE status = 200`,
+		Day.Duration().Microseconds())
+	return err
+}
+
+// snapshotStars records m's counts for the day it was fetched, replacing any
+// earlier snapshot that day.
+func snapshotStars(tx *sql.Tx, m RepositoryMetadata) error {
+	_, err := tx.Exec(`INSERT INTO repository_stars (repository_id, day, stars, forks) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (repository_id, day) DO UPDATE SET stars = excluded.stars, forks = excluded.forks`,
+		m.ID, Day.Truncate(m.FetchedAt), m.Stars, m.Forks)
+	return err
+}
+
+// GetRepositoryHistory returns a GitHub repository's daily mentions alongside
+// its star and fork snapshots over [since, until).
+func (pr *PostRepository) GetRepositoryHistory(owner, name string, since, until int64) ([]HistoryBucket, error) {
+	mentions, err := pr.GetRepositoryTimeseries(Day, "github", owner, name, since, until)
+	if err != nil {
+		return nil, err
+	}
+	buckets := make([]HistoryBucket, len(mentions))
+	index := make(map[int64]*HistoryBucket, len(mentions))
+	for i, m := range mentions {
+		buckets[i] = HistoryBucket{Start: m.Start, Mentions: m.Mentions}
+		index[m.Start] = &buckets[i]
+	}
+	if len(buckets) == 0 {
+		return buckets, nil
+	}
+
+	err = pr.queryRollup(`SELECT s.day, s.stars, s.forks FROM repository_stars s
+	JOIN repositories r ON r.id = s.repository_id
+	WHERE r.forge = 'github' AND r.owner = $1 AND r.name = $2 AND s.day >= $3 AND s.day < $4`,
+		func(rows *sql.Rows) error {
+			var day, stars, forks int64
+			if err := rows.Scan(&day, &stars, &forks); err != nil {
+				return err
+			}
+			if b, ok := index[day]; ok {
+				b.Stars, b.Forks = &stars, &forks
+			}
+			return nil
+		}, strings.ToLower(owner), strings.ToLower(name), buckets[0].Start, until)
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Engagement int
+
+const (
+	Like Engagement = iota
+	Repost
+	Reply
+)
+
+// Mention is a single post linking to a repository, with the engagement
+// that post has collected so far.
+type Mention struct {
+	RepositoryID int64
+	Forge        string
+	Owner        string
+	Name         string
+	Did          string
+	TimeUs       int64
+	Likes        int64
+	Reposts      int64
+	Replies      int64
+}
+
+type TrendingRepo interface {
+	GetMentions(since int64, filter PostFilter) ([]Mention, error)
+}
+
+// ATURI builds the at:// URI that identifies a record in a user's repo.
+func ATURI(did, collection, rkey string) string {
+	return fmt.Sprintf("at://%s/%s/%s", did, collection, rkey)
+}
+
+func ParseATURI(uri string) (did, collection, rkey string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(uri, "at://"), "/")
+	if !strings.HasPrefix(uri, "at://") || len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+func (pr *PostRepository) GetMentions(since int64, filter PostFilter) ([]Mention, error) {
+	where, args := filter.where()
+	sqlStmt := `SELECT r.id, r.forge, r.owner, r.name, p.did, p.time_us,
+		COALESCE(e.likes, 0), COALESCE(e.reposts, 0), COALESCE(e.replies, 0)
+	FROM post_repositories pr
+	JOIN posts p ON p.id = pr.post_id
+	JOIN repositories r ON r.id = pr.repository_id
+	LEFT JOIN post_engagement e ON e.post_id = p.id
+	WHERE ` + where + ` AND p.time_us >= $` + fmt.Sprint(len(args)+1) + `
+	ORDER BY p.time_us`
+
+	rows, err := pr.reader.Query(sqlStmt, append(args, since)...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []Mention
+	for rows.Next() {
+		var m Mention
+		err := rows.Scan(
+			&m.RepositoryID,
+			&m.Forge,
+			&m.Owner,
+			&m.Name,
+			&m.Did,
+			&m.TimeUs,
+			&m.Likes,
+			&m.Reposts,
+			&m.Replies,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning mention: %w", err)
+		}
+		mentions = append(mentions, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mentions: %w", err)
+	}
+	return mentions, nil
+}
+
+// GetPostKeys returns the did and rkey of every post stored since the given time,
+// so ingest knows which likes, reposts and replies to count.
+func (pr *PostRepository) GetPostKeys(since int64) (map[string]int64, error) {
+	rows, err := pr.reader.Query(`SELECT did, commit_rkey, time_us FROM posts WHERE time_us >= $1`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying post keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]int64)
+	for rows.Next() {
+		var did, rkey string
+		var timeUs int64
+		if err := rows.Scan(&did, &rkey, &timeUs); err != nil {
+			return nil, fmt.Errorf("error scanning post key: %w", err)
+		}
+		keys[did+"/"+rkey] = timeUs
+	}
+	return keys, rows.Err()
+}
+
+func addEngagementStmt(e Engagement) string {
+	column := [...]string{Like: "likes", Repost: "reposts", Reply: "replies"}[e]
+	return `INSERT INTO post_engagement (post_id, ` + column + `)
+	SELECT id, 1 FROM posts WHERE did = $1 AND commit_rkey = $2
+	ON CONFLICT (post_id) DO UPDATE SET ` + column + ` = ` + column + ` + 1`
+}
+
+func (pr *PostRepository) AddEngagement(did, rkey string, e Engagement) error {
+	stmt, ok := pr.addEngagement[e]
+	if !ok {
+		return fmt.Errorf("unknown engagement %d", e)
+	}
+
+	err := withRetry(func() error {
+		_, err := stmt.Exec(did, rkey)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not record engagement: %w", err)
+	}
+	return nil
+}
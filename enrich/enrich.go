@@ -0,0 +1,120 @@
+// Package enrich fetches GitHub metadata for the repositories posts mention
+// and stores it, so listings can filter and sort by it without calling GitHub.
+package enrich
+
+import (
+	"context"
+	"errors"
+	"gitfeed/db"
+	"gitfeed/github"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultInterval = time.Minute
+	DefaultBatch    = 50
+	// DefaultRefreshAge is how old metadata gets before it's fetched again.
+	DefaultRefreshAge = 24 * time.Hour
+	// DefaultWindow is how recently a repository must have been mentioned to
+	// be fetched.
+	DefaultWindow = db.Retention
+)
+
+// Worker fetches metadata for newly seen repositories first, then refreshes
+// the most mentioned ones once their metadata is older than RefreshAge.
+// Each fetch also records the day's star and fork counts, so repositories
+// mentioned within Window get a daily snapshot. Older ones are left alone.
+type Worker struct {
+	Repo       db.MetadataRepo
+	GitHub     github.Fetcher
+	Interval   time.Duration
+	Batch      int
+	RefreshAge time.Duration
+	Window     time.Duration
+
+	now func() time.Time
+}
+
+func NewWorker(repo db.MetadataRepo, fetcher github.Fetcher) *Worker {
+	return &Worker{
+		Repo:       repo,
+		GitHub:     fetcher,
+		Interval:   DefaultInterval,
+		Batch:      DefaultBatch,
+		RefreshAge: DefaultRefreshAge,
+		Window:     DefaultWindow,
+		now:        time.Now,
+	}
+}
+
+// Run enriches a batch every Interval until ctx is done.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := w.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error enriching repositories: %v", err)
+		} else if n > 0 {
+			log.Printf("Enriched %d repositories", n)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce enriches up to Batch repositories and returns how many were stored.
+// It stops early when GitHub's rate limit runs out.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	now := w.now()
+	repos, err := w.Repo.GetRepositoriesToEnrich(now.Add(-w.Window).UnixMicro(), now.Add(-w.RefreshAge).UnixMicro(), w.Batch)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, m := range repos {
+		var etag string
+		if m.Status == http.StatusOK {
+			etag = m.ETag
+		}
+		resp, err := w.GitHub.Get(ctx, github.RepoPath(m.Owner, m.Name), etag)
+		if errors.Is(err, github.ErrRateLimited) || ctx.Err() != nil {
+			return n, err
+		}
+		if err != nil {
+			log.Printf("Error fetching %s/%s: %v", m.Owner, m.Name, err)
+			continue
+		}
+
+		m.FetchedAt = w.now().UnixMicro()
+		switch resp.Status {
+		case http.StatusOK:
+			repo, err := github.ParseRepo(resp.Body)
+			if err != nil {
+				log.Printf("Error parsing %s/%s: %v", m.Owner, m.Name, err)
+				continue
+			}
+			m.Description, m.Stars, m.Forks = repo.Description, int64(repo.Stars), int64(repo.Forks)
+			m.Language, m.Topics, m.License, m.Archived = repo.Language, repo.Topics, repo.License, repo.Archived
+			m.Status, m.ETag = http.StatusOK, resp.ETag
+		case http.StatusNotModified:
+		case http.StatusNotFound, http.StatusGone, http.StatusUnavailableForLegalReasons:
+			// Gone for good as far as listings go; checked again after RefreshAge.
+			m = db.RepositoryMetadata{Repository: m.Repository, Status: http.StatusNotFound, FetchedAt: m.FetchedAt}
+		default:
+			log.Printf("Error fetching %s/%s: GitHub returned %d", m.Owner, m.Name, resp.Status)
+			continue
+		}
+		if err := w.Repo.PutRepositoryMetadata(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package enrich
+
+import (
+	"context"
+	"gitfeed/db"
+	"gitfeed/github"
+	"gitfeed/github/githubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeRepo hands out every repository whose metadata is older than fetchedBefore.
+type fakeRepo struct {
+	repos map[string]db.RepositoryMetadata
+}
+
+func (f *fakeRepo) GetRepositoriesToEnrich(seenSince, fetchedBefore int64, limit int) ([]db.RepositoryMetadata, error) {
+	var out []db.RepositoryMetadata
+	for _, name := range []string{"repo", "gone", "limited"} {
+		if m, ok := f.repos[name]; ok && m.FetchedAt < fetchedBefore && len(out) < limit {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) PutRepositoryMetadata(m db.RepositoryMetadata) error {
+	f.repos[m.Name] = m
+	return nil
+}
+
+func (f *fakeRepo) GetRepositories(q db.RepositoryQuery) ([]db.RepositoryMetadata, error) {
+	return nil, nil
+}
+
+func (f *fakeRepo) GetRepositoryHistory(owner, name string, since, until int64) ([]db.HistoryBucket, error) {
+	return nil, nil
+}
+
+func TestRunOnce(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo", map[string]any{
+		"stargazers_count": 5, "language": "Go", "topics": []string{"cli"}, "license": map[string]string{"spdx_id": "MIT"},
+	})
+	repo := &fakeRepo{repos: map[string]db.RepositoryMetadata{}}
+	for i, name := range []string{"repo", "gone"} {
+		repo.repos[name] = db.RepositoryMetadata{Repository: db.Repository{ID: int64(i + 1), Forge: "github", Owner: "owner", Name: name}}
+	}
+	w := NewWorker(repo, github.NewClient(s.URL, ""))
+
+	n, err := w.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	got := repo.repos["repo"]
+	assert.Equal(t, http.StatusOK, got.Status)
+	assert.Equal(t, int64(5), got.Stars)
+	assert.Equal(t, "Go", got.Language)
+	assert.Equal(t, []string{"cli"}, got.Topics)
+	assert.Equal(t, "MIT", got.License)
+	assert.NotEmpty(t, got.ETag)
+	assert.Equal(t, http.StatusNotFound, repo.repos["gone"].Status)
+
+	n, err = w.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n, "fresh metadata isn't refetched")
+
+	// Once stale, unchanged metadata is revalidated with its ETag.
+	w.now = func() time.Time { return time.Now().Add(DefaultRefreshAge + time.Minute) }
+	n, err = w.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	reqs := s.Requests()
+	assert.Equal(t, got.ETag, reqs[2].IfNoneMatch)
+	assert.Equal(t, int64(5), repo.repos["repo"].Stars)
+	assert.Greater(t, repo.repos["repo"].FetchedAt, got.FetchedAt)
+}
+
+func TestRunOnceStopsWhenRateLimited(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRateLimit(1, time.Now().Add(time.Hour))
+	repo := &fakeRepo{repos: map[string]db.RepositoryMetadata{}}
+	for i, name := range []string{"repo", "gone", "limited"} {
+		repo.repos[name] = db.RepositoryMetadata{Repository: db.Repository{ID: int64(i + 1), Forge: "github", Owner: "owner", Name: name}}
+	}
+	w := NewWorker(repo, github.NewClient(s.URL, ""))
+
+	n, err := w.RunOnce(context.Background())
+	assert.ErrorIs(t, err, github.ErrRateLimited)
+	assert.Equal(t, 1, n)
+	assert.Len(t, s.Requests(), 1)
+	assert.Zero(t, repo.repos["limited"].FetchedAt, "repositories left over wait for the next run")
+}
@@ -0,0 +1,257 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gitfeed/db"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type Format string
+
+const (
+	NDJSON  Format = "ndjson"
+	CSV     Format = "csv"
+	Parquet Format = "parquet"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case NDJSON, CSV, Parquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, want ndjson, csv or parquet", s)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+type Dataset string
+
+const (
+	Posts        Dataset = "posts"
+	Links        Dataset = "links"
+	Repositories Dataset = "repositories"
+)
+
+func ParseDataset(s string) (Dataset, error) {
+	switch d := Dataset(s); d {
+	case Posts, Links, Repositories:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown export dataset %q, want posts, links or repositories", s)
+}
+
+// ParseTime accepts an RFC 3339 timestamp or a bare UTC date.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// Filename names an export of dataset covering [since, until).
+func Filename(dataset Dataset, format Format, since, until time.Time) string {
+	const layout = "20060102T150405Z"
+	return fmt.Sprintf("gitfeed-%s-%s-%s.%s", dataset, since.UTC().Format(layout), until.UTC().Format(layout), format)
+}
+
+// PostRow is a stored post. Langs is every language it declares, or the one
+// detected from its text when it declares none, as the API reports them.
+type PostRow struct {
+	Did        string    `json:"did" parquet:"did"`
+	Rkey       string    `json:"rkey" parquet:"rkey"`
+	TimeUs     int64     `json:"time_us" parquet:"time_us,timestamp(microsecond)"`
+	Collection string    `json:"collection" parquet:"collection"`
+	Operation  string    `json:"operation" parquet:"operation"`
+	Cid        string    `json:"cid" parquet:"cid"`
+	CreatedAt  time.Time `json:"created_at" parquet:"created_at,timestamp(microsecond)"`
+	Langs      []string  `json:"langs" parquet:"langs,list"`
+	Text       string    `json:"text" parquet:"text"`
+	URI        string    `json:"uri" parquet:"uri"`
+}
+
+func (PostRow) header() []string {
+	return []string{"did", "rkey", "time_us", "collection", "operation", "cid", "created_at", "langs", "text", "uri"}
+}
+
+func (r PostRow) record() []string {
+	return []string{r.Did, r.Rkey, itoa(r.TimeUs), r.Collection, r.Operation, r.Cid,
+		r.CreatedAt.Format(time.RFC3339), strings.Join(r.Langs, ","), r.Text, r.URI}
+}
+
+type LinkRow struct {
+	Did    string `json:"did" parquet:"did"`
+	Rkey   string `json:"rkey" parquet:"rkey"`
+	TimeUs int64  `json:"time_us" parquet:"time_us,timestamp(microsecond)"`
+	URL    string `json:"url" parquet:"url"`
+	Forge  string `json:"forge" parquet:"forge"`
+	Owner  string `json:"owner" parquet:"owner"`
+	Name   string `json:"name" parquet:"name"`
+}
+
+func (LinkRow) header() []string {
+	return []string{"did", "rkey", "time_us", "url", "forge", "owner", "name"}
+}
+
+func (r LinkRow) record() []string {
+	return []string{r.Did, r.Rkey, itoa(r.TimeUs), r.URL, r.Forge, r.Owner, r.Name}
+}
+
+// RepositoryRow counts mentions and authors inside the exported range next to
+// the all-time figures for the repository.
+type RepositoryRow struct {
+	Forge           string `json:"forge" parquet:"forge"`
+	Owner           string `json:"owner" parquet:"owner"`
+	Name            string `json:"name" parquet:"name"`
+	URL             string `json:"url" parquet:"url"`
+	Mentions        int64  `json:"mentions" parquet:"mentions"`
+	Authors         int64  `json:"authors" parquet:"authors"`
+	FirstSeen       int64  `json:"first_seen" parquet:"first_seen,timestamp(microsecond)"`
+	LastSeen        int64  `json:"last_seen" parquet:"last_seen,timestamp(microsecond)"`
+	MentionCount    int64  `json:"mention_count" parquet:"mention_count"`
+	DistinctAuthors int64  `json:"distinct_authors" parquet:"distinct_authors"`
+}
+
+func (RepositoryRow) header() []string {
+	return []string{"forge", "owner", "name", "url", "mentions", "authors",
+		"first_seen", "last_seen", "mention_count", "distinct_authors"}
+}
+
+func (r RepositoryRow) record() []string {
+	return []string{r.Forge, r.Owner, r.Name, r.URL, itoa(r.Mentions), itoa(r.Authors),
+		itoa(r.FirstSeen), itoa(r.LastSeen), itoa(r.MentionCount), itoa(r.DistinctAuthors)}
+}
+
+// langs encodes a post without languages as [] rather than null.
+func langs(l []string) []string {
+	if l == nil {
+		return []string{}
+	}
+	return l
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+type row interface {
+	header() []string
+	record() []string
+}
+
+// Export writes dataset for posts created in [since, until) to w as it is read
+// from the database, and returns the number of rows written.
+func Export(w io.Writer, repo db.ExportRepo, dataset Dataset, format Format, since, until time.Time) (int64, error) {
+	from, to := since.UnixMicro(), until.UnixMicro()
+
+	switch dataset {
+	case Posts:
+		return write(w, format, func(emit func(PostRow) error) error {
+			return repo.ExportPosts(from, to, func(p db.DBPost) error {
+				return emit(PostRow{
+					Did:        p.Did,
+					Rkey:       p.Rkey,
+					TimeUs:     p.TimeUs,
+					Collection: p.Collection,
+					Operation:  p.Operation,
+					Cid:        p.Cid,
+					CreatedAt:  p.CreatedAt.UTC(),
+					Langs:      langs(p.Languages),
+					Text:       p.Text,
+					URI:        p.URI,
+				})
+			})
+		})
+	case Links:
+		return write(w, format, func(emit func(LinkRow) error) error {
+			return repo.ExportLinks(from, to, func(l db.Link) error {
+				return emit(LinkRow(l))
+			})
+		})
+	case Repositories:
+		return write(w, format, func(emit func(RepositoryRow) error) error {
+			return repo.ExportRepositories(from, to, func(r db.RepositoryMentions) error {
+				return emit(RepositoryRow{
+					Forge:           r.Forge,
+					Owner:           r.Owner,
+					Name:            r.Name,
+					URL:             r.URL(),
+					Mentions:        r.Mentions,
+					Authors:         r.Authors,
+					FirstSeen:       r.FirstSeen,
+					LastSeen:        r.LastSeen,
+					MentionCount:    r.MentionCount,
+					DistinctAuthors: r.DistinctAuthors,
+				})
+			})
+		})
+	}
+	return 0, fmt.Errorf("unknown export dataset %q", dataset)
+}
+
+func write[T row](w io.Writer, format Format, each func(emit func(T) error) error) (int64, error) {
+	var n int64
+	var emit func(T) error
+	var finish func() error
+
+	switch format {
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		emit = func(r T) error { return enc.Encode(r) }
+		finish = func() error { return nil }
+	case CSV:
+		cw := csv.NewWriter(w)
+		var zero T
+		if err := cw.Write(zero.header()); err != nil {
+			return 0, err
+		}
+		emit = func(r T) error { return cw.Write(r.record()) }
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case Parquet:
+		// Rows are buffered a row group at a time, so memory stays bounded.
+		pw := parquet.NewGenericWriter[T](w, parquet.MaxRowsPerRowGroup(10000))
+		emit = func(r T) error {
+			_, err := pw.Write([]T{r})
+			return err
+		}
+		finish = pw.Close
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	err := each(func(r T) error {
+		if err := emit(r); err != nil {
+			return fmt.Errorf("error writing export: %w", err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := finish(); err != nil {
+		return n, fmt.Errorf("error finishing export: %w", err)
+	}
+	return n, nil
+}
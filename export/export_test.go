@@ -0,0 +1,121 @@
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"gitfeed/db"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeRepo struct {
+	posts []db.DBPost
+	// ranges records the [since, until) of every call.
+	ranges [][2]int64
+}
+
+func (f *fakeRepo) ExportPosts(since, until int64, fn func(db.DBPost) error) error {
+	f.ranges = append(f.ranges, [2]int64{since, until})
+	for _, p := range f.posts {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) ExportLinks(since, until int64, fn func(db.Link) error) error {
+	for _, p := range f.posts {
+		r, _ := db.ParseRepositoryURL(p.URI)
+		if err := fn(db.Link{Did: p.Did, Rkey: p.Rkey, TimeUs: p.TimeUs, URL: p.URI, Forge: r.Forge, Owner: r.Owner, Name: r.Name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) ExportRepositories(since, until int64, fn func(db.RepositoryMentions) error) error {
+	return nil
+}
+
+func testRepo() *fakeRepo {
+	created := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	return &fakeRepo{posts: []db.DBPost{
+		{Did: "did:plc:a", Rkey: "1", TimeUs: created.UnixMicro(), Collection: "app.bsky.feed.post", CreatedAt: created,
+			Langs: sql.Null[string]{V: "en", Valid: true}, Languages: []string{"en", "pt"},
+			Text: "see https://github.com/a/one", URI: "https://github.com/a/one"},
+		{Did: "did:plc:b", Rkey: "2", TimeUs: created.UnixMicro() + 1, Collection: "app.bsky.feed.post", CreatedAt: created,
+			Text: "commas, \"quotes\"\nand newlines", URI: "https://codeberg.org/b/two"},
+	}}
+}
+
+var (
+	since = time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	until = time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestExportNDJSON(t *testing.T) {
+	repo := testRepo()
+	var buf bytes.Buffer
+	n, err := Export(&buf, repo, Posts, NDJSON, since, until)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	assert.Equal(t, [][2]int64{{since.UnixMicro(), until.UnixMicro()}}, repo.ranges)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var first PostRow
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, []string{"en", "pt"}, first.Langs)
+	assert.Equal(t, repo.posts[0].URI, first.URI)
+	assert.Contains(t, lines[1], `"langs":[]`)
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Export(&buf, testRepo(), Links, CSV, since, until)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, LinkRow{}.header(), records[0])
+	assert.Equal(t, []string{"did:plc:b", "2", "1732104000000001", "https://codeberg.org/b/two", "codeberg", "b", "two"}, records[2])
+
+	buf.Reset()
+	_, err = Export(&buf, testRepo(), Posts, CSV, since, until)
+	require.NoError(t, err)
+	records, err = csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "en,pt", records[1][7])
+	assert.Equal(t, "commas, \"quotes\"\nand newlines", records[2][8])
+}
+
+func TestExportParquet(t *testing.T) {
+	repo := testRepo()
+	var buf bytes.Buffer
+	_, err := Export(&buf, repo, Posts, Parquet, since, until)
+	require.NoError(t, err)
+
+	rows, err := parquet.Read[PostRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, repo.posts[1].Text, rows[1].Text)
+	assert.Equal(t, repo.posts[0].TimeUs, rows[0].TimeUs)
+	assert.Equal(t, []string{"en", "pt"}, rows[0].Langs)
+	assert.True(t, repo.posts[0].CreatedAt.Equal(rows[0].CreatedAt))
+
+	// An empty range still produces a readable file.
+	buf.Reset()
+	_, err = Export(&buf, &fakeRepo{}, Repositories, Parquet, since, until)
+	require.NoError(t, err)
+	repos, err := parquet.Read[RepositoryRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Empty(t, repos)
+}
@@ -0,0 +1,89 @@
+package feedgen
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	viewerDID  = "did:plc:viewer"
+	serviceDID = "did:web:feed.example.com"
+)
+
+func newKey(t *testing.T) (*crypto.PrivateKeyK256, crypto.PublicKey) {
+	priv, err := crypto.GeneratePrivateKeyK256()
+	require.NoError(t, err)
+	pub, err := priv.PublicKey()
+	require.NoError(t, err)
+	return priv, pub
+}
+
+func sign(t *testing.T, priv crypto.PrivateKey, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.GetSigningMethod("ES256K"), claims).SignedString(priv)
+	require.NoError(t, err)
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	priv, pub := newKey(t)
+	other, _ := newKey(t)
+	v := &Verifier{Resolver: StaticResolver{viewerDID: pub}, ServiceDID: serviceDID}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	did, err := v.Verify(context.Background(), sign(t, priv, jwt.MapClaims{
+		"iss": viewerDID, "aud": serviceDID, "exp": exp, "lxm": "app.bsky.feed.getFeedSkeleton",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, viewerDID, did)
+
+	for name, token := range map[string]string{
+		"wrong audience": sign(t, priv, jwt.MapClaims{"iss": viewerDID, "aud": "did:web:elsewhere", "exp": exp}),
+		"expired":        sign(t, priv, jwt.MapClaims{"iss": viewerDID, "aud": serviceDID, "exp": time.Now().Add(-time.Hour).Unix()}),
+		"no expiry":      sign(t, priv, jwt.MapClaims{"iss": viewerDID, "aud": serviceDID}),
+		"wrong key":      sign(t, other, jwt.MapClaims{"iss": viewerDID, "aud": serviceDID, "exp": exp}),
+		"unknown issuer": sign(t, priv, jwt.MapClaims{"iss": "did:plc:stranger", "aud": serviceDID, "exp": exp}),
+		"other method":   sign(t, priv, jwt.MapClaims{"iss": viewerDID, "aud": serviceDID, "exp": exp, "lxm": "com.atproto.repo.createRecord"}),
+		"unsigned":       "eyJhbGciOiJub25lIn0.eyJpc3MiOiJkaWQ6cGxjOnZpZXdlciJ9.",
+	} {
+		_, err := v.Verify(context.Background(), token)
+		assert.ErrorIs(t, err, ErrUnauthorized, name)
+	}
+}
+
+func TestDirectoryResolver(t *testing.T) {
+	_, pub := newKey(t)
+	var requests int
+	plc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": viewerDID,
+			"verificationMethod": []map[string]string{
+				{"id": viewerDID + "#atproto", "publicKeyMultibase": pub.Multibase()},
+			},
+		})
+	}))
+	defer plc.Close()
+
+	r := NewDirectoryResolver()
+	r.PLCURL = plc.URL
+	for range 2 {
+		key, err := r.SigningKey(context.Background(), viewerDID)
+		require.NoError(t, err)
+		assert.True(t, pub.Equal(key))
+	}
+	assert.Equal(t, 1, requests, "keys are cached")
+
+	_, err := r.SigningKey(context.Background(), "did:plc:someone")
+	assert.Error(t, err, "the document must be for the DID asked for")
+	_, err = r.SigningKey(context.Background(), "did:key:abc")
+	assert.Error(t, err)
+}
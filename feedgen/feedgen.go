@@ -0,0 +1,295 @@
+// Package feedgen builds Bluesky feed skeletons from stored posts, so gitfeed
+// can be pinned as a custom feed in the Bluesky app. Each named algorithm
+// pages through its feed with an opaque cursor.
+package feedgen
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/trending"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+
+	// maxTrending is how deep the trending feed goes.
+	maxTrending = 100
+	// postsPerRepository is how many of a trending repository's latest posts
+	// are looked through for one the viewer didn't write.
+	postsPerRepository = 5
+	maxScans           = 10
+)
+
+// SeenGrace is how long a repository keeps showing up in a viewer's feed after
+// it was first served to them, so refreshing and paging stay stable.
+const SeenGrace = 30 * time.Minute
+
+var (
+	ErrUnknownFeed = errors.New("unknown feed")
+	ErrBadCursor   = errors.New("bad cursor")
+)
+
+type Request struct {
+	Cursor string
+	Limit  int
+	// Viewer is the DID of the account reading the feed, empty when anonymous.
+	Viewer string
+
+	// seen holds the repositories the viewer has already been shown in this feed.
+	seen map[db.Repository]bool
+}
+
+// hides reports whether p should be left out of the viewer's feed: it's
+// their own post, or about a repository they've seen.
+func (r Request) hides(p db.DBPost) bool {
+	if r.Viewer != "" && p.Did == r.Viewer {
+		return true
+	}
+	repo, ok := db.ParseRepositoryURL(p.URI)
+	return ok && r.seen[repo]
+}
+
+// Page is one page of a feed: the AT-URIs of its posts, and the cursor for
+// the next page, empty on the last one.
+type Page struct {
+	Posts  []string
+	Cursor string
+
+	repos []db.Repository
+}
+
+func (p *Page) add(post db.DBPost) {
+	p.Posts = append(p.Posts, PostURI(post))
+	if repo, ok := db.ParseRepositoryURL(post.URI); ok {
+		p.repos = append(p.repos, repo)
+	}
+}
+
+type Algorithm interface {
+	Skeleton(req Request) (Page, error)
+}
+
+// PostURI is the AT-URI of a stored post.
+func PostURI(p db.DBPost) string {
+	return fmt.Sprintf("at://%s/%s/%s", p.Did, p.Collection, p.Rkey)
+}
+
+// ParsePostURI reads the author DID and rkey from a post's AT-URI. URIs naming
+// the author by handle, or records other than posts, aren't accepted.
+func ParsePostURI(uri string) (did, rkey string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(uri, "at://"), "/")
+	if !strings.HasPrefix(uri, "at://") || len(parts) != 3 {
+		return "", "", false
+	}
+	if !strings.HasPrefix(parts[0], "did:") || parts[1] != "app.bsky.feed.post" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// Cursors are base64 so clients treat them as opaque.
+func encodeCursor(n int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(n, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrBadCursor
+	}
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || n < 0 {
+		return 0, ErrBadCursor
+	}
+	return n, nil
+}
+
+func encodePostCursor(c db.PostCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.String()))
+}
+
+func decodePostCursor(cursor string) (db.PostCursor, error) {
+	if cursor == "" {
+		return db.PostCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return db.PostCursor{}, ErrBadCursor
+	}
+	c, err := db.ParsePostCursor(string(raw))
+	if err != nil {
+		return db.PostCursor{}, ErrBadCursor
+	}
+	return c, nil
+}
+
+// Latest is every post matching Filter, newest first.
+type Latest struct {
+	Posts  db.PostRepo
+	Filter db.PostFilter
+}
+
+func (l Latest) Skeleton(req Request) (Page, error) {
+	before, err := decodePostCursor(req.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	// Hidden posts are skipped over, reading at most maxScans pages before
+	// handing back a short page and a cursor to continue from.
+	var page Page
+	for scans := 0; scans < maxScans; scans++ {
+		posts, err := l.Posts.GetPostsBefore(before, l.Filter, req.Limit)
+		if err != nil {
+			return Page{}, err
+		}
+		for _, p := range posts {
+			before = p.Cursor()
+			if !req.hides(p) {
+				page.add(p)
+			}
+			if len(page.Posts) == req.Limit {
+				break
+			}
+		}
+		if len(page.Posts) == req.Limit {
+			break
+		}
+		// A short fetch that didn't fill the page was read to the end.
+		if len(posts) < req.Limit {
+			return page, nil
+		}
+	}
+	page.Cursor = encodePostCursor(before)
+	return page, nil
+}
+
+// Trending is the latest post about each trending repository, in ranking order.
+type Trending struct {
+	Engine *trending.Engine
+	Posts  db.PostRepo
+	Window trending.Window
+	Filter db.PostFilter
+}
+
+func (t Trending) Skeleton(req Request) (Page, error) {
+	offset, err := decodeCursor(req.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+	repos, err := t.Engine.Trending(t.Window, t.Filter, maxTrending)
+	if err != nil {
+		return Page{}, err
+	}
+	start := int(min(offset, int64(len(repos))))
+	end := min(start+req.Limit, len(repos))
+
+	var page Page
+	for _, r := range repos[start:end] {
+		filter := t.Filter
+		filter.Forge, filter.Owner, filter.Name = r.Forge, r.Owner, r.Name
+		posts, err := t.Posts.GetPostsBefore(db.PostCursor{}, filter, postsPerRepository)
+		if err != nil {
+			return Page{}, err
+		}
+		for _, p := range posts {
+			if !req.hides(p) {
+				page.add(p)
+				break
+			}
+		}
+	}
+	if end < len(repos) {
+		page.Cursor = encodeCursor(int64(end))
+	}
+	return page, nil
+}
+
+// Generator serves the feeds published by one account.
+type Generator struct {
+	PublisherDID string
+	// Seen, when set, hides repositories from viewers who have already been
+	// shown them in a feed.
+	Seen db.SeenRepo
+
+	names      []string
+	algorithms map[string]Algorithm
+}
+
+func NewGenerator(publisherDID string) *Generator {
+	return &Generator{PublisherDID: publisherDID, algorithms: make(map[string]Algorithm)}
+}
+
+// Default registers latest, trending, and lang-<code> for each of langs.
+func Default(publisherDID string, posts db.PostRepo, engine *trending.Engine, langs []string) *Generator {
+	window, _ := trending.ParseWindow("24h")
+	g := NewGenerator(publisherDID)
+	g.Add("latest", Latest{Posts: posts})
+	g.Add("trending", Trending{Engine: engine, Posts: posts, Window: window})
+	for _, lang := range langs {
+		g.Add("lang-"+lang, Latest{Posts: posts, Filter: db.PostFilter{Lang: lang}})
+	}
+	return g
+}
+
+// Add registers a feed under name, the rkey of its app.bsky.feed.generator record.
+func (g *Generator) Add(name string, a Algorithm) {
+	if _, ok := g.algorithms[name]; !ok {
+		g.names = append(g.names, name)
+	}
+	g.algorithms[name] = a
+}
+
+// FeedURIs lists the AT-URIs of every feed, in the order they were added.
+func (g *Generator) FeedURIs() []string {
+	uris := make([]string, len(g.names))
+	for i, name := range g.names {
+		uris[i] = g.feedURI(name)
+	}
+	return uris
+}
+
+func (g *Generator) feedURI(name string) string {
+	return fmt.Sprintf("at://%s/app.bsky.feed.generator/%s", g.PublisherDID, name)
+}
+
+// Skeleton returns a page of the feed with the given AT-URI.
+func (g *Generator) Skeleton(feed string, req Request) (Page, error) {
+	name, ok := strings.CutPrefix(feed, g.feedURI(""))
+	a := g.algorithms[name]
+	if !ok || a == nil {
+		return Page{}, fmt.Errorf("%w: %s", ErrUnknownFeed, feed)
+	}
+	if req.Limit < 1 || req.Limit > MaxLimit {
+		req.Limit = DefaultLimit
+	}
+	if req.Viewer == "" || g.Seen == nil {
+		return a.Skeleton(req)
+	}
+
+	seen, err := g.Seen.GetSeen(req.Viewer, name, time.Now().Add(-SeenGrace).UnixMicro())
+	if err != nil {
+		return Page{}, err
+	}
+	req.seen = make(map[db.Repository]bool, len(seen))
+	for _, r := range seen {
+		req.seen[r] = true
+	}
+	page, err := a.Skeleton(req)
+	if err != nil {
+		return Page{}, err
+	}
+	if err := g.Seen.MarkSeen(req.Viewer, name, page.repos); err != nil {
+		return Page{}, err
+	}
+	return page, nil
+}
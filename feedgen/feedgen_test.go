@@ -0,0 +1,202 @@
+package feedgen
+
+import (
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"gitfeed/trending"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type mentions []db.Mention
+
+func (m mentions) GetMentions(since int64, filter db.PostFilter) ([]db.Mention, error) {
+	return m, nil
+}
+
+func newRepo(t *testing.T, posts ...db.DBPost) *db.MemoryPostRepository {
+	repo := db.NewMemoryPostRepository()
+	for _, p := range posts {
+		require.NoError(t, repo.WritePost(p))
+	}
+	return repo
+}
+
+func TestLatestPages(t *testing.T) {
+	german := dbtest.Post(4)
+	german.Languages = []string{"de"}
+	repo := newRepo(t, dbtest.Post(1), dbtest.Post(2), dbtest.Post(3), german)
+	g := Default("did:plc:publisher", repo, trending.NewEngine(mentions{}), []string{"de"})
+
+	assert.Equal(t, []string{
+		"at://did:plc:publisher/app.bsky.feed.generator/latest",
+		"at://did:plc:publisher/app.bsky.feed.generator/trending",
+		"at://did:plc:publisher/app.bsky.feed.generator/lang-de",
+	}, g.FeedURIs())
+
+	latest := g.FeedURIs()[0]
+	page, err := g.Skeleton(latest, Request{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(german), PostURI(dbtest.Post(3))}, page.Posts)
+	require.NotEmpty(t, page.Cursor)
+
+	page, err = g.Skeleton(latest, Request{Cursor: page.Cursor, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(dbtest.Post(2)), PostURI(dbtest.Post(1))}, page.Posts)
+
+	page, err = g.Skeleton(latest, Request{Cursor: page.Cursor, Limit: 2})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts)
+	assert.Empty(t, page.Cursor, "the last page has no cursor")
+
+	page, err = g.Skeleton(g.FeedURIs()[2], Request{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"at://did:plc:author4/app.bsky.feed.post/rkey4"}, page.Posts)
+
+	_, err = g.Skeleton(latest, Request{Cursor: "not a cursor", Limit: 2})
+	assert.ErrorIs(t, err, ErrBadCursor)
+	_, err = g.Skeleton("at://did:plc:someone/app.bsky.feed.generator/latest", Request{})
+	assert.ErrorIs(t, err, ErrUnknownFeed)
+	_, err = g.Skeleton("at://did:plc:publisher/app.bsky.feed.generator/missing", Request{})
+	assert.ErrorIs(t, err, ErrUnknownFeed)
+}
+
+func TestLatestPagesPostsSharingATime(t *testing.T) {
+	var posts []db.DBPost
+	for i := 1; i <= 3; i++ {
+		p := dbtest.Post(i)
+		p.TimeUs = dbtest.Post(0).TimeUs
+		posts = append(posts, p)
+	}
+	g := Default("did:plc:publisher", newRepo(t, posts...), trending.NewEngine(mentions{}), nil)
+	latest := g.FeedURIs()[0]
+
+	page, err := g.Skeleton(latest, Request{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(posts[2]), PostURI(posts[1])}, page.Posts)
+
+	page, err = g.Skeleton(latest, Request{Cursor: page.Cursor, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(posts[0])}, page.Posts)
+}
+
+func TestTrendingFollowsRanking(t *testing.T) {
+	older, newer := dbtest.Post(1), dbtest.Post(2)
+	older.URI, newer.URI = "https://github.com/owner/hot", "https://github.com/owner/hot"
+	repo := newRepo(t, older, newer, dbtest.Post(3), dbtest.Post(4))
+
+	now := time.Now().UnixMicro()
+	engine := trending.NewEngine(mentions{
+		{RepositoryID: 1, Forge: "github", Owner: "owner", Name: "hot", Did: "did:plc:a", TimeUs: now},
+		{RepositoryID: 1, Forge: "github", Owner: "owner", Name: "hot", Did: "did:plc:b", TimeUs: now},
+		{RepositoryID: 2, Forge: "github", Owner: "owner", Name: "repo3", Did: "did:plc:c", TimeUs: now},
+		{RepositoryID: 3, Forge: "github", Owner: "owner", Name: "gone", Did: "did:plc:d", TimeUs: now - 1},
+	})
+	g := Default("did:plc:publisher", repo, engine, nil)
+
+	page, err := g.Skeleton(g.FeedURIs()[1], Request{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(newer), PostURI(dbtest.Post(3))}, page.Posts)
+
+	page, err = g.Skeleton(g.FeedURIs()[1], Request{Cursor: page.Cursor, Limit: 2})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts, "repositories without stored posts are skipped")
+	assert.Empty(t, page.Cursor)
+}
+
+// seenRepos records repositories as first seen at now.
+type seenRepos struct {
+	now   int64
+	first map[db.Repository]int64
+}
+
+func (s *seenRepos) MarkSeen(viewer, feed string, repos []db.Repository) error {
+	for _, r := range repos {
+		if _, ok := s.first[r]; !ok {
+			s.first[r] = s.now
+		}
+	}
+	return nil
+}
+
+func (s *seenRepos) GetSeen(viewer, feed string, before int64) ([]db.Repository, error) {
+	var repos []db.Repository
+	for r, first := range s.first {
+		if first < before {
+			repos = append(repos, r)
+		}
+	}
+	return repos, nil
+}
+
+func TestPersonalizedLatest(t *testing.T) {
+	own := dbtest.Post(3)
+	own.Did = viewerDID
+	repo := newRepo(t, dbtest.Post(1), dbtest.Post(2), own, dbtest.Post(4))
+	seen := &seenRepos{now: time.Now().UnixMicro(), first: make(map[db.Repository]int64)}
+	g := Default("did:plc:publisher", repo, trending.NewEngine(mentions{}), nil)
+	g.Seen = seen
+	latest := g.FeedURIs()[0]
+
+	page, err := g.Skeleton(latest, Request{Viewer: viewerDID, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(dbtest.Post(4)), PostURI(dbtest.Post(2))}, page.Posts, "the viewer's own post is hidden")
+
+	page, err = g.Skeleton(latest, Request{Viewer: viewerDID, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 3, "repositories stay visible during the grace period")
+
+	// Once the grace period is over, only the repository never served is left.
+	seen.now = time.Now().Add(-SeenGrace - time.Minute).UnixMicro()
+	for r := range seen.first {
+		seen.first[r] = seen.now
+	}
+	delete(seen.first, db.Repository{Forge: "github", Owner: "owner", Name: "repo1"})
+	page, err = g.Skeleton(latest, Request{Viewer: viewerDID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(dbtest.Post(1))}, page.Posts)
+
+	page, err = g.Skeleton(latest, Request{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 4, "anonymous viewers get the full feed")
+}
+
+func TestLatestPageFillingMidFetchKeepsCursor(t *testing.T) {
+	own := dbtest.Post(5)
+	own.Did = viewerDID
+	repo := newRepo(t, dbtest.Post(1), dbtest.Post(2), dbtest.Post(3), dbtest.Post(4), own)
+	g := Default("did:plc:publisher", repo, trending.NewEngine(mentions{}), nil)
+	g.Seen = &seenRepos{now: time.Now().UnixMicro(), first: make(map[db.Repository]int64)}
+	latest := g.FeedURIs()[0]
+
+	// The second, short fetch fills the page at post 2, leaving post 1 unread.
+	page, err := g.Skeleton(latest, Request{Viewer: viewerDID, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(dbtest.Post(4)), PostURI(dbtest.Post(3)), PostURI(dbtest.Post(2))}, page.Posts)
+	require.NotEmpty(t, page.Cursor)
+
+	page, err = g.Skeleton(latest, Request{Viewer: viewerDID, Cursor: page.Cursor, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PostURI(dbtest.Post(1))}, page.Posts)
+	assert.Empty(t, page.Cursor)
+}
+
+func TestParsePostURI(t *testing.T) {
+	did, rkey, ok := ParsePostURI(PostURI(dbtest.Post(1)))
+	assert.True(t, ok)
+	assert.Equal(t, dbtest.Post(1).Did, did)
+	assert.Equal(t, dbtest.Post(1).Rkey, rkey)
+
+	for _, uri := range []string{
+		"at://alice.bsky.social/app.bsky.feed.post/rkey1",
+		"at://did:plc:a/app.bsky.feed.like/rkey1",
+		"at://did:plc:a/app.bsky.feed.post/",
+		"at://did:plc:a/app.bsky.feed.post/rkey1/more",
+		"https://bsky.app/profile/did:plc:a/post/rkey1",
+	} {
+		_, _, ok := ParsePostURI(uri)
+		assert.False(t, ok, uri)
+	}
+}
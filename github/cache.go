@@ -0,0 +1,218 @@
+package github
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"gitfeed/db"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSize = 10000
+	// DefaultTTL is how long a repository is served before it's revalidated.
+	DefaultTTL = time.Hour
+	// DefaultNegativeTTL is how long a missing repository stays missing.
+	DefaultNegativeTTL = 10 * time.Minute
+	// DefaultErrorTTL is how long a stale entry is served after GitHub fails
+	// before trying again.
+	DefaultErrorTTL = time.Minute
+)
+
+var (
+	ErrNotFound    = errors.New("not found on github")
+	ErrUnavailable = errors.New("github unavailable")
+)
+
+type entry struct {
+	resp    db.CachedResponse
+	expires time.Time
+}
+
+// lru keeps the most recently used entries in memory.
+type lru struct {
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(k string) (entry, bool) {
+	el, ok := l.items[k]
+	if !ok {
+		return entry{}, false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(entry), true
+}
+
+func (l *lru) add(k string, e entry) {
+	if el, ok := l.items[k]; ok {
+		el.Value = e
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[k] = l.order.PushFront(e)
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(entry).resp.Path)
+	}
+}
+
+type call struct {
+	done chan struct{}
+	resp db.CachedResponse
+	err  error
+}
+
+// Cache answers GitHub API lookups from memory, then SQLite, then GitHub.
+// Expired entries are revalidated with their ETag, concurrent lookups of the
+// same path share one request, and when GitHub fails the last good response
+// is served instead.
+type Cache struct {
+	fetcher Fetcher
+	store   db.GitHubCacheRepo
+
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	ErrorTTL    time.Duration
+
+	mu       sync.Mutex
+	lru      *lru
+	inflight map[string]*call
+	now      func() time.Time
+}
+
+// NewCache keeps up to size entries in memory. store may be nil to cache in memory only.
+func NewCache(fetcher Fetcher, store db.GitHubCacheRepo, size int) *Cache {
+	return &Cache{
+		fetcher:     fetcher,
+		store:       store,
+		TTL:         DefaultTTL,
+		NegativeTTL: DefaultNegativeTTL,
+		ErrorTTL:    DefaultErrorTTL,
+		lru:         newLRU(size),
+		inflight:    make(map[string]*call),
+		now:         time.Now,
+	}
+}
+
+// Get returns the GitHub API response for owner/name.
+func (c *Cache) Get(ctx context.Context, owner, name string) (db.CachedResponse, error) {
+	return c.get(ctx, RepoPath(owner, name))
+}
+
+// get returns the GitHub API response for path.
+func (c *Cache) get(ctx context.Context, k string) (db.CachedResponse, error) {
+	c.mu.Lock()
+	e, ok := c.lru.get(k)
+	c.mu.Unlock()
+	if !ok && c.store != nil {
+		resp, err := c.store.GetCachedResponse(k)
+		switch {
+		case err == nil:
+			e, ok = entry{resp: resp, expires: time.UnixMicro(resp.FetchedAt).Add(c.ttl(resp.Status))}, true
+			c.mu.Lock()
+			c.lru.add(k, e)
+			c.mu.Unlock()
+		case !errors.Is(err, db.ErrNotFound):
+			log.Printf("Error reading GitHub cache: %v", err)
+		}
+	}
+	if ok && c.now().Before(e.expires) {
+		return result(e.resp)
+	}
+
+	c.mu.Lock()
+	cl, running := c.inflight[k]
+	if !running {
+		cl = &call{done: make(chan struct{})}
+		c.inflight[k] = cl
+	}
+	c.mu.Unlock()
+
+	if !running {
+		// The request outlives callers that give up, so it still fills the
+		// cache for whoever asks next.
+		go func() {
+			cl.resp, cl.err = c.refresh(context.WithoutCancel(ctx), k, e, ok)
+			c.mu.Lock()
+			delete(c.inflight, k)
+			c.mu.Unlock()
+			close(cl.done)
+		}()
+	}
+
+	select {
+	case <-cl.done:
+	case <-ctx.Done():
+		return db.CachedResponse{}, ctx.Err()
+	}
+	if cl.err != nil {
+		return db.CachedResponse{}, cl.err
+	}
+	return result(cl.resp)
+}
+
+func result(resp db.CachedResponse) (db.CachedResponse, error) {
+	if resp.Status == http.StatusNotFound {
+		return resp, fmt.Errorf("%w: %s", ErrNotFound, resp.Path)
+	}
+	return resp, nil
+}
+
+func (c *Cache) ttl(status int) time.Duration {
+	if status == http.StatusNotFound {
+		return c.NegativeTTL
+	}
+	return c.TTL
+}
+
+func (c *Cache) refresh(ctx context.Context, k string, old entry, have bool) (db.CachedResponse, error) {
+	var etag string
+	if have && old.resp.Status == http.StatusOK {
+		etag = old.resp.ETag
+	}
+	resp, err := c.fetcher.Get(ctx, k, etag)
+	now := c.now()
+
+	cached := db.CachedResponse{Path: k, Status: resp.Status, FetchedAt: now.UnixMicro()}
+	switch {
+	case err == nil && resp.Status == http.StatusOK:
+		cached.ETag, cached.Body = resp.ETag, resp.Body
+	case err == nil && resp.Status == http.StatusNotModified && etag != "":
+		cached = old.resp
+		cached.FetchedAt = now.UnixMicro()
+	case err == nil && resp.Status == http.StatusNotFound:
+	default:
+		if err == nil {
+			err = fmt.Errorf("github returned %d for %s", resp.Status, k)
+		}
+		if !have {
+			return db.CachedResponse{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		log.Printf("Serving stale %s: %v", k, err)
+		c.mu.Lock()
+		c.lru.add(k, entry{resp: old.resp, expires: now.Add(c.ErrorTTL)})
+		c.mu.Unlock()
+		return old.resp, nil
+	}
+
+	c.mu.Lock()
+	c.lru.add(k, entry{resp: cached, expires: now.Add(c.ttl(cached.Status))})
+	c.mu.Unlock()
+	if c.store != nil {
+		if err := c.store.PutCachedResponse(cached); err != nil {
+			log.Printf("Error writing GitHub cache: %v", err)
+		}
+	}
+	return cached, nil
+}
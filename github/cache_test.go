@@ -0,0 +1,159 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"gitfeed/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetcher answers with responses in turn and records the ETags it was sent.
+type fetcher struct {
+	mu        sync.Mutex
+	responses []Response
+	err       error
+	etags     []string
+	release   chan struct{}
+}
+
+func (f *fetcher) Get(ctx context.Context, path, etag string) (Response, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.etags = append(f.etags, etag)
+	if f.err != nil {
+		return Response{}, f.err
+	}
+	resp := f.responses[0]
+	if len(f.responses) > 1 {
+		f.responses = f.responses[1:]
+	}
+	return resp, nil
+}
+
+func (f *fetcher) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.etags)
+}
+
+type store map[string]db.CachedResponse
+
+func (s store) GetCachedResponse(path string) (db.CachedResponse, error) {
+	if c, ok := s[path]; ok {
+		return c, nil
+	}
+	return db.CachedResponse{}, db.ErrNotFound
+}
+
+func (s store) PutCachedResponse(c db.CachedResponse) error {
+	s[c.Path] = c
+	return nil
+}
+
+func newTestCache(f Fetcher, s db.GitHubCacheRepo, size int) (*Cache, *time.Time) {
+	c := NewCache(f, s, size)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+var repoResponse = Response{Status: http.StatusOK, ETag: `"v1"`, Body: []byte(`{"full_name":"owner/repo"}`)}
+
+func TestCacheRevalidates(t *testing.T) {
+	f := &fetcher{responses: []Response{repoResponse, {Status: http.StatusNotModified}}}
+	s := store{}
+	c, now := newTestCache(f, s, DefaultSize)
+
+	for range 2 {
+		repo, err := c.Get(context.Background(), "Owner", "Repo")
+		require.NoError(t, err)
+		assert.Equal(t, repoResponse.Body, repo.Body)
+	}
+	assert.Equal(t, 1, f.calls(), "fresh entries are served from memory")
+
+	*now = now.Add(DefaultTTL + time.Second)
+	repo, err := c.Get(context.Background(), "owner", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, repoResponse.Body, repo.Body, "a 304 keeps the cached body")
+	assert.Equal(t, []string{"", `"v1"`}, f.etags)
+	assert.Equal(t, now.UnixMicro(), s["/repos/owner/repo"].FetchedAt)
+
+	// A new process starts from what was persisted.
+	c, _ = newTestCache(f, s, DefaultSize)
+	_, err = c.Get(context.Background(), "owner", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, 2, f.calls())
+}
+
+func TestCacheNegative(t *testing.T) {
+	f := &fetcher{responses: []Response{{Status: http.StatusNotFound}, repoResponse}}
+	c, now := newTestCache(f, nil, DefaultSize)
+
+	for range 2 {
+		_, err := c.Get(context.Background(), "owner", "gone")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 1, f.calls())
+
+	*now = now.Add(DefaultNegativeTTL + time.Second)
+	_, err := c.Get(context.Background(), "owner", "gone")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", ""}, f.etags, "missing repositories aren't revalidated with an ETag")
+}
+
+func TestCacheServesStaleOnError(t *testing.T) {
+	f := &fetcher{responses: []Response{repoResponse, {Status: http.StatusForbidden}}}
+	c, now := newTestCache(f, nil, DefaultSize)
+	_, err := c.Get(context.Background(), "owner", "repo")
+	require.NoError(t, err)
+
+	*now = now.Add(DefaultTTL + time.Second)
+	for range 2 {
+		repo, err := c.Get(context.Background(), "owner", "repo")
+		require.NoError(t, err)
+		assert.Equal(t, repoResponse.Body, repo.Body)
+	}
+	assert.Equal(t, 2, f.calls(), "failures are retried after ErrorTTL, not on every lookup")
+
+	f.err = errors.New("connection refused")
+	_, err = c.Get(context.Background(), "owner", "other")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestCacheCoalesces(t *testing.T) {
+	f := &fetcher{responses: []Response{repoResponse}, release: make(chan struct{})}
+	c, _ := newTestCache(f, nil, DefaultSize)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Get(context.Background(), "owner", "repo")
+			assert.NoError(t, err)
+		}()
+	}
+	// Give every lookup time to join the first one before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+	assert.Equal(t, 1, f.calls())
+}
+
+func TestCacheEvicts(t *testing.T) {
+	f := &fetcher{responses: []Response{repoResponse}}
+	c, _ := newTestCache(f, nil, 1)
+	for _, name := range []string{"a", "b", "a"} {
+		_, err := c.Get(context.Background(), "owner", name)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, f.calls())
+}
@@ -0,0 +1,181 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL    = "https://api.github.com"
+	DefaultMaxRetries = 3
+	// DefaultMaxWait caps how long one request waits on a backoff or rate
+	// limit before giving up.
+	DefaultMaxWait = 30 * time.Second
+	DefaultBackoff = time.Second
+
+	maxBody = 5 << 20
+)
+
+var ErrRateLimited = errors.New("github rate limit exceeded")
+
+// Client calls the GitHub REST API. It retries server errors and secondary
+// rate limits with backoff, and stops calling once the primary rate limit
+// is used up until it resets.
+type Client struct {
+	BaseURL string
+	// Token is sent as a bearer token when set.
+	Token      string
+	HTTP       *http.Client
+	MaxRetries int
+	MaxWait    time.Duration
+	// Backoff is the first retry delay, doubled after each attempt.
+	Backoff time.Duration
+
+	mu sync.Mutex
+	// remaining is the rate limit left before reset, -1 until GitHub reports it.
+	remaining int
+	reset     time.Time
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    baseURL,
+		Token:      token,
+		HTTP:       &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: DefaultMaxRetries,
+		MaxWait:    DefaultMaxWait,
+		Backoff:    DefaultBackoff,
+		remaining:  -1,
+		now:        time.Now,
+		sleep:      sleep,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Get requests path under BaseURL, conditionally when etag is set. Responses
+// that still fail after retrying are returned for the caller to handle.
+func (c *Client) Get(ctx context.Context, path, etag string) (Response, error) {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := c.throttle(ctx); err != nil {
+			return Response{}, err
+		}
+		resp, wait, err := c.do(ctx, path, etag)
+		if ctx.Err() != nil {
+			return Response{}, ctx.Err()
+		}
+		retry := err != nil || resp.Status >= 500 || wait > 0
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		if !retry {
+			return resp, nil
+		}
+		if attempt >= c.MaxRetries || wait > c.MaxWait {
+			if err != nil {
+				return Response{}, err
+			}
+			if resp.Status == http.StatusForbidden || resp.Status == http.StatusTooManyRequests {
+				return Response{}, fmt.Errorf("%w: retry after %s", ErrRateLimited, wait)
+			}
+			return resp, nil
+		}
+		reason := http.StatusText(resp.Status)
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Printf("Retrying GitHub %s in %s: %s", path, wait, reason)
+		if err := c.sleep(ctx, wait); err != nil {
+			return Response{}, err
+		}
+	}
+}
+
+// throttle waits out a used-up rate limit, or fails if it resets too far off.
+func (c *Client) throttle(ctx context.Context) error {
+	c.mu.Lock()
+	var wait time.Duration
+	if c.remaining == 0 {
+		wait = c.reset.Sub(c.now())
+	}
+	c.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	if wait > c.MaxWait {
+		return fmt.Errorf("%w until %s", ErrRateLimited, c.reset.Format(time.RFC3339))
+	}
+	return c.sleep(ctx, wait)
+}
+
+// do makes one request. wait is set when GitHub asked to slow down.
+func (c *Client) do(ctx context.Context, path, etag string) (Response, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+path, nil)
+	if err != nil {
+		return Response{}, 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "gitfeed")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return Response{}, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return Response{}, 0, err
+	}
+	out := Response{Status: resp.StatusCode, ETag: resp.Header.Get("ETag"), Body: body}
+
+	remaining, rerr := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, serr := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if rerr == nil && serr == nil {
+		c.mu.Lock()
+		c.remaining, c.reset = remaining, time.Unix(reset, 0)
+		c.mu.Unlock()
+	}
+
+	if out.Status != http.StatusForbidden && out.Status != http.StatusTooManyRequests {
+		return out, 0, nil
+	}
+	// Secondary rate limits say how long to back off; the primary one says when it resets.
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return out, max(time.Duration(s)*time.Second, time.Second), nil
+	}
+	if rerr == nil && serr == nil && remaining == 0 {
+		return out, max(time.Unix(reset, 0).Sub(c.now()), time.Second), nil
+	}
+	return out, 0, nil
+}
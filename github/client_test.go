@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"gitfeed/github/githubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestClient records waits instead of sleeping.
+func newTestClient(s *githubtest.Server, token string) (*Client, *[]time.Duration) {
+	c := NewClient(s.URL, token)
+	var waits []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return c, &waits
+}
+
+func TestClientGet(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo", map[string]string{"full_name": "owner/repo"})
+	c, waits := newTestClient(s, "secret")
+
+	resp, err := c.Get(context.Background(), RepoPath("Owner", "Repo"), "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.JSONEq(t, `{"full_name":"owner/repo"}`, string(resp.Body))
+	require.NotEmpty(t, resp.ETag)
+
+	resp, err = c.Get(context.Background(), RepoPath("owner", "repo"), resp.ETag)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.Status)
+
+	resp, err = c.Get(context.Background(), RepoPath("owner", "missing"), "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.Status, "client errors aren't retried")
+
+	reqs := s.Requests()
+	require.Len(t, reqs, 3)
+	assert.Equal(t, "Bearer secret", reqs[0].Authorization)
+	assert.Equal(t, "/repos/owner/repo", reqs[0].Path, "paths are normalized to the cached form")
+	assert.Empty(t, *waits)
+}
+
+func TestClientRetries(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo", map[string]string{"full_name": "owner/repo"})
+	c, waits := newTestClient(s, "")
+
+	s.Fail(http.StatusBadGateway, http.StatusForbidden, http.StatusServiceUnavailable)
+	resp, err := c.Get(context.Background(), RepoPath("owner", "repo"), "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, []time.Duration{time.Second, time.Second, 2 * time.Second}, *waits,
+		"server errors back off exponentially and secondary limits wait Retry-After")
+	assert.Empty(t, s.Requests()[0].Authorization)
+
+	*waits = nil
+	s.Fail(500, 500, 500, 500)
+	resp, err = c.Get(context.Background(), RepoPath("owner", "repo"), "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.Status, "the last failure is returned once retries run out")
+	assert.Len(t, *waits, DefaultMaxRetries)
+}
+
+func TestClientThrottles(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo", map[string]string{"full_name": "owner/repo"})
+	s.SetRateLimit(1, time.Now().Add(time.Hour))
+	c, _ := newTestClient(s, "")
+
+	_, err := c.Get(context.Background(), RepoPath("owner", "repo"), "")
+	require.NoError(t, err)
+	_, err = c.Get(context.Background(), RepoPath("owner", "repo"), "")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Len(t, s.Requests(), 1, "no request is made once the limit is used up")
+
+	// A limit that resets soon is waited out and retried, until retries run out.
+	s.SetRateLimit(0, time.Now().Add(5*time.Second))
+	c, waits := newTestClient(s, "")
+	_, err = c.Get(context.Background(), RepoPath("owner", "repo"), "")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	require.NotEmpty(t, *waits)
+	assert.InDelta(t, 5*time.Second, (*waits)[0], float64(2*time.Second))
+	assert.Len(t, s.Requests(), 1+1+DefaultMaxRetries)
+}
@@ -0,0 +1,29 @@
+// Package github looks up repositories, issues, releases, commits and gists
+// from the GitHub API, caching responses so cards don't spend the API's rate
+// limit on every render.
+package github
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Response is what GitHub answered for a request. Status is
+// http.StatusNotModified when the ETag sent still matches.
+type Response struct {
+	Status int
+	ETag   string
+	Body   []byte
+}
+
+type Fetcher interface {
+	// Get requests an API path, conditionally when etag is set.
+	Get(ctx context.Context, path, etag string) (Response, error)
+}
+
+// RepoPath is the API path of owner/name. GitHub treats both
+// case-insensitively, so they're lowercased to share one cache entry.
+func RepoPath(owner, name string) string {
+	return "/repos/" + url.PathEscape(strings.ToLower(owner)) + "/" + url.PathEscape(strings.ToLower(name))
+}
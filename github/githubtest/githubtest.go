@@ -0,0 +1,133 @@
+// Package githubtest is a stand-in GitHub API for tests, serving canned JSON
+// with ETags and rate-limit headers from an httptest server.
+package githubtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Request is what the server saw of a call.
+type Request struct {
+	Path          string
+	Authorization string
+	IfNoneMatch   string
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	bodies    map[string][]byte
+	failures  []int
+	remaining int
+	reset     time.Time
+	requests  []Request
+}
+
+// NewServer starts a server that's closed when the test ends.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{bodies: make(map[string][]byte), remaining: -1}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Set serves v as JSON at the API path, e.g. /repos/owner/name. Paths match
+// case-insensitively, like GitHub's.
+func (s *Server) Set(path string, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies[strings.ToLower(path)] = body
+}
+
+func (s *Server) SetRepo(owner, name string, v any) {
+	s.Set("/repos/"+owner+"/"+name, v)
+}
+
+// Fail answers the next requests with these statuses, one each. 403 and 429
+// come with a Retry-After of one second, like a secondary rate limit.
+func (s *Server) Fail(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+// SetRateLimit reports remaining requests until reset, counting down with
+// each request and answering 403 once none are left.
+func (s *Server) SetRateLimit(remaining int, reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remaining, s.reset = remaining, reset
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{
+		Path:          r.URL.Path,
+		Authorization: r.Header.Get("Authorization"),
+		IfNoneMatch:   r.Header.Get("If-None-Match"),
+	})
+
+	if s.remaining >= 0 {
+		limited := s.remaining == 0
+		if !limited {
+			s.remaining--
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(s.reset.Unix(), 10))
+		if limited {
+			writeError(w, http.StatusForbidden, "API rate limit exceeded")
+			return
+		}
+	}
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		if status == http.StatusForbidden || status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, status, http.StatusText(status))
+		return
+	}
+
+	body, ok := s.bodies[strings.ToLower(r.URL.Path)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,109 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gitfeed/db"
+	"log"
+	"sync"
+)
+
+// maxConcurrent caps the lookups GetRepos runs at once.
+const maxConcurrent = 8
+
+// Repo is the repository metadata cards show.
+type Repo struct {
+	FullName    string   `json:"full_name"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Stars       int      `json:"stars"`
+	Forks       int      `json:"forks"`
+	Language    string   `json:"language"`
+	Topics      []string `json:"topics"`
+	License     string   `json:"license"`
+	Archived    bool     `json:"archived"`
+}
+
+// ParseRepo reads a GitHub API repository response.
+func ParseRepo(body []byte) (Repo, error) {
+	var raw struct {
+		FullName        string   `json:"full_name"`
+		Name            string   `json:"name"`
+		Description     string   `json:"description"`
+		HTMLURL         string   `json:"html_url"`
+		StargazersCount int      `json:"stargazers_count"`
+		ForksCount      int      `json:"forks_count"`
+		Language        string   `json:"language"`
+		Topics          []string `json:"topics"`
+		Archived        bool     `json:"archived"`
+		License         *struct {
+			SPDXID string `json:"spdx_id"`
+			Name   string `json:"name"`
+		} `json:"license"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Repo{}, err
+	}
+	r := Repo{
+		FullName:    raw.FullName,
+		Name:        raw.Name,
+		Description: raw.Description,
+		URL:         raw.HTMLURL,
+		Stars:       raw.StargazersCount,
+		Forks:       raw.ForksCount,
+		Language:    raw.Language,
+		Topics:      raw.Topics,
+		Archived:    raw.Archived,
+	}
+	if raw.License != nil {
+		// GitHub reports licenses it can't identify as NOASSERTION.
+		r.License = raw.License.SPDXID
+		if r.License == "" || r.License == "NOASSERTION" {
+			r.License = raw.License.Name
+		}
+	}
+	return r, nil
+}
+
+// GetRepos looks up GitHub repositories concurrently, returning those found
+// before ctx is done. Lookups still running carry on to fill the cache.
+func (c *Cache) GetRepos(ctx context.Context, repos []db.Repository) map[db.Repository]Repo {
+	found := make(map[db.Repository]Repo, len(repos))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrent)
+	for _, r := range repos {
+		if r.Forge != "github" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			cached, err := c.Get(ctx, r.Owner, r.Name)
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) && ctx.Err() == nil {
+					log.Printf("Error looking up %s/%s: %v", r.Owner, r.Name, err)
+				}
+				return
+			}
+			repo, err := ParseRepo(cached.Body)
+			if err != nil {
+				log.Printf("Error parsing %s/%s: %v", r.Owner, r.Name, err)
+				return
+			}
+			mu.Lock()
+			found[r] = repo
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return found
+}
@@ -0,0 +1,60 @@
+package github
+
+import (
+	"context"
+	"gitfeed/db"
+	"gitfeed/github/githubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRepo(t *testing.T) {
+	repo, err := ParseRepo([]byte(`{
+		"full_name": "owner/repo", "name": "repo", "description": "a repo",
+		"html_url": "https://github.com/owner/repo", "stargazers_count": 12, "forks_count": 3,
+		"language": "Go", "topics": ["cli"], "archived": true,
+		"license": {"spdx_id": "NOASSERTION", "name": "Other"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, Repo{
+		FullName: "owner/repo", Name: "repo", Description: "a repo", URL: "https://github.com/owner/repo",
+		Stars: 12, Forks: 3, Language: "Go", Topics: []string{"cli"}, License: "Other", Archived: true,
+	}, repo)
+}
+
+func TestGetRepos(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "a", map[string]any{"full_name": "owner/a", "stargazers_count": 1})
+	s.SetRepo("owner", "b", map[string]any{"full_name": "owner/b", "stargazers_count": 2})
+	c := NewCache(NewClient(s.URL, ""), nil, DefaultSize)
+
+	a := db.Repository{Forge: "github", Owner: "owner", Name: "a"}
+	b := db.Repository{Forge: "github", Owner: "owner", Name: "b"}
+	found := c.GetRepos(context.Background(), []db.Repository{
+		a, b,
+		{Forge: "github", Owner: "owner", Name: "missing"},
+		{Forge: "codeberg", Owner: "owner", Name: "a"},
+	})
+	assert.Equal(t, map[db.Repository]Repo{a: {FullName: "owner/a", Stars: 1}, b: {FullName: "owner/b", Stars: 2}}, found)
+	assert.Len(t, s.Requests(), 3, "only GitHub repositories are looked up")
+}
+
+func TestGetReposDeadline(t *testing.T) {
+	f := &fetcher{responses: []Response{{Status: http.StatusOK, Body: []byte(`{"full_name":"owner/slow"}`)}}, release: make(chan struct{})}
+	c := NewCache(f, nil, DefaultSize)
+	slow := db.Repository{Forge: "github", Owner: "owner", Name: "slow"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Empty(t, c.GetRepos(ctx, []db.Repository{slow}))
+
+	// The lookup finishes in the background and is cached for the next request.
+	close(f.release)
+	assert.Eventually(t, func() bool {
+		return len(c.GetRepos(context.Background(), []db.Repository{slow})) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, f.calls())
+}
@@ -0,0 +1,208 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Issue is an issue or pull request. State is open or closed, or merged for
+// merged pull requests.
+type Issue struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	State       string    `json:"state"`
+	PullRequest bool      `json:"pull_request"`
+	Author      string    `json:"author"`
+	Comments    int       `json:"comments"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Release struct {
+	Tag         string    `json:"tag"`
+	Name        string    `json:"name"`
+	Author      string    `json:"author"`
+	Prerelease  bool      `json:"prerelease"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Commit has the author's GitHub login when GitHub could match their email,
+// and the name from the commit otherwise.
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	URL     string    `json:"url"`
+	Date    time.Time `json:"date"`
+}
+
+type Gist struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Owner       string     `json:"owner"`
+	Files       []GistFile `json:"files"`
+	URL         string     `json:"url"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type GistFile struct {
+	Filename string `json:"filename"`
+	Language string `json:"language"`
+	Size     int    `json:"size"`
+}
+
+type user struct {
+	Login string `json:"login"`
+}
+
+func ParseIssue(body []byte) (Issue, error) {
+	var raw struct {
+		Number      int       `json:"number"`
+		Title       string    `json:"title"`
+		State       string    `json:"state"`
+		User        user      `json:"user"`
+		Comments    int       `json:"comments"`
+		HTMLURL     string    `json:"html_url"`
+		CreatedAt   time.Time `json:"created_at"`
+		PullRequest *struct {
+			MergedAt *time.Time `json:"merged_at"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Issue{}, err
+	}
+	i := Issue{
+		Number:      raw.Number,
+		Title:       raw.Title,
+		State:       raw.State,
+		PullRequest: raw.PullRequest != nil,
+		Author:      raw.User.Login,
+		Comments:    raw.Comments,
+		URL:         raw.HTMLURL,
+		CreatedAt:   raw.CreatedAt,
+	}
+	if raw.PullRequest != nil && raw.PullRequest.MergedAt != nil {
+		i.State = "merged"
+	}
+	return i, nil
+}
+
+func ParseRelease(body []byte) (Release, error) {
+	var raw struct {
+		TagName     string    `json:"tag_name"`
+		Name        string    `json:"name"`
+		Author      user      `json:"author"`
+		Prerelease  bool      `json:"prerelease"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Release{}, err
+	}
+	return Release{
+		Tag:         raw.TagName,
+		Name:        raw.Name,
+		Author:      raw.Author.Login,
+		Prerelease:  raw.Prerelease,
+		URL:         raw.HTMLURL,
+		PublishedAt: raw.PublishedAt,
+	}, nil
+}
+
+func ParseCommit(body []byte) (Commit, error) {
+	var raw struct {
+		SHA     string `json:"sha"`
+		HTMLURL string `json:"html_url"`
+		Author  *user  `json:"author"`
+		Commit  struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string    `json:"name"`
+				Date time.Time `json:"date"`
+			} `json:"author"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Commit{}, err
+	}
+	c := Commit{
+		SHA:     raw.SHA,
+		Message: raw.Commit.Message,
+		Author:  raw.Commit.Author.Name,
+		URL:     raw.HTMLURL,
+		Date:    raw.Commit.Author.Date,
+	}
+	if raw.Author != nil && raw.Author.Login != "" {
+		c.Author = raw.Author.Login
+	}
+	return c, nil
+}
+
+func ParseGist(body []byte) (Gist, error) {
+	var raw struct {
+		ID          string              `json:"id"`
+		Description string              `json:"description"`
+		Owner       *user               `json:"owner"`
+		Files       map[string]GistFile `json:"files"`
+		HTMLURL     string              `json:"html_url"`
+		CreatedAt   time.Time           `json:"created_at"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Gist{}, err
+	}
+	g := Gist{
+		ID:          raw.ID,
+		Description: raw.Description,
+		Files:       make([]GistFile, 0, len(raw.Files)),
+		URL:         raw.HTMLURL,
+		CreatedAt:   raw.CreatedAt,
+	}
+	if raw.Owner != nil {
+		g.Owner = raw.Owner.Login
+	}
+	for _, f := range raw.Files {
+		g.Files = append(g.Files, f)
+	}
+	sort.Slice(g.Files, func(i, j int) bool { return g.Files[i].Filename < g.Files[j].Filename })
+	return g, nil
+}
+
+// getParsed looks up path through the cache and parses the response.
+func getParsed[T any](ctx context.Context, c *Cache, path string, parse func([]byte) (T, error)) (T, error) {
+	var v T
+	cached, err := c.get(ctx, path)
+	if err != nil {
+		return v, err
+	}
+	return parse(cached.Body)
+}
+
+// GetIssue looks up an issue or pull request by number; GitHub's issues API
+// answers for both.
+func (c *Cache) GetIssue(ctx context.Context, owner, name string, number int) (Issue, error) {
+	return getParsed(ctx, c, RepoPath(owner, name)+"/issues/"+strconv.Itoa(number), ParseIssue)
+}
+
+// GetRelease looks up a release by tag, or the latest release when tag is
+// "latest". Tags are case-sensitive.
+func (c *Cache) GetRelease(ctx context.Context, owner, name, tag string) (Release, error) {
+	path := RepoPath(owner, name) + "/releases/tags/" + url.PathEscape(tag)
+	if tag == "latest" {
+		path = RepoPath(owner, name) + "/releases/latest"
+	}
+	return getParsed(ctx, c, path, ParseRelease)
+}
+
+func (c *Cache) GetCommit(ctx context.Context, owner, name, sha string) (Commit, error) {
+	return getParsed(ctx, c, RepoPath(owner, name)+"/commits/"+url.PathEscape(strings.ToLower(sha)), ParseCommit)
+}
+
+func (c *Cache) GetGist(ctx context.Context, id string) (Gist, error) {
+	return getParsed(ctx, c, "/gists/"+url.PathEscape(strings.ToLower(id)), ParseGist)
+}
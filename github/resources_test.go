@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"gitfeed/github/githubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseIssue(t *testing.T) {
+	issue, err := ParseIssue([]byte(`{
+		"number": 7, "title": "Fix it", "state": "closed", "user": {"login": "octocat"}, "comments": 4,
+		"html_url": "https://github.com/owner/repo/pull/7", "created_at": "2024-05-01T10:00:00Z",
+		"pull_request": {"merged_at": "2024-05-02T10:00:00Z"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, Issue{
+		Number: 7, Title: "Fix it", State: "merged", PullRequest: true, Author: "octocat", Comments: 4,
+		URL: "https://github.com/owner/repo/pull/7", CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}, issue)
+
+	issue, err = ParseIssue([]byte(`{"number": 8, "state": "closed", "pull_request": {"merged_at": null}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "closed", issue.State, "closed without merging")
+	issue, err = ParseIssue([]byte(`{"number": 9, "state": "open"}`))
+	require.NoError(t, err)
+	assert.False(t, issue.PullRequest)
+}
+
+func TestParseCommit(t *testing.T) {
+	commit, err := ParseCommit([]byte(`{
+		"sha": "abc123", "html_url": "https://github.com/owner/repo/commit/abc123", "author": null,
+		"commit": {"message": "Initial commit", "author": {"name": "Jane Doe", "date": "2024-05-01T10:00:00Z"}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", commit.Author, "falls back to the git author without a GitHub account")
+	assert.Equal(t, "Initial commit", commit.Message)
+
+	commit, err = ParseCommit([]byte(`{"sha": "abc123", "author": {"login": "jdoe"}, "commit": {"author": {"name": "Jane Doe"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe", commit.Author)
+}
+
+func TestParseGist(t *testing.T) {
+	gist, err := ParseGist([]byte(`{
+		"id": "aa5a315d", "description": "snippets", "owner": {"login": "octocat"},
+		"html_url": "https://gist.github.com/octocat/aa5a315d",
+		"files": {
+			"b.go": {"filename": "b.go", "language": "Go", "size": 20, "content": "package b"},
+			"a.md": {"filename": "a.md", "language": "Markdown", "size": 10}
+		}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "octocat", gist.Owner)
+	assert.Equal(t, []GistFile{{"a.md", "Markdown", 10}, {"b.go", "Go", 20}}, gist.Files)
+}
+
+func TestCacheResources(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.Set("/repos/owner/repo/issues/7", map[string]any{"number": 7, "title": "Bug", "state": "open"})
+	s.Set("/repos/owner/repo/releases/tags/V1.0", map[string]any{"tag_name": "V1.0"})
+	s.Set("/repos/owner/repo/releases/latest", map[string]any{"tag_name": "v2.0"})
+	s.Set("/repos/owner/repo/commits/abc123", map[string]any{"sha": "abc123"})
+	s.Set("/gists/aa5a315d", map[string]any{"id": "aa5a315d"})
+	c := NewCache(NewClient(s.URL, ""), store{}, DefaultSize)
+	ctx := context.Background()
+
+	issue, err := c.GetIssue(ctx, "Owner", "Repo", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "Bug", issue.Title)
+	release, err := c.GetRelease(ctx, "owner", "repo", "V1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "V1.0", release.Tag)
+	latest, err := c.GetRelease(ctx, "owner", "repo", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "v2.0", latest.Tag)
+	commit, err := c.GetCommit(ctx, "owner", "repo", "ABC123")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", commit.SHA)
+	gist, err := c.GetGist(ctx, "aa5a315d")
+	require.NoError(t, err)
+	assert.Equal(t, "aa5a315d", gist.ID)
+
+	_, err = c.GetIssue(ctx, "owner", "repo", 8)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	n := len(s.Requests())
+	_, err = c.GetIssue(ctx, "owner", "repo", 7)
+	require.NoError(t, err)
+	assert.Len(t, s.Requests(), n, "served from the cache")
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"gitfeed/db"
+	"gitfeed/export"
+	"log"
+	"net/http"
+	"time"
+)
+
+type ExportService struct {
+	Repository db.ExportRepo
+}
+
+// ExportGetHandler streams a dataset for a time range. It defaults to posts as
+// NDJSON over the retention window.
+func (es *ExportService) ExportGetHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	dataset := export.Posts
+	if d := query.Get("dataset"); d != "" {
+		var err error
+		if dataset, err = export.ParseDataset(d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := export.NDJSON
+	if f := query.Get("format"); f != "" {
+		var err error
+		if format, err = export.ParseFormat(f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	until := time.Now().UTC()
+	since := until.Add(-db.Retention)
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := export.ParseTime(v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	if !since.Before(until) {
+		http.Error(w, "since must be before until", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.Filename(dataset, format, since, until)+`"`)
+
+	// Once rows are streaming the status is already sent, so a failure can only
+	// cut the response short.
+	n, err := export.Export(w, es.Repository, dataset, format, since, until)
+	if err != nil {
+		log.Printf("Error exporting %s after %d rows: %v", dataset, n, err)
+		return
+	}
+	log.Printf("Exported %d %s rows as %s\n", n, dataset, format)
+}
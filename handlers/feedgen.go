@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gitfeed/feedgen"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// FeedService answers the XRPC calls Bluesky makes to a feed generator.
+type FeedService struct {
+	Generator *feedgen.Generator
+	// Hostname is where the generator is served, and names its did:web.
+	Hostname string
+	// Verifier, when set, checks the viewer's service-auth token so feeds can
+	// be personalized. Requests without a token get the anonymous feed.
+	Verifier *feedgen.Verifier
+}
+
+type xrpcError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func writeXRPCError(w http.ResponseWriter, status int, name, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(xrpcError{Error: name, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+func (fs *FeedService) serviceDID() string {
+	return "did:web:" + fs.Hostname
+}
+
+type didDocument struct {
+	Context []string     `json:"@context"`
+	ID      string       `json:"id"`
+	Service []didService `json:"service"`
+}
+
+type didService struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+func (fs *FeedService) DidDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, didDocument{
+		Context: []string{"https://www.w3.org/ns/did/v1"},
+		ID:      fs.serviceDID(),
+		Service: []didService{{
+			ID:              "#bsky_fg",
+			Type:            "BskyFeedGenerator",
+			ServiceEndpoint: "https://" + fs.Hostname,
+		}},
+	})
+}
+
+func (fs *FeedService) DescribeFeedGeneratorHandler(w http.ResponseWriter, r *http.Request) {
+	out := bsky.FeedDescribeFeedGenerator_Output{Did: fs.serviceDID()}
+	for _, uri := range fs.Generator.FeedURIs() {
+		out.Feeds = append(out.Feeds, &bsky.FeedDescribeFeedGenerator_Feed{Uri: uri})
+	}
+	writeJSON(w, out)
+}
+
+func (fs *FeedService) GetFeedSkeletonHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	q := r.URL.Query()
+	req := feedgen.Request{Cursor: q.Get("cursor"), Limit: feedgen.DefaultLimit}
+	if l := q.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > feedgen.MaxLimit {
+			writeXRPCError(w, http.StatusBadRequest, "InvalidRequest", "limit must be between 1 and 100")
+			return
+		}
+		req.Limit = limit
+	}
+
+	if auth := r.Header.Get("Authorization"); auth != "" && fs.Verifier != nil {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok {
+			writeXRPCError(w, http.StatusUnauthorized, "AuthenticationRequired", "expected a Bearer token")
+			return
+		}
+		viewer, err := fs.Verifier.Verify(r.Context(), token)
+		if err != nil {
+			log.Printf("Rejected feed request: %v", err)
+			writeXRPCError(w, http.StatusUnauthorized, "AuthenticationRequired", "invalid service auth token")
+			return
+		}
+		req.Viewer = viewer
+	}
+
+	page, err := fs.Generator.Skeleton(q.Get("feed"), req)
+	switch {
+	case errors.Is(err, feedgen.ErrUnknownFeed):
+		writeXRPCError(w, http.StatusBadRequest, "UnknownFeed", err.Error())
+		return
+	case errors.Is(err, feedgen.ErrBadCursor):
+		writeXRPCError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	case err != nil:
+		log.Printf("Error building feed skeleton: %v", err)
+		writeXRPCError(w, http.StatusInternalServerError, "InternalServerError", "error building feed")
+		return
+	}
+
+	out := bsky.FeedGetFeedSkeleton_Output{Feed: []*bsky.FeedDefs_SkeletonFeedPost{}}
+	for _, uri := range page.Posts {
+		out.Feed = append(out.Feed, &bsky.FeedDefs_SkeletonFeedPost{Post: uri})
+	}
+	if page.Cursor != "" {
+		out.Cursor = &page.Cursor
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"gitfeed/feedgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newFeedService(t *testing.T) *FeedService {
+	repo := db.NewMemoryPostRepository()
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	require.NoError(t, repo.WritePost(dbtest.Post(2)))
+	g := feedgen.NewGenerator("did:plc:publisher")
+	g.Add("latest", feedgen.Latest{Posts: repo})
+	return &FeedService{Generator: g, Hostname: "feed.example.com"}
+}
+
+func TestGetFeedSkeletonHandler(t *testing.T) {
+	fs := newFeedService(t)
+	feed := url.QueryEscape("at://did:plc:publisher/app.bsky.feed.generator/latest")
+
+	rec := httptest.NewRecorder()
+	fs.GetFeedSkeletonHandler(rec, httptest.NewRequest("GET", "/xrpc/app.bsky.feed.getFeedSkeleton?limit=1&feed="+feed, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page struct {
+		Cursor string `json:"cursor"`
+		Feed   []struct {
+			Post string `json:"post"`
+		} `json:"feed"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	require.Len(t, page.Feed, 1)
+	assert.Equal(t, "at://did:plc:author2/app.bsky.feed.post/rkey2", page.Feed[0].Post)
+	assert.NotEmpty(t, page.Cursor)
+
+	for query, want := range map[string]string{
+		"feed=at://did:plc:publisher/app.bsky.feed.generator/other": "UnknownFeed",
+		"feed=" + feed + "&cursor=%21%21":                           "InvalidRequest",
+		"feed=" + feed + "&limit=500":                               "InvalidRequest",
+	} {
+		rec := httptest.NewRecorder()
+		fs.GetFeedSkeletonHandler(rec, httptest.NewRequest("GET", "/xrpc/app.bsky.feed.getFeedSkeleton?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		var got xrpcError
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+		assert.Equal(t, want, got.Error, query)
+	}
+}
+
+func TestFeedGeneratorIdentity(t *testing.T) {
+	fs := newFeedService(t)
+
+	rec := httptest.NewRecorder()
+	fs.DidDocumentHandler(rec, httptest.NewRequest("GET", "/.well-known/did.json", nil))
+	assert.JSONEq(t, `{
+		"@context": ["https://www.w3.org/ns/did/v1"],
+		"id": "did:web:feed.example.com",
+		"service": [{"id": "#bsky_fg", "type": "BskyFeedGenerator", "serviceEndpoint": "https://feed.example.com"}]
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	fs.DescribeFeedGeneratorHandler(rec, httptest.NewRequest("GET", "/xrpc/app.bsky.feed.describeFeedGenerator", nil))
+	assert.JSONEq(t, `{
+		"did": "did:web:feed.example.com",
+		"feeds": [{"uri": "at://did:plc:publisher/app.bsky.feed.generator/latest"}]
+	}`, rec.Body.String())
+}
+
+func TestGetFeedSkeletonAuth(t *testing.T) {
+	fs := newFeedService(t)
+	priv, err := crypto.GeneratePrivateKeyK256()
+	require.NoError(t, err)
+	pub, err := priv.PublicKey()
+	require.NoError(t, err)
+	fs.Verifier = &feedgen.Verifier{
+		Resolver:   feedgen.StaticResolver{"did:plc:author2": pub},
+		ServiceDID: fs.serviceDID(),
+	}
+	feed := url.QueryEscape("at://did:plc:publisher/app.bsky.feed.generator/latest")
+	get := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/xrpc/app.bsky.feed.getFeedSkeleton?feed="+feed, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		fs.GetFeedSkeletonHandler(rec, req)
+		return rec
+	}
+
+	token, err := jwt.NewWithClaims(jwt.GetSigningMethod("ES256K"), jwt.MapClaims{
+		"iss": "did:plc:author2",
+		"aud": fs.serviceDID(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString(priv)
+	require.NoError(t, err)
+	rec := get("Bearer " + token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "did:plc:author2", "the viewer's own post is hidden")
+	assert.Contains(t, rec.Body.String(), "did:plc:author1")
+
+	for _, auth := range []string{"Bearer not-a-jwt", "Basic dXNlcjpwYXNz"} {
+		rec := get(auth)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+		var got xrpcError
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+		assert.Equal(t, "AuthenticationRequired", got.Error)
+	}
+
+	assert.Equal(t, http.StatusOK, get("").Code, "anonymous requests are allowed")
+}
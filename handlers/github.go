@@ -1,37 +1,145 @@
 package handlers
 
 import (
-	"fmt"
-	"io"
+	"errors"
+	"gitfeed/github"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-const githubAPIURL = "https://api.github.com"
+var (
+	shaPattern    = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+	gistIDPattern = regexp.MustCompile(`^[0-9a-zA-Z]+$`)
+)
+
+type GitHubService struct {
+	Cache *github.Cache
+}
 
-func HandleGitHubRepo(w http.ResponseWriter, r *http.Request) {
+// RepoGetHandler proxies GitHub's repository response through the cache.
+func (gs *GitHubService) RepoGetHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Processing github repo %s\n", r.URL.Path)
 	username := r.PathValue("username")
 	repository := r.PathValue("repository")
 
-	log.Printf("Making GH API call... \n")
-	resp, err := http.Get(fmt.Sprintf("%s/repos/%s/%s", githubAPIURL, username, repository))
+	repo, err := gs.Cache.Get(r.Context(), username, repository)
 	if err != nil {
-		log.Printf("Error getting GitHub repo data: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, r, githubError(err, "Repository"))
 		return
 	}
-	if resp.StatusCode != 200 {
-		log.Printf("Error getting GitHub repo data: %v", resp.Status)
-		w.WriteHeader(resp.StatusCode)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(repo.Body)
+}
+
+// RepoGetHandlerV2 serves the repository in the same form posts embed it,
+// rather than GitHub's whole response.
+func (gs *GitHubService) RepoGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Processing github repo %s\n", r.URL.Path)
+	var repo github.Repo
+	cached, err := gs.Cache.Get(r.Context(), r.PathValue("username"), r.PathValue("repository"))
+	if err == nil {
+		repo, err = github.ParseRepo(cached.Body)
+	}
+	writeGitHub(w, r, repo, err, "Repository", writeProblem)
+}
+
+// IssueGetHandler serves an issue or pull request; both /issues/{number} and
+// /pull/{number} links resolve here.
+func (gs *GitHubService) IssueGetHandler(w http.ResponseWriter, r *http.Request) {
+	gs.issue(w, r, writeError)
+}
+
+func (gs *GitHubService) IssueGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	gs.issue(w, r, writeProblem)
+}
+
+func (gs *GitHubService) issue(w http.ResponseWriter, r *http.Request, fail errorWriter) {
+	log.Printf("Processing github issue %s\n", r.URL.Path)
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || number < 1 {
+		fail(w, r, badRequest("number must be a positive integer"))
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	bytes, err := io.ReadAll(resp.Body)
+	issue, err := gs.Cache.GetIssue(r.Context(), r.PathValue("username"), r.PathValue("repository"), number)
+	writeGitHub(w, r, issue, err, "Issue", fail)
+}
+
+// ReleaseGetHandler serves a release by tag, or the latest release.
+func (gs *GitHubService) ReleaseGetHandler(w http.ResponseWriter, r *http.Request) {
+	gs.release(w, r, writeError)
+}
+
+func (gs *GitHubService) ReleaseGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	gs.release(w, r, writeProblem)
+}
+
+func (gs *GitHubService) release(w http.ResponseWriter, r *http.Request, fail errorWriter) {
+	log.Printf("Processing github release %s\n", r.URL.Path)
+	tag := r.PathValue("tag")
+	if tag == "" {
+		tag = "latest"
+	}
+	release, err := gs.Cache.GetRelease(r.Context(), r.PathValue("username"), r.PathValue("repository"), tag)
+	writeGitHub(w, r, release, err, "Release", fail)
+}
+
+func (gs *GitHubService) CommitGetHandler(w http.ResponseWriter, r *http.Request) {
+	gs.commit(w, r, writeError)
+}
+
+func (gs *GitHubService) CommitGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	gs.commit(w, r, writeProblem)
+}
+
+func (gs *GitHubService) commit(w http.ResponseWriter, r *http.Request, fail errorWriter) {
+	log.Printf("Processing github commit %s\n", r.URL.Path)
+	sha := r.PathValue("sha")
+	if !shaPattern.MatchString(sha) {
+		fail(w, r, badRequest("sha must be a hex commit hash"))
+		return
+	}
+	commit, err := gs.Cache.GetCommit(r.Context(), r.PathValue("username"), r.PathValue("repository"), sha)
+	writeGitHub(w, r, commit, err, "Commit", fail)
+}
+
+func (gs *GitHubService) GistGetHandler(w http.ResponseWriter, r *http.Request) {
+	gs.gist(w, r, writeError)
+}
+
+func (gs *GitHubService) GistGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	gs.gist(w, r, writeProblem)
+}
+
+func (gs *GitHubService) gist(w http.ResponseWriter, r *http.Request, fail errorWriter) {
+	log.Printf("Processing github gist %s\n", r.URL.Path)
+	id := r.PathValue("id")
+	if !gistIDPattern.MatchString(id) {
+		fail(w, r, badRequest("invalid gist id"))
+		return
+	}
+	gist, err := gs.Cache.GetGist(r.Context(), id)
+	writeGitHub(w, r, gist, err, "Gist", fail)
+}
+
+// writeGitHub writes v as JSON, or the error looking up the thing it names.
+func writeGitHub(w http.ResponseWriter, r *http.Request, v any, err error, thing string, fail errorWriter) {
 	if err != nil {
-		log.Printf("Error getting bytes: %v", err)
-		w.WriteHeader(500)
+		fail(w, r, githubError(err, thing))
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, v)
+}
+
+// githubError reports things GitHub doesn't have as missing, and any other
+// failure as GitHub's.
+func githubError(err error, thing string) error {
+	if errors.Is(err, github.ErrNotFound) {
+		return notFound(thing + " not found")
 	}
-	w.Write(bytes)
-	defer resp.Body.Close()
+	return failed(err, http.StatusBadGateway, "Error fetching "+strings.ToLower(thing)+" from GitHub")
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"gitfeed/github"
+	"gitfeed/github/githubtest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRepoGetHandler(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo", map[string]string{"full_name": "owner/repo"})
+	client := github.NewClient(s.URL, "")
+	client.MaxRetries = 0
+	gs := &GitHubService{Cache: github.NewCache(client, nil, 10)}
+	get := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/github/owner/"+name, nil)
+		req.SetPathValue("username", "owner")
+		req.SetPathValue("repository", name)
+		rec := httptest.NewRecorder()
+		gs.RepoGetHandler(rec, req)
+		return rec
+	}
+
+	rec := get("repo")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"full_name":"owner/repo"}`, rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, get("gone").Code)
+	s.Fail(http.StatusForbidden)
+	assert.Equal(t, http.StatusBadGateway, get("limited").Code)
+}
+
+func TestGitHubResourceHandlers(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.Set("/repos/owner/repo/issues/7", map[string]any{"number": 7, "title": "Fix it", "state": "open", "pull_request": map[string]any{}})
+	s.Set("/repos/owner/repo/releases/tags/release/v1", map[string]any{"tag_name": "release/v1"})
+	s.Set("/repos/owner/repo/releases/latest", map[string]any{"tag_name": "v2"})
+	s.Set("/repos/owner/repo/commits/abc123", map[string]any{"sha": "abc123", "commit": map[string]any{"message": "Initial commit"}})
+	s.Set("/gists/aa5a315d", map[string]any{"id": "aa5a315d", "files": map[string]any{"a.go": map[string]any{"filename": "a.go"}}})
+	gs := &GitHubService{Cache: github.NewCache(github.NewClient(s.URL, ""), nil, 10)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/github/{username}/{repository}/issues/{number}", gs.IssueGetHandler)
+	mux.HandleFunc("GET /api/v1/github/{username}/{repository}/pull/{number}", gs.IssueGetHandler)
+	mux.HandleFunc("GET /api/v1/github/{username}/{repository}/releases/latest", gs.ReleaseGetHandler)
+	mux.HandleFunc("GET /api/v1/github/{username}/{repository}/releases/tag/{tag...}", gs.ReleaseGetHandler)
+	mux.HandleFunc("GET /api/v1/github/{username}/{repository}/commit/{sha}", gs.CommitGetHandler)
+	mux.HandleFunc("GET /api/v1/github/gists/{id}", gs.GistGetHandler)
+
+	for target, want := range map[string]string{
+		"/api/v1/github/owner/repo/pull/7":                  `"pull_request":true`,
+		"/api/v1/github/owner/repo/issues/7":                `"title":"Fix it"`,
+		"/api/v1/github/owner/repo/releases/tag/release/v1": `"tag":"release/v1"`,
+		"/api/v1/github/owner/repo/releases/latest":         `"tag":"v2"`,
+		"/api/v1/github/owner/repo/commit/abc123":           `"message":"Initial commit"`,
+		"/api/v1/github/gists/aa5a315d":                     `"files":[{"filename":"a.go"`,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+		assert.Contains(t, rec.Body.String(), want, target)
+	}
+
+	for target, want := range map[string]int{
+		"/api/v1/github/owner/repo/issues/8":    http.StatusNotFound,
+		"/api/v1/github/owner/repo/issues/x":    http.StatusBadRequest,
+		"/api/v1/github/owner/repo/commit/main": http.StatusBadRequest,
+		"/api/v1/github/gists/not-a-gist":       http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, want, rec.Code, target)
+	}
+}
@@ -1,33 +1,43 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gitfeed/api"
 	"gitfeed/db"
+	"gitfeed/feedgen"
+	"gitfeed/github"
+	"gitfeed/jetstream"
+	"gitfeed/langdetect"
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type PostRequest struct {
 	Post []db.ATPost `json:"posts"`
 }
 
+// hydrateTimeout bounds how long a listing waits on GitHub for metadata
+// that isn't cached yet.
+const hydrateTimeout = 2 * time.Second
+
 type PostService struct {
 	PostRepository db.PostRepo
+	// GitHub, when set, lets listings embed repository metadata with hydrate=repo.
+	GitHub *github.Cache
 }
 
-func ExtractUri(p db.ATPost) string {
-	var uri string
-	for _, facet := range p.Commit.Record.Facets {
-		for _, feature := range facet.Features {
-			if feature.Type == "app.bsky.richtext.facet#link" {
-				uri = feature.URI
-			}
-		}
-	}
-	return uri
+// HydratedPost is a post with the metadata of the GitHub repository it links
+// to, when that could be looked up in time.
+type HydratedPost struct {
+	db.DBPost
+	Repo *github.Repo `json:",omitempty"`
 }
 
 func (ps *PostService) PostWriteHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,8 +61,9 @@ func (ps *PostService) PostWriteHandler(w http.ResponseWriter, r *http.Request)
 			langs.Valid = true
 			langs.V = p.Commit.Record.Langs[0]
 		}
-		uri := ExtractUri(p)
+		uri := jetstream.ExtractUri(p)
 		if uri != "" {
+			languages, detected := jetstream.Languages(p)
 			post := db.DBPost{
 				Did:        p.Did,
 				TimeUs:     p.TimeUs,
@@ -66,6 +77,13 @@ func (ps *PostService) PostWriteHandler(w http.ResponseWriter, r *http.Request)
 				Langs:      langs,
 				Text:       p.Commit.Record.Text,
 				URI:        uri,
+				ParentURI:  p.Commit.Record.Reply.Parent.URI,
+				ParentCid:  p.Commit.Record.Reply.Parent.Cid,
+				RootURI:    p.Commit.Record.Reply.Root.URI,
+				RootCid:    p.Commit.Record.Reply.Root.Cid,
+
+				Languages:         languages,
+				LanguagesDetected: detected,
 			}
 
 			err = ps.PostRepository.WritePost(post)
@@ -92,17 +110,124 @@ func (ps *PostService) DeletePosts(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// PostRef points at another post, with the post itself when it's stored here.
+type PostRef struct {
+	URI       string
+	Cid       string
+	Permalink string
+	Post      *db.DBPost `json:",omitempty"`
+}
+
+type PostReply struct {
+	Parent PostRef
+	Root   PostRef
+}
+
+// PostDetail is a stored post with its AT-URI and bsky.app permalink, the
+// repository it links to, and the posts it replies to.
+type PostDetail struct {
+	HydratedPost
+	ATURI      string
+	Permalink  string
+	Repository *db.Repository `json:",omitempty"`
+	Reply      *PostReply     `json:",omitempty"`
+}
+
+// PostGetHandler looks a post up by {did}/{rkey}, or by {uri}, its
+// percent-encoded AT-URI.
 func (ps *PostService) PostGetHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	post, err := ps.PostRepository.GetPost(id)
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	detail, err := ps.post(r)
 	if err != nil {
-		http.Error(w, "Error fetching post", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	log.Printf("Fetch post %v+\n %v+ ", id, post)
+	writeJSON(w, detail)
+}
 
-	w.WriteHeader(http.StatusOK)
+func (ps *PostService) PostGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	detail, err := ps.post(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	post := api.NewPost(detail.DBPost)
+	post.Repo = detail.Repo
+	if detail.Reply != nil {
+		post.Reply = &api.Reply{Parent: newPostRef(detail.Reply.Parent), Root: newPostRef(detail.Reply.Root)}
+	}
+	writeJSON(w, post)
+}
 
+func newPostRef(ref PostRef) api.PostRef {
+	out := api.PostRef{URI: ref.URI, Cid: ref.Cid, Permalink: ref.Permalink}
+	if ref.Post != nil {
+		post := api.NewPost(*ref.Post)
+		out.Post = &post
+	}
+	return out
+}
+
+func (ps *PostService) post(r *http.Request) (PostDetail, error) {
+	var detail PostDetail
+	did, rkey := r.PathValue("did"), r.PathValue("rkey")
+	if uri := r.PathValue("uri"); uri != "" {
+		var ok bool
+		if did, rkey, ok = feedgen.ParsePostURI(uri); !ok {
+			return detail, badRequest("uri must be at://{did}/app.bsky.feed.post/{rkey}")
+		}
+	}
+	if !strings.HasPrefix(did, "did:") {
+		return detail, badRequest("did must be a DID")
+	}
+
+	post, err := ps.PostRepository.GetPost(did, rkey)
+	if errors.Is(err, db.ErrNotFound) {
+		return detail, notFound("Post not found")
+	}
+	if err != nil {
+		return detail, failed(err, http.StatusInternalServerError, "Error fetching post")
+	}
+
+	detail = PostDetail{
+		HydratedPost: HydratedPost{DBPost: *post},
+		ATURI:        feedgen.PostURI(*post),
+		Permalink:    api.Permalink(post.Did, post.Rkey),
+	}
+	if repo, ok := db.ParseRepositoryURL(post.URI); ok {
+		detail.Repository = &repo
+		if ps.GitHub != nil {
+			detail.HydratedPost = ps.hydrate(r.Context(), []db.DBPost{*post})[0]
+		}
+	}
+	if post.ParentURI != "" {
+		detail.Reply = &PostReply{
+			Parent: PostRef{URI: post.ParentURI, Cid: post.ParentCid},
+			Root:   PostRef{URI: post.RootURI, Cid: post.RootCid},
+		}
+		for _, ref := range []*PostRef{&detail.Reply.Parent, &detail.Reply.Root} {
+			if err := ps.resolve(ref); err != nil {
+				return detail, failed(err, http.StatusInternalServerError, "Error fetching post")
+			}
+		}
+	}
+	return detail, nil
+}
+
+// resolve fills in ref's permalink, and its post when that's stored.
+func (ps *PostService) resolve(ref *PostRef) error {
+	did, rkey, ok := feedgen.ParsePostURI(ref.URI)
+	if !ok {
+		return nil
+	}
+	ref.Permalink = api.Permalink(did, rkey)
+	post, err := ps.PostRepository.GetPost(did, rkey)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	ref.Post = post
+	return err
 }
 
 func (ps *PostService) TimeStampGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -119,16 +244,45 @@ func (ps *PostService) TimeStampGetHandler(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(response)
 }
 
+// TimeStampGetHandlerV2 reports the newest post's time_us, which v1 rounds
+// to milliseconds.
+func (ps *PostService) TimeStampGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	ts, err := ps.PostRepository.GetTimeStamp()
+	if errors.Is(err, db.ErrNotFound) {
+		writeProblem(w, r, notFound("No posts stored yet"))
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, failed(err, http.StatusInternalServerError, "Error fetching timestamp"))
+		return
+	}
+	writeJSON(w, api.Timestamp{TimeUs: ts})
+}
+
 func (us *PostService) PostsGetHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
-	posts, err := us.PostRepository.GetAllPosts()
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hydrate, err := us.parseHydrate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	posts, err := us.PostRepository.GetPosts(filter)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error fetching posts", http.StatusBadRequest)
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(posts); err != nil {
+	var response any = posts
+	if hydrate == "repo" {
+		response = us.hydrate(r.Context(), posts)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding posts to JSON: %v", err)
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 		return
@@ -137,3 +291,104 @@ func (us *PostService) PostsGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	log.Printf("Fetched and returned %d posts\n", len(posts))
 }
+
+// PostsGetHandlerV2 pages through posts newest first, limit at a time. Pass
+// cursor from the previous page to continue.
+func (ps *PostService) PostsGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	query := r.URL.Query()
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		writeProblem(w, r, badRequest(err.Error()))
+		return
+	}
+	hydrate, err := ps.parseHydrate(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	limit, err := parseLimit(query.Get("limit"), defaultPostsLimit)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	var before db.PostCursor
+	if c := query.Get("cursor"); c != "" {
+		if before, err = db.ParsePostCursor(c); err != nil {
+			writeProblem(w, r, badRequest(err.Error()))
+			return
+		}
+	}
+
+	posts, err := ps.PostRepository.GetPostsBefore(before, filter, limit)
+	if err != nil {
+		writeProblem(w, r, failed(err, http.StatusInternalServerError, "Error fetching posts"))
+		return
+	}
+	page := api.Posts{Posts: make([]api.Post, len(posts))}
+	for i, p := range posts {
+		page.Posts[i] = api.NewPost(p)
+	}
+	if hydrate == "repo" {
+		for i, p := range ps.hydrate(r.Context(), posts) {
+			page.Posts[i].Repo = p.Repo
+		}
+	}
+	if len(posts) == limit {
+		page.Cursor = posts[len(posts)-1].Cursor().String()
+	}
+	writeJSON(w, page)
+}
+
+// parseHydrate checks hydrate names something listings can embed, and then
+// that it can be fetched: hydrate=repo needs GitHub configured.
+func (ps *PostService) parseHydrate(r *http.Request) (string, error) {
+	switch hydrate := r.URL.Query().Get("hydrate"); {
+	case hydrate == "":
+		return "", nil
+	case hydrate != "repo":
+		return "", badRequest("hydrate must be repo")
+	case ps.GitHub == nil:
+		return "", &requestError{http.StatusServiceUnavailable, "Repository metadata is unavailable, GitHub is not configured"}
+	default:
+		return hydrate, nil
+	}
+}
+
+func (us *PostService) hydrate(ctx context.Context, posts []db.DBPost) []HydratedPost {
+	var repos []db.Repository
+	for _, p := range posts {
+		if repo, ok := db.ParseRepositoryURL(p.URI); ok {
+			repos = append(repos, repo)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, hydrateTimeout)
+	defer cancel()
+	found := us.GitHub.GetRepos(ctx, repos)
+
+	hydrated := make([]HydratedPost, len(posts))
+	for i, p := range posts {
+		hydrated[i].DBPost = p
+		if repo, ok := db.ParseRepositoryURL(p.URI); ok {
+			if meta, ok := found[repo]; ok {
+				hydrated[i].Repo = &meta
+			}
+		}
+	}
+	return hydrated
+}
+
+// parsePostFilter reads the filters listings share from the query string.
+func parsePostFilter(r *http.Request) (db.PostFilter, error) {
+	var filter db.PostFilter
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if filter.Lang = langdetect.Normalize(lang); filter.Lang == "" {
+			return filter, fmt.Errorf("invalid language %q", lang)
+		}
+	}
+	// Repository paths are case-insensitive and stored lowercase.
+	filter.Forge = strings.ToLower(r.URL.Query().Get("forge"))
+	filter.Owner = strings.ToLower(r.URL.Query().Get("owner"))
+	filter.Name = strings.ToLower(r.URL.Query().Get("repo"))
+	return filter, nil
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gitfeed/api"
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"gitfeed/github"
+	"gitfeed/github/githubtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPostsGetHandler(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo}
+
+	rec := httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	require.NoError(t, repo.WritePost(dbtest.Post(2)))
+
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var posts []db.DBPost
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&posts))
+	require.Len(t, posts, 2)
+	assert.Equal(t, dbtest.Post(2).Rkey, posts[0].Rkey)
+
+	german := dbtest.Post(3)
+	german.Languages = []string{"de"}
+	require.NoError(t, repo.WritePost(german))
+
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts?lang=de-AT", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&posts))
+	require.Len(t, posts, 1)
+	assert.Equal(t, german.Rkey, posts[0].Rkey)
+
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts?lang=german", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPostsGetHandlerHydrate(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo1", map[string]any{"full_name": "owner/repo1", "stargazers_count": 7, "archived": true})
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo, GitHub: github.NewCache(github.NewClient(s.URL, ""), nil, 10)}
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	require.NoError(t, repo.WritePost(dbtest.Post(2)))
+
+	rec := httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts?hydrate=repo", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var posts []HydratedPost
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&posts))
+	require.Len(t, posts, 2)
+	assert.Nil(t, posts[0].Repo, "repositories GitHub doesn't know are left bare")
+	require.NotNil(t, posts[1].Repo)
+	assert.Equal(t, dbtest.Post(1).Rkey, posts[1].Rkey)
+	assert.Equal(t, github.Repo{FullName: "owner/repo1", Stars: 7, Archived: true}, *posts[1].Repo)
+
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts?hydrate=author", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Without GitHub a bad hydrate is still a 400, and hydrate=repo is a 503.
+	ps.GitHub = nil
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts?hydrate=author", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandler(rec, httptest.NewRequest("GET", "/api/v1/posts?hydrate=repo", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = httptest.NewRecorder()
+	ps.PostsGetHandlerV2(rec, httptest.NewRequest("GET", "/api/v2/posts?hydrate=repo", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+}
+
+func TestTimeStampGetHandler(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo}
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+
+	rec := httptest.NewRecorder()
+	ps.TimeStampGetHandler(rec, httptest.NewRequest("GET", "/api/v1/timestamp", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var got map[string]int64
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, dbtest.Post(1).TimeUs/1000, got["timestamp"])
+}
+
+func TestPostWriteHandler(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo}
+
+	body := `{"posts": [
+		{"did": "did:plc:a", "time_us": 1, "kind": "commit", "commit": {"rkey": "1", "record": {
+			"text": "https://github.com/owner/repo",
+			"langs": ["en", "de"],
+			"facets": [{"features": [{"$type": "app.bsky.richtext.facet#link", "uri": "https://github.com/owner/repo"}]}]}}},
+		{"did": "did:plc:b", "time_us": 2, "kind": "commit", "commit": {"rkey": "2", "record": {"text": "no links here"}}}
+	]}`
+
+	rec := httptest.NewRecorder()
+	ps.PostWriteHandler(rec, httptest.NewRequest("POST", "/api/v1/posts", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	posts, err := repo.GetAllPosts()
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "did:plc:a", posts[0].Did)
+	assert.Equal(t, "https://github.com/owner/repo", posts[0].URI)
+	assert.Equal(t, "en", posts[0].Langs.V)
+	assert.Equal(t, []string{"en", "de"}, posts[0].Languages)
+	assert.False(t, posts[0].LanguagesDetected)
+}
+
+func TestPostGetHandler(t *testing.T) {
+	s := githubtest.NewServer(t)
+	s.SetRepo("owner", "repo2", map[string]any{"full_name": "owner/repo2", "stargazers_count": 3})
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo, GitHub: github.NewCache(github.NewClient(s.URL, ""), nil, 10)}
+	parent, reply := dbtest.Post(1), dbtest.Post(2)
+	reply.ParentURI, reply.ParentCid = "at://did:plc:author1/app.bsky.feed.post/rkey1", "cid1"
+	reply.RootURI, reply.RootCid = "at://did:plc:elsewhere/app.bsky.feed.post/root", "cid0"
+	require.NoError(t, repo.WritePost(parent))
+	require.NoError(t, repo.WritePost(reply))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/post/{did}/{rkey}", ps.PostGetHandler)
+	mux.HandleFunc("GET /api/v1/post/{uri}", ps.PostGetHandler)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	for _, target := range []string{
+		"/api/v1/post/did:plc:author2/rkey2",
+		"/api/v1/post/" + url.PathEscape("at://did:plc:author2/app.bsky.feed.post/rkey2"),
+	} {
+		rec := get(target)
+		require.Equal(t, http.StatusOK, rec.Code, target)
+		var got PostDetail
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+		assert.Equal(t, reply.Text, got.Text)
+		assert.Equal(t, "at://did:plc:author2/app.bsky.feed.post/rkey2", got.ATURI)
+		assert.Equal(t, "https://bsky.app/profile/did:plc:author2/post/rkey2", got.Permalink)
+		assert.Equal(t, &db.Repository{Forge: "github", Owner: "owner", Name: "repo2"}, got.Repository)
+		require.NotNil(t, got.Repo)
+		assert.Equal(t, 3, got.Repo.Stars)
+		require.NotNil(t, got.Reply)
+		require.NotNil(t, got.Reply.Parent.Post, "the stored parent is included")
+		assert.Equal(t, parent.Text, got.Reply.Parent.Post.Text)
+		assert.Nil(t, got.Reply.Root.Post)
+		assert.Equal(t, "https://bsky.app/profile/did:plc:elsewhere/post/root", got.Reply.Root.Permalink)
+	}
+
+	rec := get("/api/v1/post/did:plc:author1/rkey1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"Reply"`, "posts that aren't replies have no reply context")
+
+	for target, want := range map[string]int{
+		"/api/v1/post/did:plc:author1/rkey2":                                     http.StatusNotFound,
+		"/api/v1/post/alice.bsky.social/rkey1":                                   http.StatusBadRequest,
+		"/api/v1/post/did:plc:author1":                                           http.StatusBadRequest,
+		"/api/v1/post/" + url.PathEscape("at://did:plc:a/app.bsky.feed.like/rk"): http.StatusBadRequest,
+	} {
+		assert.Equal(t, want, get(target).Code, target)
+	}
+}
+
+// failingPosts fails every read, like a database that has gone away.
+type failingPosts struct {
+	db.PostRepo
+}
+
+func (failingPosts) GetPostsBefore(before db.PostCursor, filter db.PostFilter, limit int) ([]db.DBPost, error) {
+	return nil, errors.New("disk I/O error")
+}
+
+func TestPostsGetHandlerV2(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo}
+	get := func(ps *PostService, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ps.PostsGetHandlerV2(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	rec := get(ps, "/api/v2/posts")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"posts": []}`, rec.Body.String(), "an empty page isn't an error")
+
+	reply := dbtest.Post(3)
+	reply.ParentURI, reply.ParentCid = "at://did:plc:author1/app.bsky.feed.post/rkey1", "cid1"
+	reply.RootURI, reply.RootCid = reply.ParentURI, reply.ParentCid
+	for _, p := range []db.DBPost{dbtest.Post(1), dbtest.Post(2), reply} {
+		require.NoError(t, repo.WritePost(p))
+	}
+
+	rec = get(ps, "/api/v2/posts?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page struct {
+		Posts  []map[string]any `json:"posts"`
+		Cursor string           `json:"cursor"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	require.Len(t, page.Posts, 2)
+	got := page.Posts[0]
+	assert.Equal(t, "at://did:plc:author3/app.bsky.feed.post/rkey3", got["uri"])
+	assert.Equal(t, float64(reply.TimeUs), got["time_us"])
+	assert.Equal(t, []any{"en"}, got["langs"])
+	assert.Equal(t, map[string]any{"url": reply.URI, "forge": "github", "owner": "owner", "name": "repo3"}, got["link"])
+	assert.Equal(t, reply.ParentURI, got["reply"].(map[string]any)["parent"].(map[string]any)["uri"])
+	assert.NotContains(t, got, "Did", "v2 doesn't leak db field names")
+	assert.NotContains(t, got, "Langs")
+	assert.NotContains(t, page.Posts[1], "reply")
+	require.Equal(t, strconv.FormatInt(dbtest.Post(2).TimeUs, 10)+"_2", page.Cursor)
+
+	rec = get(ps, "/api/v2/posts?limit=2&cursor="+page.Cursor)
+	require.Equal(t, http.StatusOK, rec.Code)
+	page.Cursor = ""
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	require.Len(t, page.Posts, 1)
+	assert.Equal(t, "rkey1", page.Posts[0]["rkey"])
+	assert.Empty(t, page.Cursor, "no cursor on the last page")
+
+	rec = get(ps, "/api/v2/posts?lang=german")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type": "about:blank", "title": "Bad Request", "status": 400,
+		"detail": "invalid language \"german\"", "instance": "/api/v2/posts"}`, rec.Body.String())
+
+	rec = get(&PostService{PostRepository: failingPosts{}}, "/api/v2/posts")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "database failures aren't the client's fault")
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), "disk", "internal errors stay in the log")
+}
+
+func TestPostGetHandlerV2(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	ps := &PostService{PostRepository: repo}
+	reply := dbtest.Post(2)
+	reply.ParentURI, reply.ParentCid = "at://did:plc:author1/app.bsky.feed.post/rkey1", "cid1"
+	reply.RootURI, reply.RootCid = reply.ParentURI, reply.ParentCid
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	require.NoError(t, repo.WritePost(reply))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/posts/{did}/{rkey}", ps.PostGetHandlerV2)
+	mux.HandleFunc("GET /api/v2/posts/{uri}", ps.PostGetHandlerV2)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	rec := get("/api/v2/posts/" + url.PathEscape("at://did:plc:author2/app.bsky.feed.post/rkey2"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got api.Post
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, "https://bsky.app/profile/did:plc:author2/post/rkey2", got.Permalink)
+	assert.Equal(t, reply.CreatedAt, got.CreatedAt)
+	require.NotNil(t, got.Reply)
+	require.NotNil(t, got.Reply.Parent.Post, "the stored parent is included")
+	assert.Equal(t, dbtest.Post(1).Text, got.Reply.Parent.Post.Text)
+
+	rec = get("/api/v2/posts/did:plc:author1/rkey2")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var problem api.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, api.NewProblem(http.StatusNotFound, "Post not found", "/api/v2/posts/did:plc:author1/rkey2"), problem)
+}
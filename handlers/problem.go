@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gitfeed/api"
+	"log"
+	"net/http"
+)
+
+// requestError is a failure reported to the client with its status. Other
+// errors are logged and reported as a 500 without their details.
+type requestError struct {
+	status int
+	detail string
+}
+
+func (e *requestError) Error() string {
+	return e.detail
+}
+
+func badRequest(detail string) error {
+	return &requestError{http.StatusBadRequest, detail}
+}
+
+func notFound(detail string) error {
+	return &requestError{http.StatusNotFound, detail}
+}
+
+// failed logs err and reports detail in its place.
+func failed(err error, status int, detail string) error {
+	log.Println(err)
+	return &requestError{status, detail}
+}
+
+func errorStatus(err error) (int, string) {
+	var re *requestError
+	if errors.As(err, &re) {
+		return re.status, re.detail
+	}
+	log.Println(err)
+	return http.StatusInternalServerError, "Internal server error"
+}
+
+// errorWriter reports a handler's error in the form its API version uses.
+type errorWriter func(w http.ResponseWriter, r *http.Request, err error)
+
+// writeError answers v1 requests with a plain-text error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, detail := errorStatus(err)
+	http.Error(w, detail, status)
+}
+
+// writeProblem answers v2 requests with an RFC 7807 problem+json error.
+func writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	status, detail := errorStatus(err)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(api.NewProblem(status, detail, r.URL.Path)); err != nil {
+		log.Printf("Error encoding problem to JSON: %v", err)
+	}
+}
+
+// NotFoundV2 answers unknown /api/v2 paths with a problem rather than the
+// static file server's page.
+func NotFoundV2(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, notFound("No such endpoint"))
+}
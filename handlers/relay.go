@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"gitfeed/db"
+	"gitfeed/stream"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	relayWriteWait  = 10 * time.Second
+	relayPongWait   = 60 * time.Second
+	relayPingPeriod = (relayPongWait * 9) / 10
+)
+
+// Consumers are other services rather than pages, so any origin may connect.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// SubscribeHandler relays stored posts and deletes over a websocket as
+// stream.Message JSON, one per frame. It takes the same filters as
+// /api/v1/posts, and cursor, a post's cursor to resume after.
+func (ss *StreamService) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var cursor db.PostCursor
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		if cursor, err = parseResumeCursor(c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	client, err := ss.Hub.Subscribe(filter)
+	if errors.Is(err, stream.ErrTooManyClients) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer ss.Hub.Unsubscribe(client)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading subscriber: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Consumers only send control frames; reading keeps pongs and closes flowing.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(relayPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(relayPongWait))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(e stream.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(relayWriteWait))
+		return conn.WriteJSON(stream.NewMessage(e))
+	}
+	last, err := ss.replay(cursor, filter, send)
+	if err != nil {
+		return
+	}
+
+	ping := time.NewTicker(relayPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-client.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind"),
+					time.Now().Add(relayWriteWait))
+				return
+			}
+			if replayed(e, last) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return
+			}
+			if !e.ID.IsZero() {
+				last = e.ID
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(relayWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
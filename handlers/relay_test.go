@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"gitfeed/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSubscribeHandler(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	other := dbtest.Post(2)
+	other.URI = "https://github.com/someone/else"
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	require.NoError(t, repo.WritePost(other))
+	require.NoError(t, repo.WritePost(dbtest.Post(3)))
+	hub, err := stream.NewHub(repo)
+	require.NoError(t, err)
+	ss := &StreamService{Hub: hub, Repository: repo}
+	server := httptest.NewServer(http.HandlerFunc(ss.SubscribeHandler))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + fmt.Sprintf("?owner=Owner&cursor=%d_1", dbtest.Post(1).TimeUs)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var msg stream.Message
+	require.NoError(t, conn.ReadJSON(&msg), "posts after the cursor are replayed")
+	assert.Equal(t, "post", msg.Kind)
+	assert.Equal(t, dbtest.Post(3).TimeUs, msg.TimeUs)
+	assert.Equal(t, fmt.Sprintf("%d_3", dbtest.Post(3).TimeUs), msg.Cursor)
+	assert.Equal(t, &stream.MessageLink{URL: dbtest.Post(3).URI, Forge: "github", Owner: "owner", Name: "repo3"}, msg.Link)
+	assert.Equal(t, fmt.Sprintf("https://bsky.app/profile/%s/post/%s", dbtest.Post(3).Did, dbtest.Post(3).Rkey), msg.Post.URL)
+
+	require.NoError(t, repo.WritePost(dbtest.Post(4)))
+	require.NoError(t, hub.Publish([]db.Change{
+		{Op: db.PostWritten, TimeUs: dbtest.Post(4).TimeUs},
+		{Op: db.PostDeleted, Did: dbtest.Post(1).Did, Rkey: dbtest.Post(1).Rkey},
+	}))
+	msg = stream.Message{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, dbtest.Post(4).Rkey, msg.Rkey)
+	msg = stream.Message{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, stream.Message{Kind: "delete", Did: dbtest.Post(1).Did, Rkey: dbtest.Post(1).Rkey}, msg)
+}
+
+func TestSubscribeHandlerRejectsBadCursor(t *testing.T) {
+	hub, err := stream.NewHub(db.NewMemoryPostRepository())
+	require.NoError(t, err)
+	ss := &StreamService{Hub: hub, Repository: db.NewMemoryPostRepository()}
+
+	rec := httptest.NewRecorder()
+	ss.SubscribeHandler(rec, httptest.NewRequest("GET", "/api/v1/subscribe?cursor=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"gitfeed/api"
+	"gitfeed/db"
+	"gitfeed/export"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRepositoriesLimit = 20
+	maxRepositoriesLimit     = 100
+	defaultPostsLimit        = 25
+	maxSharers               = 50
+	// mentionsWindow is how far back detail pages chart mentions.
+	mentionsWindow = 90 * 24 * time.Hour
+)
+
+type RepositoryService struct {
+	Repository db.MetadataRepo
+	Mentions   db.RepositoryRepo
+}
+
+// RepositoriesGetHandler lists repositories with stored GitHub metadata,
+// filtered by language and topic and sorted by stars by default.
+func (rs *RepositoryService) RepositoriesGetHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	repos, err := rs.repositories(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, nonNil(repos))
+}
+
+func (rs *RepositoryService) RepositoriesGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	repos, err := rs.repositories(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	writeJSON(w, api.Repositories{Repositories: api.NewRepositories(repos)})
+}
+
+func (rs *RepositoryService) repositories(r *http.Request) ([]db.RepositoryMetadata, error) {
+	query := r.URL.Query()
+	q := db.RepositoryQuery{
+		Language: query.Get("language"),
+		Topic:    query.Get("topic"),
+		Sort:     query.Get("sort"),
+	}
+	if q.Sort == "" {
+		q.Sort = "stars"
+	}
+	var err error
+	if q.Limit, err = parseLimit(query.Get("limit"), defaultRepositoriesLimit); err != nil {
+		return nil, err
+	}
+
+	repos, err := rs.Repository.GetRepositories(q)
+	if errors.Is(err, db.ErrBadSort) {
+		return nil, badRequest(err.Error())
+	}
+	if err != nil {
+		return nil, failed(err, http.StatusInternalServerError, "Error fetching repositories")
+	}
+	return repos, nil
+}
+
+type HistoryResponse struct {
+	Repository string             `json:"repository"`
+	Since      int64              `json:"since"`
+	Until      int64              `json:"until"`
+	Buckets    []db.HistoryBucket `json:"buckets"`
+}
+
+// RepositoryHistoryGetHandler charts a GitHub repository's daily mentions
+// against its star and fork counts, over the last 90 days by default.
+func (rs *RepositoryService) RepositoryHistoryGetHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	history, err := rs.history(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, history)
+}
+
+func (rs *RepositoryService) RepositoryHistoryGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	history, err := rs.history(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	writeJSON(w, api.History{
+		Repository: history.Repository,
+		Since:      api.Time(history.Since),
+		Until:      api.Time(history.Until),
+		Buckets:    api.NewHistoryBuckets(history.Buckets),
+	})
+}
+
+// history takes the forge in the path like the other repository routes,
+// though only GitHub repositories have star history.
+func (rs *RepositoryService) history(r *http.Request) (HistoryResponse, error) {
+	if r.PathValue("forge") != "github" {
+		return HistoryResponse{}, notFound("Star history is only tracked for GitHub repositories")
+	}
+	owner, name := r.PathValue("owner"), r.PathValue("repo")
+	since, until, err := parseRange(r.URL.Query(), mentionsWindow)
+	if err != nil {
+		return HistoryResponse{}, err
+	}
+	if until.Sub(since)/db.Day.Duration() > maxBuckets {
+		return HistoryResponse{}, badRequest("range is too long")
+	}
+
+	response := HistoryResponse{
+		Repository: fmt.Sprintf("%s/%s", owner, name),
+		Since:      since.UnixMicro(),
+		Until:      until.UnixMicro(),
+	}
+	response.Buckets, err = rs.Repository.GetRepositoryHistory(owner, name, response.Since, response.Until)
+	if errors.Is(err, db.ErrNotFound) {
+		return response, notFound("Repository not found")
+	}
+	if err != nil {
+		return response, failed(err, http.StatusInternalServerError, "Error fetching repository history")
+	}
+	return response, nil
+}
+
+// PermalinkedPost is a stored post with its link on bsky.app.
+type PermalinkedPost struct {
+	db.DBPost
+	Permalink string
+}
+
+type RepositoryDetail struct {
+	Repository db.RepositoryMetadata `json:"repository"`
+	Mentions   []db.RepositoryBucket `json:"mentions"`
+	Sharers    []db.Sharer           `json:"sharers"`
+	Posts      []PermalinkedPost     `json:"posts"`
+	// Cursor fetches the next page of posts, and is empty on the last page.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// RepositoryGetHandler describes one repository: its metadata, daily mentions
+// over the last 90 days, who shared it, and its posts newest first, a page at
+// a time. Pass cursor from the previous page to continue.
+func (rs *RepositoryService) RepositoryGetHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	detail, err := rs.repository(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (rs *RepositoryService) RepositoryGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	detail, err := rs.repository(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	response := api.RepositoryDetail{
+		Repository: api.NewRepository(detail.Repository),
+		Mentions:   api.NewMentionBuckets(detail.Mentions),
+		Sharers:    api.NewSharers(detail.Sharers),
+		Posts:      make([]api.Post, len(detail.Posts)),
+		Cursor:     detail.Cursor,
+	}
+	for i, p := range detail.Posts {
+		response.Posts[i] = api.NewPost(p.DBPost)
+	}
+	writeJSON(w, response)
+}
+
+func (rs *RepositoryService) repository(r *http.Request) (RepositoryDetail, error) {
+	forge, owner, name := r.PathValue("forge"), r.PathValue("owner"), r.PathValue("repo")
+	query := r.URL.Query()
+	var detail RepositoryDetail
+	limit, err := parseLimit(query.Get("limit"), defaultPostsLimit)
+	if err != nil {
+		return detail, err
+	}
+	var before db.PostCursor
+	if c := query.Get("cursor"); c != "" {
+		if before, err = db.ParsePostCursor(c); err != nil {
+			return detail, badRequest(err.Error())
+		}
+	}
+
+	detail.Repository, err = rs.Mentions.GetRepository(forge, owner, name)
+	if errors.Is(err, db.ErrNotFound) {
+		return detail, notFound("Repository not found")
+	}
+	if err == nil {
+		until := time.Now().UTC()
+		detail.Mentions, err = rs.Mentions.GetRepositoryTimeseries(db.Day, forge, owner, name,
+			until.Add(-mentionsWindow).UnixMicro(), until.UnixMicro())
+	}
+	if err == nil {
+		detail.Sharers, err = rs.Mentions.GetRepositorySharers(forge, owner, name, maxSharers)
+	}
+	var posts []db.DBPost
+	if err == nil {
+		posts, err = rs.Mentions.GetRepositoryPosts(forge, owner, name, before, limit)
+	}
+	if err != nil {
+		return detail, failed(err, http.StatusInternalServerError, "Error fetching repository")
+	}
+
+	detail.Sharers = nonNil(detail.Sharers)
+	detail.Posts = make([]PermalinkedPost, len(posts))
+	for i, p := range posts {
+		detail.Posts[i] = PermalinkedPost{p, api.Permalink(p.Did, p.Rkey)}
+	}
+	if len(posts) == limit {
+		detail.Cursor = posts[len(posts)-1].Cursor().String()
+	}
+	return detail, nil
+}
+
+type OwnerDetail struct {
+	Owner        db.Owner                `json:"owner"`
+	Repositories []db.RepositoryMetadata `json:"repositories"`
+	Mentions     []db.RepositoryBucket   `json:"mentions"`
+}
+
+// OwnerGetHandler totals an account's or organization's repositories on a
+// forge, GitHub unless forge is given, and lists them most mentioned first.
+func (rs *RepositoryService) OwnerGetHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	detail, err := rs.owner(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (rs *RepositoryService) OwnerGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	detail, err := rs.owner(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	writeJSON(w, api.OwnerDetail{
+		Owner:        api.NewOwner(detail.Owner),
+		Repositories: api.NewRepositories(detail.Repositories),
+		Mentions:     api.NewMentionBuckets(detail.Mentions),
+	})
+}
+
+// owner takes the forge from the path in v2, and from the query in v1.
+func (rs *RepositoryService) owner(r *http.Request) (OwnerDetail, error) {
+	owner := r.PathValue("owner")
+	query := r.URL.Query()
+	forge := r.PathValue("forge")
+	if forge == "" {
+		forge = query.Get("forge")
+	}
+	if forge == "" {
+		forge = "github"
+	}
+	var detail OwnerDetail
+	limit, err := parseLimit(query.Get("limit"), defaultRepositoriesLimit)
+	if err != nil {
+		return detail, err
+	}
+
+	detail.Owner, err = rs.Mentions.GetOwner(forge, owner)
+	if errors.Is(err, db.ErrNotFound) {
+		return detail, notFound("Owner not found")
+	}
+	if err == nil {
+		detail.Repositories, err = rs.Mentions.GetOwnerRepositories(forge, owner, limit)
+	}
+	if err == nil {
+		until := time.Now().UTC()
+		detail.Mentions, err = rs.Mentions.GetOwnerTimeseries(db.Day, forge, owner,
+			until.Add(-mentionsWindow).UnixMicro(), until.UnixMicro())
+	}
+	if err != nil {
+		return detail, failed(err, http.StatusInternalServerError, "Error fetching owner")
+	}
+	detail.Repositories = nonNil(detail.Repositories)
+	return detail, nil
+}
+
+// parseLimit reads a limit of 1 to 100.
+func parseLimit(l string, def int) (int, error) {
+	if l == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit < 1 || limit > maxRepositoriesLimit {
+		return 0, badRequest("limit must be between 1 and 100")
+	}
+	return limit, nil
+}
+
+// parseRange reads since and until, defaulting to the span up to now.
+func parseRange(query url.Values, span time.Duration) (since, until time.Time, err error) {
+	until = time.Now().UTC()
+	since = until.Add(-span)
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := export.ParseTime(v)
+			if err != nil {
+				return since, until, badRequest(err.Error())
+			}
+			*t = parsed
+		}
+	}
+	if !since.Before(until) {
+		return since, until, badRequest("since must be before until")
+	}
+	return since, until, nil
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"gitfeed/api"
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type metadataRepo struct {
+	queries []db.RepositoryQuery
+}
+
+func (m *metadataRepo) GetRepositoriesToEnrich(seenSince, fetchedBefore int64, limit int) ([]db.RepositoryMetadata, error) {
+	return nil, nil
+}
+
+func (m *metadataRepo) PutRepositoryMetadata(db.RepositoryMetadata) error { return nil }
+
+func (m *metadataRepo) GetRepositories(q db.RepositoryQuery) ([]db.RepositoryMetadata, error) {
+	m.queries = append(m.queries, q)
+	if q.Sort == "name" {
+		return nil, db.ErrBadSort
+	}
+	return []db.RepositoryMetadata{{Repository: db.Repository{Forge: "github", Owner: "owner", Name: "repo"}, Stars: 3}}, nil
+}
+
+func (m *metadataRepo) GetRepositoryHistory(owner, name string, since, until int64) ([]db.HistoryBucket, error) {
+	if name != "repo" {
+		return nil, db.ErrNotFound
+	}
+	stars := int64(7)
+	return []db.HistoryBucket{{Start: db.Day.Truncate(since), Mentions: 2, Stars: &stars, Forks: &stars}, {Start: db.Day.Truncate(since) + db.Day.Duration().Microseconds()}}, nil
+}
+
+func TestRepositoriesGetHandler(t *testing.T) {
+	repo := &metadataRepo{}
+	rs := &RepositoryService{Repository: repo}
+
+	rec := httptest.NewRecorder()
+	rs.RepositoriesGetHandler(rec, httptest.NewRequest("GET", "/api/v1/repos?language=go&topic=cli&limit=5", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got []map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	require.Len(t, got, 1)
+	assert.Equal(t, "repo", got[0]["name"])
+	assert.Equal(t, float64(3), got[0]["stars"])
+	assert.Equal(t, db.RepositoryQuery{Language: "go", Topic: "cli", Sort: "stars", Limit: 5}, repo.queries[0])
+
+	for _, target := range []string{"/api/v1/repos?sort=name", "/api/v1/repos?limit=0"} {
+		rec := httptest.NewRecorder()
+		rs.RepositoriesGetHandler(rec, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestRepositoryHistoryGetHandler(t *testing.T) {
+	rs := &RepositoryService{Repository: &metadataRepo{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/{forge}/{owner}/{repo}/history", rs.RepositoryHistoryGetHandler)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/repos/github/owner/repo/history?since=2024-01-01&until=2024-01-03", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got struct {
+		Repository string           `json:"repository"`
+		Buckets    []map[string]any `json:"buckets"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, "owner/repo", got.Repository)
+	require.Len(t, got.Buckets, 2)
+	assert.Equal(t, float64(7), got.Buckets[0]["stars"])
+	assert.Nil(t, got.Buckets[1]["stars"], "days without a snapshot are null")
+
+	for target, want := range map[string]int{
+		"/api/v1/repos/github/owner/missing/history":                                http.StatusNotFound,
+		"/api/v1/repos/gitlab/owner/repo/history":                                   http.StatusNotFound,
+		"/api/v1/repos/github/owner/repo/history?since=yesterday":                   http.StatusBadRequest,
+		"/api/v1/repos/github/owner/repo/history?since=2024-01-03&until=2024-01-01": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, want, rec.Code, target)
+	}
+}
+
+// mentionsRepo serves owner/repo with three posts; methods it doesn't
+// override panic through the nil embedded interface.
+type mentionsRepo struct {
+	db.RepositoryRepo
+	befores []db.PostCursor
+}
+
+func (m *mentionsRepo) GetRepository(forge, owner, name string) (db.RepositoryMetadata, error) {
+	if name != "repo" {
+		return db.RepositoryMetadata{}, db.ErrNotFound
+	}
+	return db.RepositoryMetadata{Repository: db.Repository{Forge: forge, Owner: owner, Name: name, MentionCount: 3}, Stars: 5}, nil
+}
+
+func (m *mentionsRepo) GetRepositoryTimeseries(g db.Granularity, forge, owner, name string, since, until int64) ([]db.RepositoryBucket, error) {
+	return []db.RepositoryBucket{{Start: g.Truncate(until), Mentions: 3}}, nil
+}
+
+func (m *mentionsRepo) GetRepositorySharers(forge, owner, name string, limit int) ([]db.Sharer, error) {
+	return nil, nil
+}
+
+func (m *mentionsRepo) GetRepositoryPosts(forge, owner, name string, before db.PostCursor, limit int) ([]db.DBPost, error) {
+	m.befores = append(m.befores, before)
+	var posts []db.DBPost
+	for i := 3; i > 0 && len(posts) < limit; i-- {
+		p := dbtest.Post(i)
+		p.ID = int64(i)
+		if before.Before(p) {
+			posts = append(posts, p)
+		}
+	}
+	return posts, nil
+}
+
+func (m *mentionsRepo) GetOwner(forge, owner string) (db.Owner, error) {
+	if owner != "owner" {
+		return db.Owner{}, db.ErrNotFound
+	}
+	return db.Owner{Forge: forge, Owner: owner, Repositories: 1}, nil
+}
+
+func (m *mentionsRepo) GetOwnerRepositories(forge, owner string, limit int) ([]db.RepositoryMetadata, error) {
+	r, err := m.GetRepository(forge, owner, "repo")
+	return []db.RepositoryMetadata{r}, err
+}
+
+func (m *mentionsRepo) GetOwnerTimeseries(g db.Granularity, forge, owner string, since, until int64) ([]db.RepositoryBucket, error) {
+	return nil, nil
+}
+
+func TestRepositoryGetHandler(t *testing.T) {
+	repo := &mentionsRepo{}
+	rs := &RepositoryService{Repository: &metadataRepo{}, Mentions: repo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/{forge}/{owner}/{repo}/history", rs.RepositoryHistoryGetHandler)
+	mux.HandleFunc("GET /api/v1/repos/{forge}/{owner}/{repo}", rs.RepositoryGetHandler)
+	mux.HandleFunc("GET /api/v1/owners/{owner}", rs.OwnerGetHandler)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/repos/github/owner/repo?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var detail RepositoryDetail
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&detail))
+	assert.Equal(t, int64(5), detail.Repository.Stars)
+	assert.Equal(t, int64(3), detail.Mentions[0].Mentions)
+	assert.NotNil(t, detail.Sharers)
+	require.Len(t, detail.Posts, 2)
+	p := dbtest.Post(3)
+	assert.Equal(t, "https://bsky.app/profile/"+p.Did+"/post/"+p.Rkey, detail.Posts[0].Permalink)
+	require.NotEmpty(t, detail.Cursor)
+
+	rec = get("/api/v1/repos/github/owner/repo?limit=2&cursor=" + detail.Cursor)
+	require.Equal(t, http.StatusOK, rec.Code)
+	detail = RepositoryDetail{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&detail))
+	require.Len(t, detail.Posts, 1)
+	assert.Equal(t, dbtest.Post(1).Rkey, detail.Posts[0].Rkey)
+	assert.Empty(t, detail.Cursor, "no cursor on the last page")
+
+	rec = get("/api/v1/owners/owner")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var owner OwnerDetail
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&owner))
+	assert.Equal(t, int64(1), owner.Owner.Repositories)
+	require.Len(t, owner.Repositories, 1)
+	assert.Equal(t, "github", owner.Repositories[0].Forge, "forge defaults to github")
+
+	for target, want := range map[string]int{
+		"/api/v1/repos/github/owner/missing":         http.StatusNotFound,
+		"/api/v1/repos/github/owner/repo?cursor=abc": http.StatusBadRequest,
+		"/api/v1/repos/github/owner/repo?limit=101":  http.StatusBadRequest,
+		"/api/v1/owners/nobody":                      http.StatusNotFound,
+	} {
+		assert.Equal(t, want, get(target).Code, target)
+	}
+}
+
+func TestRepositoryGetHandlerV2(t *testing.T) {
+	rs := &RepositoryService{Repository: &metadataRepo{}, Mentions: &mentionsRepo{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/repos", rs.RepositoriesGetHandlerV2)
+	mux.HandleFunc("GET /api/v2/repos/{forge}/{owner}/{repo}", rs.RepositoryGetHandlerV2)
+	mux.HandleFunc("GET /api/v2/repos/{forge}/{owner}/{repo}/history", rs.RepositoryHistoryGetHandlerV2)
+	mux.HandleFunc("GET /api/v2/owners/{forge}/{owner}", rs.OwnerGetHandlerV2)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	rec := get("/api/v2/repos/github/owner/repo?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var detail api.RepositoryDetail
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&detail))
+	assert.Equal(t, "https://github.com/owner/repo", detail.Repository.URL)
+	assert.Equal(t, int64(3), detail.Repository.Mentions)
+	assert.Nil(t, detail.Repository.Metadata, "metadata waits for a fetch")
+	assert.Equal(t, []api.Sharer{}, detail.Sharers)
+	require.Len(t, detail.Posts, 2)
+	assert.Equal(t, "rkey3", detail.Posts[0].Rkey)
+	assert.NotEmpty(t, detail.Cursor)
+
+	rec = get("/api/v2/repos/github/owner/repo/history?since=2024-01-01&until=2024-01-03")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var history map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	assert.Equal(t, "2024-01-01T00:00:00Z", history["since"])
+	assert.Equal(t, map[string]any{"start": "2024-01-01T00:00:00Z", "mentions": float64(2), "stars": float64(7), "forks": float64(7)},
+		history["buckets"].([]any)[0])
+
+	rec = get("/api/v2/owners/github/owner")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var owner api.OwnerDetail
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&owner))
+	assert.Equal(t, int64(1), owner.Owner.Repositories)
+	assert.Equal(t, []api.MentionBucket{}, owner.Mentions)
+
+	for target, want := range map[string]int{
+		"/api/v2/repos?sort=name":                    http.StatusBadRequest,
+		"/api/v2/repos/github/owner/missing":         http.StatusNotFound,
+		"/api/v2/repos/github/owner/repo?cursor=abc": http.StatusBadRequest,
+		"/api/v2/repos/gitlab/owner/repo/history":    http.StatusNotFound,
+		"/api/v2/repos/github/owner/missing/history": http.StatusNotFound,
+		"/api/v2/owners/github/nobody":               http.StatusNotFound,
+		"/api/v2/owners/github/owner?limit=1000":     http.StatusBadRequest,
+	} {
+		rec := get(target)
+		assert.Equal(t, want, rec.Code, target)
+		assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"), target)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"gitfeed/api"
+	"gitfeed/db"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxBuckets caps a series at roughly three months of hours.
+const maxBuckets = 2500
+
+type StatsService struct {
+	Repository db.StatsRepo
+}
+
+type TimeseriesResponse struct {
+	Granularity db.Granularity `json:"granularity"`
+	Since       int64          `json:"since"`
+	Until       int64          `json:"until"`
+	// Repository is set, and Mentions returned instead of Buckets, when the
+	// series is for one repository.
+	Repository string                `json:"repository,omitempty"`
+	Buckets    []db.Bucket           `json:"buckets,omitempty"`
+	Mentions   []db.RepositoryBucket `json:"mentions,omitempty"`
+}
+
+// TimeseriesGetHandler charts matched posts per hour or day. Pass
+// repo=forge/owner/name for one repository's mentions instead.
+func (ss *StatsService) TimeseriesGetHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := ss.timeseries(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, response)
+}
+
+func (ss *StatsService) TimeseriesGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	response, err := ss.timeseries(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	series := api.Timeseries{
+		Granularity: string(response.Granularity),
+		Since:       api.Time(response.Since),
+		Until:       api.Time(response.Until),
+		Repository:  response.Repository,
+	}
+	if response.Repository != "" {
+		series.Mentions = api.NewMentionBuckets(response.Mentions)
+	} else {
+		series.Buckets = api.NewActivityBuckets(response.Buckets)
+	}
+	writeJSON(w, series)
+}
+
+func (ss *StatsService) timeseries(r *http.Request) (TimeseriesResponse, error) {
+	query := r.URL.Query()
+	var response TimeseriesResponse
+
+	granularity := db.Day
+	if g := query.Get("granularity"); g != "" {
+		var err error
+		if granularity, err = db.ParseGranularity(g); err != nil {
+			return response, badRequest(err.Error())
+		}
+	}
+
+	span := 90 * 24 * time.Hour
+	if granularity == db.Hour {
+		span = 48 * time.Hour
+	}
+	since, until, err := parseRange(query, span)
+	if err != nil {
+		return response, err
+	}
+	if until.Sub(since)/granularity.Duration() > maxBuckets {
+		return response, badRequest("range is too long for this granularity")
+	}
+
+	response = TimeseriesResponse{
+		Granularity: granularity,
+		Since:       since.UnixMicro(),
+		Until:       until.UnixMicro(),
+	}
+	if repo := query.Get("repo"); repo != "" {
+		parts := strings.Split(repo, "/")
+		if len(parts) != 3 {
+			return response, badRequest("repo must be forge/owner/name")
+		}
+		response.Repository = repo
+		response.Mentions, err = ss.Repository.GetRepositoryTimeseries(granularity, parts[0], parts[1], parts[2],
+			response.Since, response.Until)
+	} else {
+		response.Buckets, err = ss.Repository.GetTimeseries(granularity, response.Since, response.Until)
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		return response, notFound("Repository not found")
+	}
+	if err != nil {
+		return response, failed(err, http.StatusInternalServerError, "Error fetching timeseries")
+	}
+	log.Printf("Fetched %s timeseries from %s to %s\n", granularity, since, until)
+	return response, nil
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/stream"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxReplay caps the missed posts sent to a client resuming with
+	// Last-Event-ID. Clients further behind get a reset after them.
+	maxReplay       = 1000
+	replayPage      = 100
+	streamHeartbeat = 20 * time.Second
+)
+
+type StreamService struct {
+	Hub        *stream.Hub
+	Repository db.PostRepo
+}
+
+// StreamGetHandler sends new posts and deletes as server-sent events. Post
+// events carry their cursor as the event ID, so a reconnecting client's
+// Last-Event-ID replays the posts it missed.
+func (ss *StreamService) StreamGetHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var last db.PostCursor
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if last, err = parseResumeCursor(id); err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before replaying so nothing stored in between is missed.
+	client, err := ss.Hub.Subscribe(filter)
+	if errors.Is(err, stream.ErrTooManyClients) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer ss.Hub.Unsubscribe(client)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	last, err = ss.replay(last, filter, func(e stream.Event) error { return writeEvent(w, e) })
+	if err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-client.Events():
+			if !ok {
+				return
+			}
+			if replayed(e, last) {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			if !e.ID.IsZero() {
+				last = e.ID
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// parseResumeCursor reads the cursor of the last post a client saw. A bare
+// time_us, sent by clients from before cursors carried the row, resumes after
+// every post at that time.
+func parseResumeCursor(s string) (db.PostCursor, error) {
+	c, err := db.ParsePostCursor(s)
+	if err == nil && c.ID == 0 {
+		c.ID = math.MaxInt64
+	}
+	return c, err
+}
+
+// replayed reports whether e is a post replay already sent, at or before last.
+func replayed(e stream.Event, last db.PostCursor) bool {
+	return !e.ID.IsZero() && !last.Less(e.ID)
+}
+
+// replay sends the posts matching filter stored after the cursor last, up to
+// maxReplay, and returns the cursor of the last one sent. When more were
+// missed than that, a reset follows them.
+func (ss *StreamService) replay(last db.PostCursor, filter db.PostFilter, send func(stream.Event) error) (db.PostCursor, error) {
+	if last.IsZero() {
+		return last, nil
+	}
+	for sent := 0; sent < maxReplay; sent += replayPage {
+		posts, err := ss.Repository.GetPostsAfter(last, filter, replayPage)
+		if err != nil {
+			log.Printf("Error replaying stream: %v", err)
+			return last, err
+		}
+		for _, p := range posts {
+			if err := send(stream.Event{ID: p.Cursor(), Name: "post", Data: p}); err != nil {
+				return last, err
+			}
+			last = p.Cursor()
+		}
+		if len(posts) < replayPage {
+			return last, nil
+		}
+	}
+
+	more, err := ss.Repository.GetPostsAfter(last, filter, 1)
+	if err != nil {
+		log.Printf("Error replaying stream: %v", err)
+		return last, err
+	}
+	if len(more) > 0 {
+		return last, send(stream.Event{Name: "reset", Data: stream.Reset{Cursor: last.String()}})
+	}
+	return last, nil
+}
+
+func writeEvent(w io.Writer, e stream.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	if !e.ID.IsZero() {
+		if _, err := fmt.Fprintf(w, "id: %s\n", e.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, data)
+	return err
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"gitfeed/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamGetHandler(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	// The second post shares the first's time_us, so resuming after the first
+	// has to go by row too.
+	tied := dbtest.Post(2)
+	tied.TimeUs = dbtest.Post(1).TimeUs
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	require.NoError(t, repo.WritePost(tied))
+	hub, err := stream.NewHub(repo)
+	require.NoError(t, err)
+	ss := &StreamService{Hub: hub, Repository: repo}
+	server := httptest.NewServer(http.HandlerFunc(ss.StreamGetHandler))
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"?lang=en", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", db.PostCursor{TimeUs: dbtest.Post(1).TimeUs, ID: 1}.String())
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		var event []string
+		for lines.Scan() && lines.Text() != "" {
+			event = append(event, lines.Text())
+		}
+		return strings.Join(event, "\n")
+	}
+	assert.Contains(t, next(), fmt.Sprintf("id: %d_2\nevent: post\ndata: {\"Did\":%q", tied.TimeUs, tied.Did),
+		"missed posts are replayed")
+
+	require.NoError(t, repo.WritePost(dbtest.Post(3)))
+	require.NoError(t, hub.Publish([]db.Change{
+		{Op: db.PostWritten, TimeUs: dbtest.Post(3).TimeUs},
+		{Op: db.PostDeleted, Did: "did:plc:a", Rkey: "1"},
+	}))
+	assert.Contains(t, next(), fmt.Sprintf("id: %d_3\nevent: post\n", dbtest.Post(3).TimeUs))
+	assert.Equal(t, `event: delete`+"\n"+`data: {"did":"did:plc:a","rkey":"1"}`, next())
+}
+
+func TestStreamGetHandlerRejectsBadResume(t *testing.T) {
+	hub, err := stream.NewHub(db.NewMemoryPostRepository())
+	require.NoError(t, err)
+	ss := &StreamService{Hub: hub, Repository: db.NewMemoryPostRepository()}
+
+	req := httptest.NewRequest("GET", "/api/v1/stream", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	rec := httptest.NewRecorder()
+	ss.StreamGetHandler(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestStreamGetHandlerResetsAfterMaxReplay(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	for i := 1; i <= maxReplay+2; i++ {
+		require.NoError(t, repo.WritePost(dbtest.Post(i)))
+	}
+	hub, err := stream.NewHub(repo)
+	require.NoError(t, err)
+	ss := &StreamService{Hub: hub, Repository: repo}
+
+	var events []stream.Event
+	last, err := ss.replay(db.PostCursor{TimeUs: dbtest.Post(1).TimeUs, ID: 1}, db.PostFilter{}, func(e stream.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, events, maxReplay+1)
+	assert.Equal(t, db.PostCursor{TimeUs: dbtest.Post(maxReplay + 1).TimeUs, ID: maxReplay + 1}, last)
+	assert.Equal(t, stream.Event{Name: "reset", Data: stream.Reset{Cursor: last.String()}}, events[maxReplay],
+		"the post left out isn't dropped silently")
+}
+
+func TestParseResumeCursor(t *testing.T) {
+	c, err := parseResumeCursor("1700000000000000")
+	require.NoError(t, err)
+	assert.True(t, db.PostCursor{TimeUs: 1700000000000000, ID: 1}.Less(c), "a bare time_us resumes after every post at that time")
+
+	c, err = parseResumeCursor("1700000000000000_7")
+	require.NoError(t, err)
+	assert.Equal(t, db.PostCursor{TimeUs: 1700000000000000, ID: 7}, c)
+}
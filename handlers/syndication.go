@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"gitfeed/db"
+	"gitfeed/syndication"
+	"gitfeed/trending"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSyndicationLimit = 50
+	maxSyndicationLimit     = 100
+)
+
+// SyndicationService serves the link stream to feed readers.
+type SyndicationService struct {
+	Repository db.PostRepo
+	Engine     *trending.Engine
+}
+
+func (ss *SyndicationService) RSSHandler(w http.ResponseWriter, r *http.Request) {
+	ss.serveFeed(w, r, syndication.RSS)
+}
+
+func (ss *SyndicationService) AtomHandler(w http.ResponseWriter, r *http.Request) {
+	ss.serveFeed(w, r, syndication.Atom)
+}
+
+func (ss *SyndicationService) JSONFeedHandler(w http.ResponseWriter, r *http.Request) {
+	ss.serveFeed(w, r, syndication.JSONFeed)
+}
+
+// serveFeed renders the latest posts matching the /api/v1/posts filters, or
+// with sort=trending the newest post about each trending repository.
+func (ss *SyndicationService) serveFeed(w http.ResponseWriter, r *http.Request, format syndication.Format) {
+	log.Println(r.Host, r.Method, r.RequestURI, r.RemoteAddr)
+	query := r.URL.Query()
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultSyndicationLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxSyndicationLimit {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var posts []db.DBPost
+	title := "gitfeed: latest"
+	switch sort := query.Get("sort"); sort {
+	case "", "latest":
+		posts, err = ss.Repository.GetPostsBefore(db.PostCursor{}, filter, limit)
+	case "trending":
+		name := query.Get("window")
+		if name == "" {
+			name = "24h"
+		}
+		window, werr := trending.ParseWindow(name)
+		if werr != nil {
+			http.Error(w, werr.Error(), http.StatusBadRequest)
+			return
+		}
+		title = "gitfeed: trending over " + window.Name
+		posts, err = ss.trendingPosts(window, filter, limit)
+	default:
+		http.Error(w, "sort must be latest or trending", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching posts for %s feed: %v", format, err)
+		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	home := scheme + "://" + r.Host + "/"
+	feed := syndication.Feed{
+		Title:       title,
+		Description: "GitHub links shared on Bluesky",
+		HomeURL:     home,
+		FeedURL:     home + r.URL.RequestURI()[1:],
+	}
+	for _, p := range posts {
+		item := syndication.NewItem(p)
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	if feed.Updated.IsZero() {
+		// An empty feed must render the same each time to keep its ETag.
+		feed.Updated = time.Unix(0, 0).UTC()
+	}
+
+	var body bytes.Buffer
+	if err := syndication.Write(&body, format, feed); err != nil {
+		log.Printf("Error rendering %s feed: %v", format, err)
+		http.Error(w, "Error rendering feed", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	// ServeContent answers If-None-Match and If-Modified-Since with 304s.
+	http.ServeContent(w, r, "", feed.Updated, bytes.NewReader(body.Bytes()))
+}
+
+// trendingPosts returns the newest post about each trending repository, in ranking order.
+func (ss *SyndicationService) trendingPosts(window trending.Window, filter db.PostFilter, limit int) ([]db.DBPost, error) {
+	repos, err := ss.Engine.Trending(window, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	var posts []db.DBPost
+	for _, r := range repos {
+		f := filter
+		f.Forge, f.Owner, f.Name = r.Forge, r.Owner, r.Name
+		latest, err := ss.Repository.GetPostsBefore(db.PostCursor{}, f, 1)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, latest...)
+	}
+	return posts, nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"gitfeed/trending"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mentions []db.Mention
+
+func (m mentions) GetMentions(since int64, filter db.PostFilter) ([]db.Mention, error) {
+	return m, nil
+}
+
+func TestSyndication(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	german := dbtest.Post(3)
+	german.Languages = []string{"de"}
+	for _, p := range []db.DBPost{dbtest.Post(1), dbtest.Post(2), german} {
+		require.NoError(t, repo.WritePost(p))
+	}
+	now := time.Now().UnixMicro()
+	ss := &SyndicationService{Repository: repo, Engine: trending.NewEngine(mentions{
+		{RepositoryID: 1, Forge: "github", Owner: "owner", Name: "repo1", Did: "did:plc:a", TimeUs: now},
+	})}
+	get := func(handler http.HandlerFunc, target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	items := func(rec *httptest.ResponseRecorder) []string {
+		var feed struct {
+			Items []struct {
+				ExternalURL string `json:"external_url"`
+			} `json:"items"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&feed))
+		var links []string
+		for _, i := range feed.Items {
+			links = append(links, i.ExternalURL)
+		}
+		return links
+	}
+
+	rec := get(ss.JSONFeedHandler, "/feed.json", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/feed+json; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, time.UnixMicro(german.TimeUs).UTC().Format(http.TimeFormat), rec.Header().Get("Last-Modified"))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, []string{german.URI, dbtest.Post(2).URI, dbtest.Post(1).URI}, items(rec))
+
+	rec = get(ss.JSONFeedHandler, "/feed.json", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	rec = get(ss.JSONFeedHandler, "/feed.json", http.Header{"If-Modified-Since": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = get(ss.JSONFeedHandler, "/feed.json?lang=de", nil)
+	assert.Equal(t, []string{german.URI}, items(rec))
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+	rec = get(ss.AtomHandler, "/feed.atom?lang=fr", nil)
+	assert.Contains(t, rec.Body.String(), "<updated>1970-01-01T00:00:00Z</updated>", "empty feeds don't change between requests")
+	empty := rec.Header().Get("ETag")
+	require.NotEmpty(t, empty)
+	rec = get(ss.AtomHandler, "/feed.atom?lang=fr", http.Header{"If-None-Match": {empty}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	rec = get(ss.JSONFeedHandler, "/feed.json?sort=trending", nil)
+	assert.Equal(t, []string{dbtest.Post(1).URI}, items(rec))
+
+	rec = get(ss.RSSHandler, "/feed.rss?owner=Owner&limit=1", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/rss+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "<link>"+german.URI+"</link>")
+	rec = get(ss.AtomHandler, "/feed.atom", nil)
+	assert.Contains(t, rec.Body.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`)
+
+	for _, target := range []string{"/feed.json?sort=oldest", "/feed.json?limit=0", "/feed.json?sort=trending&window=1y", "/feed.json?lang=!!"} {
+		assert.Equal(t, http.StatusBadRequest, get(ss.JSONFeedHandler, target, nil).Code, target)
+	}
+}
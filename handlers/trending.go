@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"gitfeed/api"
+	"gitfeed/trending"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 100
+)
+
+type TrendingService struct {
+	Engine *trending.Engine
+}
+
+type TrendingResponse struct {
+	Window       string                `json:"window"`
+	Repositories []trending.Repository `json:"repositories"`
+}
+
+func (ts *TrendingService) TrendingGetHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := ts.trending(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, response)
+}
+
+func (ts *TrendingService) TrendingGetHandlerV2(w http.ResponseWriter, r *http.Request) {
+	response, err := ts.trending(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+	writeJSON(w, api.Trending{Window: response.Window, Repositories: api.NewTrendingRepositories(response.Repositories)})
+}
+
+func (ts *TrendingService) trending(r *http.Request) (TrendingResponse, error) {
+	name := r.URL.Query().Get("window")
+	if name == "" {
+		name = "24h"
+	}
+	window, err := trending.ParseWindow(name)
+	if err != nil {
+		return TrendingResponse{}, badRequest(err.Error())
+	}
+
+	limit := defaultTrendingLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxTrendingLimit {
+			return TrendingResponse{}, badRequest("limit must be between 1 and 100")
+		}
+	}
+
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		return TrendingResponse{}, badRequest(err.Error())
+	}
+
+	repos, err := ts.Engine.Trending(window, filter, limit)
+	if err != nil {
+		return TrendingResponse{}, failed(err, http.StatusInternalServerError, "Error fetching trending repositories")
+	}
+	log.Printf("Fetched and returned %d trending repositories for %s\n", len(repos), window.Name)
+	return TrendingResponse{Window: window.Name, Repositories: repos}, nil
+}
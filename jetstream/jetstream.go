@@ -0,0 +1,89 @@
+// Package jetstream turns Jetstream events into the posts gitfeed stores. Live
+// ingest and the backfill importer share it so both match the same posts.
+package jetstream
+
+import (
+	"database/sql"
+	"gitfeed/db"
+	"gitfeed/langdetect"
+	"log"
+	"strings"
+)
+
+// GitHub matches
+func FindMatches(text, pattern string) bool {
+
+	return strings.Contains(text, pattern)
+
+}
+
+func ExtractUri(p db.ATPost) string {
+	var uri string
+	for _, facet := range p.Commit.Record.Facets {
+		for _, feature := range facet.Features {
+			if feature.Type == "app.bsky.richtext.facet#link" {
+				uri = feature.URI
+			}
+		}
+	}
+	return uri
+}
+
+// Languages returns the languages a post declares, or the one detected from
+// its text when it declares none. detected reports which it was.
+func Languages(p db.ATPost) (langs []string, detected bool) {
+	if langs := langdetect.NormalizeAll(p.Commit.Record.Langs); len(langs) > 0 {
+		return langs, false
+	}
+	if lang := langdetect.Detect(p.Commit.Record.Text); lang != "" {
+		return []string{lang}, true
+	}
+	return nil, false
+}
+
+// ProcessPost returns the post to store for a Jetstream event, or a zero
+// DBPost if it doesn't link to GitHub.
+func ProcessPost(post db.ATPost) db.DBPost {
+	dbpost := db.DBPost{}
+
+	if found := FindMatches(post.Commit.Record.Text, "github.com"); found {
+		log.Printf("Post: %v", post)
+
+		var langs sql.Null[string]
+		if len(post.Commit.Record.Langs) > 0 {
+			langs.Valid = true
+			langs.V = post.Commit.Record.Langs[0]
+		}
+
+		uri := ExtractUri(post)
+		if uri != "" && FindMatches(uri, "github.com") {
+			languages, detected := Languages(post)
+			dbPost := db.DBPost{
+				Did:        post.Did,
+				TimeUs:     post.TimeUs,
+				Kind:       post.Kind,
+				Operation:  post.Commit.Operation,
+				Collection: post.Commit.Collection,
+				Rkey:       post.Commit.Rkey,
+				Cid:        post.Commit.Cid,
+				Type:       post.Commit.Record.Type,
+				CreatedAt:  post.Commit.Record.CreatedAt,
+				Langs:      langs,
+				Text:       post.Commit.Record.Text,
+				URI:        uri,
+				ParentURI:  post.Commit.Record.Reply.Parent.URI,
+				ParentCid:  post.Commit.Record.Reply.Parent.Cid,
+				RootURI:    post.Commit.Record.Reply.Root.URI,
+				RootCid:    post.Commit.Record.Reply.Root.Cid,
+
+				Languages:         languages,
+				LanguagesDetected: detected,
+			}
+			dbpost = dbPost
+
+		}
+
+	}
+
+	return dbpost
+}
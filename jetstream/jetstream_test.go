@@ -0,0 +1,89 @@
+package jetstream
+
+import (
+	"database/sql"
+	"gitfeed/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestProcessPost(t *testing.T) {
+
+	post := db.ATPost{
+		Did:    "did:plc:7ywxd6gcvpmgw3q33dg6xnxf",
+		TimeUs: 1703088300000000, // Dec 20, 2024 15:45:00 UTC
+		Type:   "create",
+		Kind:   "app.bsky.feed.post",
+		Commit: db.ATCommit{
+			Rev:        "3jdkeis8fj",
+			Type:       "app.bsky.feed.post",
+			Operation:  "create",
+			Collection: "app.bsky.feed.post",
+			Rkey:       "3jsu47dlw9",
+			Record: db.ATRecord{
+				Type:      "app.bsky.feed.post",
+				CreatedAt: time.Date(2024, 12, 20, 15, 45, 0, 0, time.UTC),
+				Embed: db.ATEmbed{
+					Type: "app.bsky.embed.external",
+					External: db.ATExternal{
+						Description: "Discover the latest advances in distributed systems and their practical applications in modern software architecture.",
+						Title:       "Understanding Distributed Systems in 2024",
+						URI:         "https://tech-articles.example.com/distributed-systems-2024",
+					},
+				},
+				Facets: []db.ATFacet{
+					{
+						Features: []db.ATFeature{
+							{
+								Type: "app.bsky.richtext.facet#mention",
+								URI:  "at://did:plc:4xj4pq5yuxxy6yh6tropical/profile",
+							},
+						},
+						Index: db.ATFacetIndex{
+							ByteStart: 0,
+							ByteEnd:   8,
+						},
+					},
+					{
+						Features: []db.ATFeature{
+							{
+								Type: "app.bsky.richtext.facet#link",
+								URI:  "https://github.com/distributed-systems-2024",
+							},
+						},
+						Index: db.ATFacetIndex{
+							ByteStart: 64,
+							ByteEnd:   127,
+						},
+					},
+				},
+				Langs: []string{"en"},
+				Text:  "@xzy Check out this fascinating article on distributed systems! https://github.com/distributed-systems-2024 #tech #distributed",
+			},
+			Cid: "bafyreib2rxk3rqpbswxhicg4x3nqwfxwyfqrj5luzb7pwxixphv5a2",
+		},
+	}
+	want := db.DBPost{
+		Did:        "did:plc:7ywxd6gcvpmgw3q33dg6xnxf",
+		TimeUs:     1703088300000000,
+		Kind:       "app.bsky.feed.post",
+		Operation:  "create",
+		Collection: "app.bsky.feed.post",
+		Rkey:       "3jsu47dlw9",
+		Cid:        "bafyreib2rxk3rqpbswxhicg4x3nqwfxwyfqrj5luzb7pwxixphv5a2",
+		Type:       "app.bsky.feed.post",
+		CreatedAt:  time.Date(2024, 12, 20, 15, 45, 0, 0, time.UTC),
+		Langs: sql.Null[string]{
+			V:     "en",
+			Valid: true,
+		},
+		Text: "@xzy Check out this fascinating article on distributed systems! https://github.com/distributed-systems-2024 #tech #distributed",
+		URI:  "https://github.com/distributed-systems-2024",
+
+		Languages: []string{"en"},
+	}
+	got := ProcessPost(post)
+	assert.Equal(t, want, got, "values should match")
+
+}
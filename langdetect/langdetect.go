@@ -0,0 +1,176 @@
+// Package langdetect normalizes declared post languages and guesses one for
+// posts that don't declare any. Detection is deliberately small: it reads the
+// writing system, and for Latin text counts common words of a few languages.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize reduces a BCP 47 tag to its lowercased primary language subtag,
+// so "en-US" and "EN" both become "en". It returns "" for anything that
+// isn't a language tag.
+func Normalize(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if len(tag) < 2 || len(tag) > 3 {
+		return ""
+	}
+	for _, r := range tag {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return ""
+		}
+	}
+	return strings.ToLower(tag)
+}
+
+// NormalizeAll normalizes tags, dropping invalid ones and duplicates while
+// keeping the declared order.
+func NormalizeAll(tags []string) []string {
+	var langs []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if lang := Normalize(tag); lang != "" && !seen[lang] {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// minLetters is the least text worth guessing from.
+const minLetters = 12
+
+var scripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"el", unicode.Greek},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"hi", unicode.Devanagari},
+	{"th", unicode.Thai},
+	{"", unicode.Latin},
+}
+
+// stopwords are frequent words that mostly belong to one language.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "to", "of", "this", "that", "with", "for", "it", "you", "was", "have",
+		"on", "my", "be", "not", "just", "what", "how", "from", "out", "check", "new", "i", "we", "your"},
+	"es": {"el", "la", "los", "las", "es", "y", "que", "en", "un", "una", "por", "con", "para", "del", "muy",
+		"este", "esta", "pero", "como", "más", "mi", "lo", "yo", "nuevo"},
+	"pt": {"o", "os", "as", "é", "e", "que", "um", "uma", "não", "com", "para", "do", "da", "dos", "das",
+		"em", "no", "na", "mais", "isso", "meu", "você", "novo"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "du", "pour", "que", "qui", "pas", "dans",
+		"sur", "avec", "ce", "cette", "je", "vous", "c'est", "mais", "nouveau"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "mit", "für", "auf", "ich", "sie",
+		"es", "zu", "den", "dem", "auch", "wie", "von", "sehr", "neue"},
+	"it": {"il", "lo", "la", "gli", "le", "e", "è", "che", "un", "una", "per", "con", "non", "del", "della",
+		"di", "sono", "questo", "questa", "mi", "anche", "ma", "nuovo"},
+	"nl": {"de", "het", "een", "en", "is", "van", "dat", "niet", "met", "voor", "op", "ik", "je", "zijn",
+		"ook", "maar", "naar", "wat", "dit", "nieuwe"},
+}
+
+var stopwordLangs map[string][]string
+
+func init() {
+	stopwordLangs = make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			stopwordLangs[w] = append(stopwordLangs[w], lang)
+		}
+	}
+}
+
+// Detect guesses the language of text, returning "" when it can't tell.
+// Links, mentions and hashtags are ignored.
+func Detect(text string) string {
+	var words []string
+	for _, w := range strings.Fields(text) {
+		if strings.HasPrefix(w, "@") || strings.HasPrefix(w, "#") || strings.Contains(w, "://") ||
+			strings.Contains(w, ".com") || strings.Contains(w, ".org") {
+			continue
+		}
+		words = append(words, w)
+	}
+
+	counts := make(map[int]int)
+	letters := 0
+	for _, w := range words {
+		for _, r := range w {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			letters++
+			for i, s := range scripts {
+				if unicode.Is(s.table, r) {
+					counts[i]++
+					break
+				}
+			}
+		}
+	}
+	if letters < minLetters {
+		return ""
+	}
+
+	// Kana only appears in Japanese, which also uses Han, so any amount decides it.
+	if counts[0]+counts[1] > 0 {
+		return "ja"
+	}
+	best := -1
+	for i := range scripts {
+		if best < 0 || counts[i] > counts[best] {
+			best = i
+		}
+	}
+	if counts[best]*2 < letters {
+		return ""
+	}
+	switch lang := scripts[best].lang; lang {
+	case "":
+		return detectLatin(words)
+	case "ru":
+		if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return "uk"
+		}
+		return lang
+	default:
+		return lang
+	}
+}
+
+func detectLatin(words []string) string {
+	scores := make(map[string]int)
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) && r != '\'' }))
+		for _, lang := range stopwordLangs[w] {
+			scores[lang]++
+		}
+	}
+
+	best, runnerUp := "", 0
+	for lang, score := range scores {
+		switch {
+		case best == "" || score > scores[best]:
+			if best != "" {
+				runnerUp = scores[best]
+			}
+			best = lang
+		case score > runnerUp:
+			runnerUp = score
+		}
+	}
+	if best == "" || scores[best] < 2 || scores[best] == runnerUp {
+		return ""
+	}
+	return best
+}
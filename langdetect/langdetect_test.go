@@ -0,0 +1,40 @@
+package langdetect
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "en", Normalize("en-US"))
+	assert.Equal(t, "pt", Normalize(" PT_br "))
+	assert.Equal(t, "", Normalize("english"))
+	assert.Equal(t, "", Normalize("日本"))
+	assert.Equal(t, []string{"en", "de"}, NormalizeAll([]string{"en", "en-GB", "x", "de"}))
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"Check out this new library for parsing logs https://github.com/owner/repo", "en"},
+		{"Mira este proyecto, es muy útil para la terminal https://github.com/owner/repo", "es"},
+		{"Isso é muito bom, você tem que ver o código https://github.com/owner/repo", "pt"},
+		{"Je viens de publier une nouvelle version de mon projet pour les développeurs", "fr"},
+		{"Das ist ein sehr nützliches Tool für die Kommandozeile und ich mag es", "de"},
+		{"Questo è il mio nuovo progetto per gli sviluppatori, che ne pensate", "it"},
+		{"Ik heb een nieuwe versie van mijn project op GitHub gezet, met veel fixes", "nl"},
+		{"新しいライブラリを公開しました https://github.com/owner/repo", "ja"},
+		{"새로운 오픈소스 프로젝트를 공개했습니다 많이 사용해 주세요", "ko"},
+		{"我刚刚发布了一个新的开源项目，欢迎大家使用和反馈", "zh"},
+		{"Выложил новую версию своего проекта, буду рад отзывам", "ru"},
+		{"Виклав нову версію свого проєкту, буду радий відгукам", "uk"},
+		{"https://github.com/owner/repo", ""},
+		{"lgtm 🚀 @someone.bsky.social", ""},
+		{"Rust Go Zig WASM LLVM", ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, Detect(c.text), c.text)
+	}
+}
@@ -5,16 +5,74 @@ import (
 	"net/http"
 )
 
-func CreateRoutes(postService *handlers.PostService) {
+func CreateRoutes(postService *handlers.PostService, trendingService *handlers.TrendingService, exportService *handlers.ExportService, statsService *handlers.StatsService, streamService *handlers.StreamService, syndicationService *handlers.SyndicationService, githubService *handlers.GitHubService, repositoryService *handlers.RepositoryService, feedService *handlers.FeedService) {
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("GET /static/favicon.ico", fs)
 	http.Handle("GET /", fs)
 
 	/*Post Routes*/
-	http.HandleFunc("GET /api/v1/post/{id}", postService.PostGetHandler)
+	http.HandleFunc("GET /api/v1/post/{did}/{rkey}", postService.PostGetHandler)
+	http.HandleFunc("GET /api/v1/post/{uri}", postService.PostGetHandler)
 
 	http.HandleFunc("GET /api/v1/posts", postService.PostsGetHandler)
 	http.HandleFunc("GET /api/v1/timestamp", postService.TimeStampGetHandler)
-	http.HandleFunc("GET /api/v1/github/{username}/{repository}", handlers.HandleGitHubRepo)
+	http.HandleFunc("GET /api/v1/github/{username}/{repository}", githubService.RepoGetHandler)
+	http.HandleFunc("GET /api/v1/github/{username}/{repository}/issues/{number}", githubService.IssueGetHandler)
+	http.HandleFunc("GET /api/v1/github/{username}/{repository}/pull/{number}", githubService.IssueGetHandler)
+	http.HandleFunc("GET /api/v1/github/{username}/{repository}/releases/latest", githubService.ReleaseGetHandler)
+	http.HandleFunc("GET /api/v1/github/{username}/{repository}/releases/tag/{tag...}", githubService.ReleaseGetHandler)
+	http.HandleFunc("GET /api/v1/github/{username}/{repository}/commit/{sha}", githubService.CommitGetHandler)
+	http.HandleFunc("GET /api/v1/github/gists/{id}", githubService.GistGetHandler)
+
+	/*Repository Routes*/
+	http.HandleFunc("GET /api/v1/repos", repositoryService.RepositoriesGetHandler)
+	http.HandleFunc("GET /api/v1/repos/{forge}/{owner}/{repo}", repositoryService.RepositoryGetHandler)
+	http.HandleFunc("GET /api/v1/repos/{forge}/{owner}/{repo}/history", repositoryService.RepositoryHistoryGetHandler)
+	http.HandleFunc("GET /api/v1/owners/{owner}", repositoryService.OwnerGetHandler)
+
+	/*Trending Routes*/
+	http.HandleFunc("GET /api/v1/trending", trendingService.TrendingGetHandler)
+
+	/*Export Routes*/
+	http.HandleFunc("GET /api/v1/export", exportService.ExportGetHandler)
+
+	/*Stats Routes*/
+	http.HandleFunc("GET /api/v1/stats/timeseries", statsService.TimeseriesGetHandler)
+
+	/*Stream Routes*/
+	http.HandleFunc("GET /api/v1/stream", streamService.StreamGetHandler)
+	http.HandleFunc("GET /api/v1/subscribe", streamService.SubscribeHandler)
+
+	/*Syndication Routes*/
+	http.HandleFunc("GET /feed.rss", syndicationService.RSSHandler)
+	http.HandleFunc("GET /feed.atom", syndicationService.AtomHandler)
+	http.HandleFunc("GET /feed.json", syndicationService.JSONFeedHandler)
+
+	/*API v2 Routes*/
+	http.HandleFunc("GET /api/v2/posts", postService.PostsGetHandlerV2)
+	http.HandleFunc("GET /api/v2/posts/{did}/{rkey}", postService.PostGetHandlerV2)
+	http.HandleFunc("GET /api/v2/posts/{uri}", postService.PostGetHandlerV2)
+	http.HandleFunc("GET /api/v2/timestamp", postService.TimeStampGetHandlerV2)
+	http.HandleFunc("GET /api/v2/trending", trendingService.TrendingGetHandlerV2)
+	http.HandleFunc("GET /api/v2/repos", repositoryService.RepositoriesGetHandlerV2)
+	http.HandleFunc("GET /api/v2/repos/{forge}/{owner}/{repo}", repositoryService.RepositoryGetHandlerV2)
+	http.HandleFunc("GET /api/v2/repos/{forge}/{owner}/{repo}/history", repositoryService.RepositoryHistoryGetHandlerV2)
+	http.HandleFunc("GET /api/v2/owners/{forge}/{owner}", repositoryService.OwnerGetHandlerV2)
+	http.HandleFunc("GET /api/v2/stats/timeseries", statsService.TimeseriesGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/{username}/{repository}", githubService.RepoGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/{username}/{repository}/issues/{number}", githubService.IssueGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/{username}/{repository}/pull/{number}", githubService.IssueGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/{username}/{repository}/releases/latest", githubService.ReleaseGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/{username}/{repository}/releases/tag/{tag...}", githubService.ReleaseGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/{username}/{repository}/commit/{sha}", githubService.CommitGetHandlerV2)
+	http.HandleFunc("GET /api/v2/github/gists/{id}", githubService.GistGetHandlerV2)
+	http.HandleFunc("GET /api/v2/", handlers.NotFoundV2)
+
+	/*Feed Generator Routes*/
+	if feedService != nil {
+		http.HandleFunc("GET /.well-known/did.json", feedService.DidDocumentHandler)
+		http.HandleFunc("GET /xrpc/app.bsky.feed.describeFeedGenerator", feedService.DescribeFeedGeneratorHandler)
+		http.HandleFunc("GET /xrpc/app.bsky.feed.getFeedSkeleton", feedService.GetFeedSkeletonHandler)
+	}
 
 }
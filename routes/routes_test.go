@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"gitfeed/handlers"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRepositoryRoutes(t *testing.T) {
+	CreateRoutes(&handlers.PostService{}, &handlers.TrendingService{}, &handlers.ExportService{}, &handlers.StatsService{},
+		&handlers.StreamService{}, &handlers.SyndicationService{}, &handlers.GitHubService{}, &handlers.RepositoryService{}, nil)
+
+	for target, want := range map[string]string{
+		"/api/v1/repos/github/owner/history":         "GET /api/v1/repos/{forge}/{owner}/{repo}",
+		"/api/v1/repos/github/owner/history/history": "GET /api/v1/repos/{forge}/{owner}/{repo}/history",
+		"/api/v1/repos/github/owner/repo/history":    "GET /api/v1/repos/{forge}/{owner}/{repo}/history",
+		"/api/v2/repos/github/owner/history":         "GET /api/v2/repos/{forge}/{owner}/{repo}",
+		"/api/v2/repos/github/owner/history/history": "GET /api/v2/repos/{forge}/{owner}/{repo}/history",
+	} {
+		_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest("GET", target, nil))
+		if pattern != want {
+			t.Errorf("%s routed to %q, want %q", target, pattern, want)
+		}
+	}
+}
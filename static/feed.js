@@ -14,17 +14,8 @@ function getUserAndRepoFromURL(url) {
     }
 }
 
-async function hydratePost(post, repoUrl) {
-    try {
-        const [username, repository] = getUserAndRepoFromURL(repoUrl);
-        console.log(username, repository);
-
-        // GitHub call
-        const repoResponse = await fetch(`/api/v1/github/${username}/${repository}`);
-
-        if (!repoResponse.ok) {
-
-            return `<div class="post-card link-underline link-underline-opacity-0 link-underline-opacity-100-hover">
+function renderBareRepo(username, repository) {
+    return `<div class="post-card link-underline link-underline-opacity-0 link-underline-opacity-100-hover">
                 <div class="post-content">
                 <div class="repo-info">
                 <div class="repo-header  style="padding: 10px 10px 10px 10px;">
@@ -33,28 +24,122 @@ async function hydratePost(post, repoUrl) {
                 </div>
                 </div>
                 </div>`;
-            throw new Error(`HTTP error! status: ${repoResponse.status}`);
-        }
-        const repoData = await repoResponse.json();
-        console.log("Repo data" + repoData)
+}
 
-        return `
+// renderRepo takes repository metadata as embedded by /api/v1/posts?hydrate=repo.
+function renderRepo(repo) {
+    return `
                 <div class="post-card link-underline link-underline-opacity-0 link-underline-opacity-100-hover">
                 <div class="post-content">
                 <div class="repo-info">
                 <div class="repo-header  style="padding: 10px 10px 10px 10px;">
                     <i class="bi bi-github"></i>
-                     <a href="https://github.com/${repoData.full_name}" target="_blank" rel="noopener noreferrer">${repoData.name || 'No description available'}</a>
-                    <p>${repoData.description || 'No description available'}</p>
+                     <a href="https://github.com/${repo.full_name}" target="_blank" rel="noopener noreferrer">${repo.name || 'No description available'}</a>
+                    <p>${repo.description || 'No description available'}</p>
+                    <div class="repo-stats">
+                        <span><i class="bi bi-star"></i> ${repo.stars}</span>
+                        <span><i class="bi bi-diagram-2"></i> ${repo.forks}</span>
+                        <span>${repo.language || 'Unknown language'}</span>
+                    </div>
+                </div>
+                </div>
+                </div>
+</div>`;
+}
+
+// githubLink classifies a GitHub link as a repo, issue (or pull request),
+// release, commit or gist, with the API path that hydrates it.
+function githubLink(url) {
+    const gist = url.match(/https:\/\/gist\.github\.com\/(?:[^\/\s]+\/)?([0-9a-zA-Z]+)/);
+    if (gist) {
+        return { kind: 'gist', api: `/api/v1/github/gists/${gist[1]}` };
+    }
+    const match = url.match(/https:\/\/github\.com\/([^\/\s]+)\/([^\/\s?#]+)(?:\/([^\s?#]*))?/);
+    if (!match) {
+        return null;
+    }
+    const [, username, repository, rest = ''] = match;
+    const base = `/api/v1/github/${username}/${repository}`;
+    let m;
+    if ((m = rest.match(/^(issues|pull)\/(\d+)/))) {
+        return { kind: 'issue', api: `${base}/${m[1]}/${m[2]}` };
+    }
+    if ((m = rest.match(/^releases\/tag\/(.+)/))) {
+        return { kind: 'release', api: `${base}/releases/tag/${m[1]}` };
+    }
+    if (rest.startsWith('releases/latest')) {
+        return { kind: 'release', api: `${base}/releases/latest` };
+    }
+    if ((m = rest.match(/^commit\/([0-9a-fA-F]{4,40})/))) {
+        return { kind: 'commit', api: `${base}/commit/${m[1]}` };
+    }
+    return { kind: 'repo' };
+}
+
+function renderCard(icon, url, title, body, stats) {
+    return `
+                <div class="post-card link-underline link-underline-opacity-0 link-underline-opacity-100-hover">
+                <div class="post-content">
+                <div class="repo-info">
+                <div class="repo-header  style="padding: 10px 10px 10px 10px;">
+                    <i class="bi ${icon}"></i>
+                     <a href="${escapeHtml(url)}" target="_blank" rel="noopener noreferrer">${escapeHtml(title)}</a>
+                    ${body ? `<p>${escapeHtml(body)}</p>` : ''}
                     <div class="repo-stats">
-                        <span><i class="bi bi-star"></i> ${repoData.stargazers_count}</span>
-                        <span><i class="bi bi-diagram-2"></i> ${repoData.forks_count}</span>
-                        <span>${repoData.language || 'Unknown language'}</span>
+                        ${stats.map(stat => `<span>${stat}</span>`).join('')}
                     </div>
                 </div>
                 </div>
                 </div>
 </div>`;
+}
+
+const linkRenderers = {
+    issue: issue => renderCard(
+        issue.pull_request ? 'bi-git' : 'bi-record-circle', issue.url, `#${issue.number} ${issue.title}`, '',
+        [escapeHtml(issue.state), `@${escapeHtml(issue.author)}`, `<i class="bi bi-chat"></i> ${formatNumber(issue.comments)}`]),
+    release: release => renderCard(
+        'bi-tag', release.url, release.name || release.tag, '',
+        [escapeHtml(release.tag), `Published ${new Date(release.published_at).toLocaleDateString()}`]),
+    commit: commit => renderCard(
+        'bi-git', commit.url, commit.message.split('\n')[0], '',
+        [escapeHtml(commit.sha.slice(0, 7)), `@${escapeHtml(commit.author)}`]),
+    gist: gist => renderCard(
+        'bi-file-code', gist.url, gist.description || gist.files.map(f => f.filename).join(', '), '',
+        gist.files.map(f => escapeHtml(f.filename))),
+};
+
+async function hydrateLink(link) {
+    try {
+        const response = await fetch(link.api);
+        if (!response.ok) {
+            return '';
+        }
+        return linkRenderers[link.kind](await response.json());
+    } catch (error) {
+        console.error('Error processing GitHub link:', link.api, error);
+        return '';
+    }
+}
+
+async function hydratePost(post, repoUrl) {
+    try {
+        const [username, repository] = getUserAndRepoFromURL(repoUrl);
+
+        // GitHub call
+        const repoResponse = await fetch(`/api/v1/github/${username}/${repository}`);
+        if (!repoResponse.ok) {
+            return renderBareRepo(username, repository);
+        }
+        const repoData = await repoResponse.json();
+        return renderRepo({
+            full_name: repoData.full_name,
+            name: repoData.name,
+            description: repoData.description,
+            stars: repoData.stargazers_count,
+            forks: repoData.forks_count,
+            language: repoData.language,
+        });
     } catch (error) {
         console.error('Error processing repository:', repoUrl, error);
     }
@@ -62,7 +147,7 @@ async function hydratePost(post, repoUrl) {
 
 function renderSkeletonPost(post,uri) {
     return `
-        <div class="post-card link-underline link-underline-opacity-0 link-underline-opacity-100-hover">
+        <div class="post-card link-underline link-underline-opacity-0 link-underline-opacity-100-hover" data-post="${post.Did}/${post.Rkey}">
             <div class="post-header link-underline link-underline-opacity-0 link-underline-opacity-100-hover">
                 <strong>🦋 <a href="https://bsky.app/profile/${post.Did}/post/${post.Rkey}">Post</a> </strong>
                 <strong class="post-link">${linkifyText(uri || '')}</a> </strong>
@@ -184,7 +269,7 @@ export async function fetchPosts() {
     container.innerHTML = '<div class="loading">Loading posts...</div>';
     try {
         console.log('Fetching new posts...');
-        const response = await fetch('/api/v1/posts');
+        const response = await fetch('/api/v1/posts?hydrate=repo');
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
@@ -195,28 +280,56 @@ export async function fetchPosts() {
 
         for (const post of posts) {
             container.insertAdjacentHTML('beforeend', renderSkeletonPost(post, post.URI));
-        }
-        const repoCards = document.querySelectorAll('.post-card');
-        for (const card of repoCards) {
-            const repoHeader = card.querySelector('.repo-header');
-            const repoUrl = card.querySelector('.post-link a').getAttribute('href');
-            console.log("RepoURL " + repoUrl)
-            const githubMatch = isGithubRepo(repoUrl);
-            if (githubMatch && githubMatch[0]) {
-                try {
-                    const hydratedPost = await hydratePost(card, githubMatch[0]);
-                    repoHeader.insertAdjacentHTML('beforeend', hydratedPost) // replace it with hydratedPost output
-                } catch (error) {
-                    console.error('Error fetching GitHub data for post:', error);
-                }
+            const card = container.lastElementChild;
+            if (post.Repo && githubLink(post.URI)?.kind === 'repo') {
+                card.querySelector('.repo-header').insertAdjacentHTML('beforeend', renderRepo(post.Repo));
             } else {
-                let link = '<a href="' + repoUrl + '" target="_blank" rel="noopener noreferrer">' + repoUrl + '</a>';
-                repoHeader.innerHTML = link;
-                continue;
+                // Metadata that wasn't ready in time is fetched per card.
+                hydrateCard(card);
             }
         }
     } catch (error) {
         console.error('Error fetching posts:', error);
         container.innerHTML = '<div class="alert alert-danger">Error loading posts. Please try again later.</div>';
     }
+}
+
+async function hydrateCard(card) {
+    const repoHeader = card.querySelector('.repo-header');
+    const repoUrl = card.querySelector('.post-link a').getAttribute('href');
+    console.log("RepoURL " + repoUrl)
+    const link = githubLink(repoUrl);
+    const githubMatch = isGithubRepo(repoUrl);
+    if (link && link.kind !== 'repo') {
+        repoHeader.insertAdjacentHTML('beforeend', await hydrateLink(link));
+    } else if (githubMatch && githubMatch[0]) {
+        try {
+            const hydratedPost = await hydratePost(card, githubMatch[0]);
+            repoHeader.insertAdjacentHTML('beforeend', hydratedPost) // replace it with hydratedPost output
+        } catch (error) {
+            console.error('Error fetching GitHub data for post:', error);
+        }
+    } else {
+        let link = '<a href="' + repoUrl + '" target="_blank" rel="noopener noreferrer">' + repoUrl + '</a>';
+        repoHeader.innerHTML = link;
+    }
+}
+
+// streamPosts adds posts to the top of the feed as they are stored, and
+// removes deleted ones. EventSource reconnects and resumes by itself.
+export function streamPosts() {
+    const container = document.getElementById('postContainer');
+    const source = new EventSource('/api/v1/stream');
+
+    source.addEventListener('post', async (event) => {
+        const post = JSON.parse(event.data);
+        container.insertAdjacentHTML('afterbegin', renderSkeletonPost(post, post.URI));
+        await hydrateCard(container.firstElementChild);
+        document.getElementById('lastUpdated').textContent = 'Last updated: just now';
+    });
+    source.addEventListener('delete', (event) => {
+        const { did, rkey } = JSON.parse(event.data);
+        container.querySelector(`[data-post="${CSS.escape(did + '/' + rkey)}"]`)?.remove();
+    });
+    source.onerror = (error) => console.error('Post stream error:', error);
 }
\ No newline at end of file
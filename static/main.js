@@ -1,4 +1,4 @@
-import { fetchPosts, updateTimestamp } from './feed.js';
+import { fetchPosts, streamPosts, updateTimestamp } from './feed.js';
 
 
 console.log('Main.js loaded');
@@ -8,6 +8,7 @@ document.addEventListener('DOMContentLoaded', async () => {
     try {
         await fetchPosts();
         await updateTimestamp();
+        streamPosts();
     } catch (error) {
         console.error('Error in main initialization:', error);
     }
@@ -0,0 +1,222 @@
+// Package stream fans newly stored posts out to live subscribers. A single Hub
+// reads each batch of changes from the database once and hands every client
+// the events matching its filter.
+package stream
+
+import (
+	"errors"
+	"gitfeed/api"
+	"gitfeed/db"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBuffer is how many events a client may fall behind before it's evicted.
+	DefaultBuffer = 64
+	// DefaultMaxClients caps concurrent subscribers.
+	DefaultMaxClients = 1000
+
+	pageSize = 500
+)
+
+var ErrTooManyClients = errors.New("too many stream subscribers")
+
+// Event is one message for subscribers: a stored post, a deleted one, or a
+// reset.
+type Event struct {
+	// ID is the cursor of a post, which clients resume from. Other events
+	// have none.
+	ID   db.PostCursor
+	Name string
+	Data any
+}
+
+type Deleted struct {
+	Did  string `json:"did"`
+	Rkey string `json:"rkey"`
+}
+
+// Reset tells a resuming client that replay stopped at Cursor with more
+// posts missed than are replayed. The stream carries on with new posts, so
+// the client has to reload whatever it built from the posts in between.
+type Reset struct {
+	Cursor string `json:"cursor"`
+}
+
+type Client struct {
+	filter db.PostFilter
+	events chan Event
+}
+
+// Events is closed when the client is unsubscribed or falls too far behind.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+type Hub struct {
+	repo       db.PostRepo
+	Buffer     int
+	MaxClients int
+
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+	// last is the cursor of the newest post sent.
+	last db.PostCursor
+}
+
+// NewHub returns a hub that sends posts stored after it was created.
+func NewHub(repo db.PostRepo) (*Hub, error) {
+	newest, err := repo.GetPostsBefore(db.PostCursor{}, db.PostFilter{}, 1)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	h := &Hub{
+		repo:       repo,
+		Buffer:     DefaultBuffer,
+		MaxClients: DefaultMaxClients,
+		clients:    make(map[*Client]struct{}),
+	}
+	if len(newest) > 0 {
+		h.last = newest[0].Cursor()
+	}
+	return h, nil
+}
+
+func (h *Hub) Subscribe(filter db.PostFilter) (*Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) >= h.MaxClients {
+		return nil, ErrTooManyClients
+	}
+	c := &Client{filter: filter, events: make(chan Event, h.Buffer)}
+	h.clients[c] = struct{}{}
+	return c, nil
+}
+
+func (h *Hub) Unsubscribe(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+}
+
+func (h *Hub) remove(c *Client) {
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// Publish sends the posts stored since the last call, then the deletes in
+// changes. It must not be called concurrently.
+func (h *Hub) Publish(changes []db.Change) error {
+	var written bool
+	var deletes []Deleted
+	for _, c := range changes {
+		switch c.Op {
+		case db.PostWritten:
+			// Edits and backfilled posts keep their original time_us. New
+			// posts can share the newest one's.
+			written = written || c.TimeUs >= h.last.TimeUs
+		case db.PostDeleted:
+			deletes = append(deletes, Deleted{Did: c.Did, Rkey: c.Rkey})
+		}
+	}
+
+	for written {
+		posts, err := h.repo.GetPostsAfter(h.last, db.PostFilter{}, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, p := range posts {
+			h.broadcast(Event{ID: p.Cursor(), Name: "post", Data: p}, &p)
+			h.last = p.Cursor()
+		}
+		written = len(posts) == pageSize
+	}
+	for _, d := range deletes {
+		h.broadcast(Event{Name: "delete", Data: d}, nil)
+	}
+	return nil
+}
+
+// broadcast queues e for every client whose filter matches post, evicting
+// clients whose buffer is full. Deletes, with no post, go to every client.
+func (h *Hub) broadcast(e Event, post *db.DBPost) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if post != nil && !c.filter.Match(*post) {
+			continue
+		}
+		select {
+		case c.events <- e:
+		default:
+			log.Printf("Evicting stream subscriber %d events behind", len(c.events))
+			h.remove(c)
+		}
+	}
+}
+
+// Message is the normalized event relayed to websocket consumers, shaped like
+// a Jetstream event but carrying only matched posts and the link they share.
+type Message struct {
+	Kind string `json:"kind"`
+	Did  string `json:"did"`
+	Rkey string `json:"rkey"`
+	// TimeUs is the post's time_us. Deletes have none.
+	TimeUs int64 `json:"time_us,omitempty"`
+	// Cursor is what consumers pass back to resume after a post, or where a
+	// reset's replay stopped. Deletes have none.
+	Cursor string       `json:"cursor,omitempty"`
+	Post   *MessagePost `json:"post,omitempty"`
+	Link   *MessageLink `json:"link,omitempty"`
+}
+
+type MessagePost struct {
+	Cid       string    `json:"cid"`
+	CreatedAt time.Time `json:"created_at"`
+	Text      string    `json:"text"`
+	Langs     []string  `json:"langs,omitempty"`
+	// URL is the post on bsky.app.
+	URL string `json:"url"`
+}
+
+type MessageLink struct {
+	URL   string `json:"url"`
+	Forge string `json:"forge,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// NewMessage converts a hub event into its relayed form.
+func NewMessage(e Event) Message {
+	switch data := e.Data.(type) {
+	case db.DBPost:
+		link := &MessageLink{URL: data.URI}
+		if repo, ok := db.ParseRepositoryURL(data.URI); ok {
+			link.Forge, link.Owner, link.Name = repo.Forge, repo.Owner, repo.Name
+		}
+		return Message{
+			Kind:   "post",
+			Did:    data.Did,
+			Rkey:   data.Rkey,
+			TimeUs: data.TimeUs,
+			Cursor: e.ID.String(),
+			Post: &MessagePost{
+				Cid:       data.Cid,
+				CreatedAt: data.CreatedAt,
+				Text:      data.Text,
+				Langs:     data.Languages,
+				URL:       api.Permalink(data.Did, data.Rkey),
+			},
+			Link: link,
+		}
+	case Deleted:
+		return Message{Kind: "delete", Did: data.Did, Rkey: data.Rkey}
+	case Reset:
+		return Message{Kind: "reset", Cursor: data.Cursor}
+	}
+	return Message{Kind: e.Name}
+}
@@ -0,0 +1,96 @@
+package stream
+
+import (
+	"gitfeed/db"
+	"gitfeed/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func drain(c *Client) []Event {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-c.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	require.NoError(t, repo.WritePost(dbtest.Post(1)))
+	hub, err := NewHub(repo)
+	require.NoError(t, err)
+
+	all, err := hub.Subscribe(db.PostFilter{})
+	require.NoError(t, err)
+	german, err := hub.Subscribe(db.PostFilter{Lang: "de"})
+	require.NoError(t, err)
+
+	// The repository numbers posts in the order they're written.
+	en := dbtest.Post(2)
+	en.ID = 2
+	de := dbtest.Post(3)
+	de.Languages = []string{"de"}
+	de.ID = 3
+	require.NoError(t, repo.WritePost(en))
+	require.NoError(t, repo.WritePost(de))
+	require.NoError(t, hub.Publish([]db.Change{
+		{Op: db.PostWritten, Did: dbtest.Post(1).Did, Rkey: dbtest.Post(1).Rkey, TimeUs: dbtest.Post(1).TimeUs},
+		{Op: db.PostWritten, Did: de.Did, Rkey: de.Rkey, TimeUs: de.TimeUs},
+		{Op: db.PostDeleted, Did: "did:plc:gone", Rkey: "rkey"},
+	}))
+
+	assert.Equal(t, []Event{
+		{ID: en.Cursor(), Name: "post", Data: en},
+		{ID: de.Cursor(), Name: "post", Data: de},
+		{Name: "delete", Data: Deleted{Did: "did:plc:gone", Rkey: "rkey"}},
+	}, drain(all), "posts stored before the hub aren't sent")
+	assert.Equal(t, []Event{
+		{ID: de.Cursor(), Name: "post", Data: de},
+		{Name: "delete", Data: Deleted{Did: "did:plc:gone", Rkey: "rkey"}},
+	}, drain(german))
+
+	// Edits keep their time_us and aren't sent again.
+	require.NoError(t, hub.Publish([]db.Change{{Op: db.PostWritten, TimeUs: de.TimeUs}}))
+	assert.Empty(t, drain(all))
+
+	// New posts can share the last one's time_us.
+	tied := dbtest.Post(4)
+	tied.TimeUs, tied.ID = de.TimeUs, 4
+	require.NoError(t, repo.WritePost(tied))
+	require.NoError(t, hub.Publish([]db.Change{{Op: db.PostWritten, TimeUs: tied.TimeUs}}))
+	assert.Equal(t, []Event{{ID: tied.Cursor(), Name: "post", Data: tied}}, drain(all))
+}
+
+func TestSlowClientsAreEvicted(t *testing.T) {
+	repo := db.NewMemoryPostRepository()
+	hub, err := NewHub(repo)
+	require.NoError(t, err)
+	hub.Buffer, hub.MaxClients = 1, 2
+
+	slow, err := hub.Subscribe(db.PostFilter{})
+	require.NoError(t, err)
+	_, err = hub.Subscribe(db.PostFilter{Lang: "fr"})
+	require.NoError(t, err)
+	_, err = hub.Subscribe(db.PostFilter{})
+	assert.ErrorIs(t, err, ErrTooManyClients)
+
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, repo.WritePost(dbtest.Post(i)))
+		require.NoError(t, hub.Publish([]db.Change{{Op: db.PostWritten, TimeUs: dbtest.Post(i).TimeUs}}))
+	}
+	assert.Len(t, drain(slow), 1)
+	_, ok := <-slow.Events()
+	assert.False(t, ok, "slow client is closed")
+
+	_, err = hub.Subscribe(db.PostFilter{})
+	assert.NoError(t, err, "evicted clients free their slot")
+}
@@ -0,0 +1,278 @@
+// Package syndication renders stored posts as RSS 2.0, Atom and JSON Feed 1.1
+// documents for feed readers.
+package syndication
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gitfeed/api"
+	"gitfeed/db"
+	"gitfeed/feedgen"
+	"html"
+	"io"
+	"time"
+)
+
+type Format string
+
+const (
+	RSS      Format = "rss"
+	Atom     Format = "atom"
+	JSONFeed Format = "json"
+)
+
+func (f Format) ContentType() string {
+	switch f {
+	case RSS:
+		return "application/rss+xml; charset=utf-8"
+	case Atom:
+		return "application/atom+xml; charset=utf-8"
+	}
+	return "application/feed+json; charset=utf-8"
+}
+
+// Feed is a list of posts ready to render, newest first.
+type Feed struct {
+	Title       string
+	Description string
+	// HomeURL is the site the feed belongs to, FeedURL the feed itself.
+	HomeURL string
+	FeedURL string
+	Updated time.Time
+	Items   []Item
+}
+
+type Item struct {
+	// ID is the post's AT-URI.
+	ID    string
+	Title string
+	Text  string
+	// Link is the shared repository link, Permalink the post on bsky.app.
+	Link      string
+	Permalink string
+	Author    string
+	AuthorURL string
+	Published time.Time
+	Updated   time.Time
+}
+
+// NewItem describes a stored post, titled after the repository it links to.
+func NewItem(p db.DBPost) Item {
+	title := p.URI
+	if repo, ok := db.ParseRepositoryURL(p.URI); ok {
+		title = repo.Owner + "/" + repo.Name
+	}
+	return Item{
+		ID:        feedgen.PostURI(p),
+		Title:     title,
+		Text:      p.Text,
+		Link:      p.URI,
+		Permalink: api.Permalink(p.Did, p.Rkey),
+		Author:    p.Did,
+		AuthorURL: "https://bsky.app/profile/" + p.Did,
+		Published: p.CreatedAt.UTC(),
+		Updated:   time.UnixMicro(p.TimeUs).UTC(),
+	}
+}
+
+func (i Item) html() string {
+	return fmt.Sprintf(`<p>%s</p><p><a href="%s">%s</a> · <a href="%s">View on Bluesky</a></p>`,
+		html.EscapeString(i.Text), html.EscapeString(i.Link), html.EscapeString(i.Title), html.EscapeString(i.Permalink))
+}
+
+func Write(w io.Writer, f Format, feed Feed) error {
+	switch f {
+	case RSS:
+		return writeXML(w, newRSS(feed))
+	case Atom:
+		return writeXML(w, newAtom(feed))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newJSONFeed(feed))
+}
+
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func newRSS(feed Feed) rss {
+	doc := rss{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        feed.HomeURL,
+			Description: feed.Description,
+			Self:        atomLink{Href: feed.FeedURL, Rel: "self", Type: RSS.ContentType()},
+		},
+	}
+	if !feed.Updated.IsZero() {
+		doc.Channel.LastBuildDate = feed.Updated.Format(time.RFC1123Z)
+	}
+	for _, i := range feed.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       i.Title,
+			Link:        i.Link,
+			Description: i.html(),
+			GUID:        rssGUID{IsPermaLink: true, Value: i.Permalink},
+			PubDate:     i.Published.Format(time.RFC1123Z),
+		})
+	}
+	return doc
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Author    atomPerson  `xml:"author"`
+	Links     []atomLink  `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func newAtom(feed Feed) atomFeed {
+	doc := atomFeed{
+		ID:      feed.FeedURL,
+		Title:   feed.Title,
+		Updated: feed.Updated.Format(time.RFC3339),
+		Author:  atomPerson{Name: "gitfeed", URI: feed.HomeURL},
+		Links: []atomLink{
+			{Href: feed.FeedURL, Rel: "self", Type: Atom.ContentType()},
+			{Href: feed.HomeURL, Rel: "alternate"},
+		},
+	}
+	for _, i := range feed.Items {
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:        i.ID,
+			Title:     i.Title,
+			Updated:   i.Updated.Format(time.RFC3339),
+			Published: i.Published.Format(time.RFC3339),
+			Author:    atomPerson{Name: i.Author, URI: i.AuthorURL},
+			Links: []atomLink{
+				{Href: i.Link, Rel: "alternate"},
+				{Href: i.Permalink, Rel: "related"},
+			},
+			Content: atomContent{Type: "html", Value: i.html()},
+		})
+	}
+	return doc
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished time.Time        `json:"date_published"`
+	DateModified  time.Time        `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func newJSONFeed(feed Feed) jsonFeed {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		Description: feed.Description,
+		HomePageURL: feed.HomeURL,
+		FeedURL:     feed.FeedURL,
+		Items:       []jsonFeedItem{},
+	}
+	for _, i := range feed.Items {
+		// In JSON Feed an item's url is the post itself and external_url what it links to.
+		doc.Items = append(doc.Items, jsonFeedItem{
+			ID:            i.ID,
+			URL:           i.Permalink,
+			ExternalURL:   i.Link,
+			Title:         i.Title,
+			ContentText:   i.Text,
+			ContentHTML:   i.html(),
+			DatePublished: i.Published,
+			DateModified:  i.Updated,
+			Authors:       []jsonFeedAuthor{{Name: i.Author, URL: i.AuthorURL}},
+		})
+	}
+	return doc
+}
@@ -0,0 +1,93 @@
+package syndication
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"gitfeed/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func testFeed() Feed {
+	post := dbtest.Post(1)
+	post.Text = "look <here> & there"
+	return Feed{
+		Title:   "gitfeed: latest",
+		HomeURL: "https://gitfeed.example.com/",
+		FeedURL: "https://gitfeed.example.com/feed.rss",
+		Updated: time.Unix(1700000000, 0).UTC(),
+		Items:   []Item{NewItem(post)},
+	}
+}
+
+func TestNewItem(t *testing.T) {
+	item := NewItem(dbtest.Post(1))
+	assert.Equal(t, "owner/repo1", item.Title)
+	assert.Equal(t, "https://github.com/owner/repo1", item.Link)
+	assert.Equal(t, "https://bsky.app/profile/did:plc:author1/post/rkey1", item.Permalink)
+	assert.Equal(t, "at://did:plc:author1/app.bsky.feed.post/rkey1", item.ID)
+}
+
+func TestWrite(t *testing.T) {
+	feed := testFeed()
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, RSS, feed))
+	var rssDoc struct {
+		Channel struct {
+			Items []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Description string `xml:"description"`
+				GUID        string `xml:"guid"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &rssDoc))
+	require.Len(t, rssDoc.Channel.Items, 1)
+	item := rssDoc.Channel.Items[0]
+	assert.Equal(t, "owner/repo1", item.Title)
+	assert.Equal(t, "https://github.com/owner/repo1", item.Link)
+	assert.Equal(t, "https://bsky.app/profile/did:plc:author1/post/rkey1", item.GUID)
+	assert.Contains(t, item.Description, "look &lt;here&gt; &amp; there", "post text is escaped inside the HTML")
+	assert.Contains(t, buf.String(), `<atom:link href="https://gitfeed.example.com/feed.rss" rel="self"`)
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, Atom, feed))
+	var atomDoc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			ID    string `xml:"id"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &atomDoc))
+	assert.Equal(t, "2023-11-14T22:13:20Z", atomDoc.Updated)
+	require.Len(t, atomDoc.Entries, 1)
+	assert.Equal(t, "at://did:plc:author1/app.bsky.feed.post/rkey1", atomDoc.Entries[0].ID)
+	assert.Len(t, atomDoc.Entries[0].Links, 2)
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, JSONFeed, feed))
+	var jsonDoc struct {
+		Version string `json:"version"`
+		Items   []struct {
+			URL         string `json:"url"`
+			ExternalURL string `json:"external_url"`
+			ContentText string `json:"content_text"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &jsonDoc))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", jsonDoc.Version)
+	require.Len(t, jsonDoc.Items, 1)
+	assert.Equal(t, "https://bsky.app/profile/did:plc:author1/post/rkey1", jsonDoc.Items[0].URL)
+	assert.Equal(t, "https://github.com/owner/repo1", jsonDoc.Items[0].ExternalURL)
+	assert.Equal(t, "look <here> & there", jsonDoc.Items[0].ContentText)
+}
@@ -0,0 +1,233 @@
+package trending
+
+import (
+	"container/list"
+	"fmt"
+	"gitfeed/db"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxAge is the longest window trending looks back over; engagement on older
+// posts no longer affects any score.
+const MaxAge = 7 * 24 * time.Hour
+
+// DefaultCacheSize is how many rankings an Engine keeps. Every window and
+// filter combination is ranked separately, so the cache has to be bounded.
+const DefaultCacheSize = 256
+
+type Window struct {
+	Name     string
+	Duration time.Duration
+	// HalfLife is how long it takes a mention to lose half its weight.
+	HalfLife time.Duration
+}
+
+var Windows = []Window{
+	{Name: "1h", Duration: time.Hour, HalfLife: 15 * time.Minute},
+	{Name: "24h", Duration: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Name: "7d", Duration: MaxAge, HalfLife: 36 * time.Hour},
+}
+
+func ParseWindow(name string) (Window, error) {
+	for _, w := range Windows {
+		if w.Name == name {
+			return w, nil
+		}
+	}
+	return Window{}, fmt.Errorf("unknown trending window %q", name)
+}
+
+type Weights struct {
+	// Mention is the weight of one fresh mention.
+	Mention float64
+	// Author is the weight of one fresh distinct author.
+	Author float64
+	// Engagement scales the log of likes, reposts and replies on a mentioning post.
+	Engagement float64
+	// Repeat multiplies each further mention of a repository by the same DID,
+	// so the k-th repeat counts Repeat^k of a normal mention.
+	Repeat float64
+}
+
+var DefaultWeights = Weights{Mention: 1, Author: 1, Engagement: 0.5, Repeat: 0.5}
+
+type Repository struct {
+	Forge      string  `json:"forge"`
+	Owner      string  `json:"owner"`
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Score      float64 `json:"score"`
+	Mentions   int     `json:"mentions"`
+	Authors    int     `json:"authors"`
+	Engagement int64   `json:"engagement"`
+	LastSeen   int64   `json:"last_seen"`
+}
+
+// Score ranks the repositories mentioned inside the window, highest first.
+// Mentions are expected in ascending time order.
+func Score(mentions []db.Mention, w Window, weights Weights, now time.Time) []Repository {
+	since := now.Add(-w.Duration).UnixMicro()
+	decay := func(timeUs int64) float64 {
+		age := float64(now.UnixMicro()-timeUs) / float64(w.HalfLife.Microseconds())
+		return math.Pow(0.5, math.Max(age, 0))
+	}
+
+	type author struct {
+		mentions int
+		latest   int64
+	}
+	type tally struct {
+		repo    Repository
+		score   float64
+		authors map[string]*author
+	}
+	tallies := make(map[int64]*tally)
+
+	for _, m := range mentions {
+		if m.TimeUs < since {
+			continue
+		}
+		t, ok := tallies[m.RepositoryID]
+		if !ok {
+			repo := db.Repository{Forge: m.Forge, Owner: m.Owner, Name: m.Name}
+			t = &tally{
+				repo:    Repository{Forge: m.Forge, Owner: m.Owner, Name: m.Name, URL: repo.URL()},
+				authors: make(map[string]*author),
+			}
+			tallies[m.RepositoryID] = t
+		}
+		a, ok := t.authors[m.Did]
+		if !ok {
+			a = &author{}
+			t.authors[m.Did] = a
+		}
+
+		d := decay(m.TimeUs)
+		engagement := m.Likes + m.Reposts + m.Replies
+		t.score += weights.Mention * d * math.Pow(weights.Repeat, float64(a.mentions))
+		t.score += weights.Engagement * d * math.Log1p(float64(engagement))
+
+		a.mentions++
+		a.latest = max(a.latest, m.TimeUs)
+		t.repo.Mentions++
+		t.repo.Engagement += engagement
+		t.repo.LastSeen = max(t.repo.LastSeen, m.TimeUs)
+	}
+
+	repos := make([]Repository, 0, len(tallies))
+	for _, t := range tallies {
+		for _, a := range t.authors {
+			t.score += weights.Author * decay(a.latest)
+		}
+		t.repo.Authors = len(t.authors)
+		t.repo.Score = t.score
+		repos = append(repos, t.repo)
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Score != repos[j].Score {
+			return repos[i].Score > repos[j].Score
+		}
+		return repos[i].LastSeen > repos[j].LastSeen
+	})
+	return repos
+}
+
+type cached struct {
+	key      cacheKey
+	repos    []Repository
+	computed time.Time
+}
+
+// Engine scores repositories from stored mentions and caches each window's
+// ranking for TTL, since every request would otherwise rescan the whole window.
+type Engine struct {
+	repo    db.TrendingRepo
+	Weights Weights
+	TTL     time.Duration
+	// CacheSize is how many rankings are kept, least recently used dropped first.
+	CacheSize int
+
+	mu    sync.Mutex
+	cache map[cacheKey]*list.Element
+	order *list.List
+	now   func() time.Time
+}
+
+type cacheKey struct {
+	window string
+	filter db.PostFilter
+}
+
+func NewEngine(repo db.TrendingRepo) *Engine {
+	return &Engine{
+		repo:      repo,
+		Weights:   DefaultWeights,
+		TTL:       time.Minute,
+		CacheSize: DefaultCacheSize,
+		cache:     make(map[cacheKey]*list.Element),
+		order:     list.New(),
+		now:       time.Now,
+	}
+}
+
+// Trending ranks repositories mentioned in the window by posts matching filter.
+func (e *Engine) Trending(w Window, filter db.PostFilter, limit int) ([]Repository, error) {
+	now := e.now()
+	key := cacheKey{window: w.Name, filter: filter}
+
+	e.mu.Lock()
+	c, ok := e.get(key)
+	e.mu.Unlock()
+
+	if !ok || now.Sub(c.computed) > e.TTL {
+		mentions, err := e.repo.GetMentions(now.Add(-w.Duration).UnixMicro(), filter)
+		if err != nil {
+			return nil, err
+		}
+		c = cached{key: key, repos: Score(mentions, w, e.Weights, now), computed: now}
+
+		e.mu.Lock()
+		e.add(c)
+		e.mu.Unlock()
+	}
+
+	if limit < len(c.repos) {
+		return c.repos[:limit], nil
+	}
+	return c.repos, nil
+}
+
+// Invalidate drops every cached ranking so the next request rescores.
+func (e *Engine) Invalidate() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cache = make(map[cacheKey]*list.Element)
+	e.order.Init()
+}
+
+func (e *Engine) get(key cacheKey) (cached, bool) {
+	el, ok := e.cache[key]
+	if !ok {
+		return cached{}, false
+	}
+	e.order.MoveToFront(el)
+	return el.Value.(cached), true
+}
+
+func (e *Engine) add(c cached) {
+	if el, ok := e.cache[c.key]; ok {
+		el.Value = c
+		e.order.MoveToFront(el)
+		return
+	}
+	e.cache[c.key] = e.order.PushFront(c)
+	for e.order.Len() > e.CacheSize {
+		oldest := e.order.Back()
+		e.order.Remove(oldest)
+		delete(e.cache, oldest.Value.(cached).key)
+	}
+}
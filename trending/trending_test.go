@@ -0,0 +1,93 @@
+package trending
+
+import (
+	"gitfeed/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.UTC)
+	at := func(ago time.Duration) int64 { return now.Add(-ago).UnixMicro() }
+	window, err := ParseWindow("24h")
+	assert.NoError(t, err)
+
+	mentions := []db.Mention{
+		// One account spamming the same link five times.
+		{RepositoryID: 1, Forge: "github", Owner: "spam", Name: "repo", Did: "did:plc:spammer", TimeUs: at(5 * time.Hour)},
+		{RepositoryID: 1, Forge: "github", Owner: "spam", Name: "repo", Did: "did:plc:spammer", TimeUs: at(4 * time.Hour)},
+		{RepositoryID: 1, Forge: "github", Owner: "spam", Name: "repo", Did: "did:plc:spammer", TimeUs: at(3 * time.Hour)},
+		{RepositoryID: 1, Forge: "github", Owner: "spam", Name: "repo", Did: "did:plc:spammer", TimeUs: at(2 * time.Hour)},
+		{RepositoryID: 1, Forge: "github", Owner: "spam", Name: "repo", Did: "did:plc:spammer", TimeUs: at(1 * time.Hour)},
+		// Three different people sharing a repo once each.
+		{RepositoryID: 2, Forge: "github", Owner: "good", Name: "repo", Did: "did:plc:a", TimeUs: at(3 * time.Hour)},
+		{RepositoryID: 2, Forge: "github", Owner: "good", Name: "repo", Did: "did:plc:b", TimeUs: at(2 * time.Hour)},
+		{RepositoryID: 2, Forge: "github", Owner: "good", Name: "repo", Did: "did:plc:c", TimeUs: at(1 * time.Hour)},
+		// Same shape as repo 2, but a day older and outside the window.
+		{RepositoryID: 3, Forge: "github", Owner: "old", Name: "repo", Did: "did:plc:a", TimeUs: at(27 * time.Hour)},
+		{RepositoryID: 3, Forge: "github", Owner: "old", Name: "repo", Did: "did:plc:b", TimeUs: at(26 * time.Hour)},
+		{RepositoryID: 3, Forge: "github", Owner: "old", Name: "repo", Did: "did:plc:c", TimeUs: at(25 * time.Hour)},
+		// A single mention that got a lot of engagement.
+		{RepositoryID: 4, Forge: "github", Owner: "liked", Name: "repo", Did: "did:plc:d", TimeUs: at(1 * time.Hour), Likes: 50, Reposts: 10},
+		{RepositoryID: 5, Forge: "github", Owner: "plain", Name: "repo", Did: "did:plc:e", TimeUs: at(1 * time.Hour)},
+	}
+
+	got := Score(mentions, window, DefaultWeights, now)
+
+	var names []string
+	for _, r := range got {
+		names = append(names, r.Owner)
+	}
+	assert.Equal(t, []string{"good", "liked", "spam", "plain"}, names)
+
+	assert.Equal(t, 5, got[2].Mentions)
+	assert.Equal(t, 1, got[2].Authors)
+	assert.Equal(t, 3, got[0].Authors)
+	assert.Equal(t, int64(60), got[1].Engagement)
+	assert.Equal(t, "https://github.com/good/repo", got[0].URL)
+}
+
+func TestScoreDecay(t *testing.T) {
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.UTC)
+	window, err := ParseWindow("7d")
+	assert.NoError(t, err)
+
+	mentions := []db.Mention{
+		{RepositoryID: 1, Owner: "stale", Did: "did:plc:a", TimeUs: now.Add(-6 * 24 * time.Hour).UnixMicro()},
+		{RepositoryID: 1, Owner: "stale", Did: "did:plc:b", TimeUs: now.Add(-6 * 24 * time.Hour).UnixMicro()},
+		{RepositoryID: 2, Owner: "fresh", Did: "did:plc:c", TimeUs: now.Add(-time.Hour).UnixMicro()},
+	}
+
+	got := Score(mentions, window, DefaultWeights, now)
+	assert.Equal(t, "fresh", got[0].Owner)
+	assert.Less(t, got[1].Score, got[0].Score)
+}
+
+type countingRepo struct{ calls int }
+
+func (r *countingRepo) GetMentions(since int64, filter db.PostFilter) ([]db.Mention, error) {
+	r.calls++
+	return nil, nil
+}
+
+func TestEngineCacheIsBounded(t *testing.T) {
+	repo := &countingRepo{}
+	e := NewEngine(repo)
+	e.CacheSize = 2
+	w := Windows[0]
+
+	for _, lang := range []string{"en", "de", "pt"} {
+		_, err := e.Trending(w, db.PostFilter{Lang: lang}, 10)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, repo.calls)
+	assert.Len(t, e.cache, 2)
+
+	_, err := e.Trending(w, db.PostFilter{Lang: "pt"}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repo.calls, "recent rankings stay cached")
+	_, err = e.Trending(w, db.PostFilter{Lang: "en"}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, repo.calls, "the least recently used ranking was dropped")
+}